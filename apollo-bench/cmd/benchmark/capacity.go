@@ -0,0 +1,102 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"apollo-bench/pkg/bench"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newCapacityCmd() *cobra.Command {
+	var (
+		cfg          = bench.DefaultConfig()
+		capCfg       = benchmark.DefaultCapacityConfig()
+		cpuAffinity  string
+		outputFormat string
+	)
+	// The default worker counts depend on the CPUs left after pinning.
+	capCfg.Parallelism = nil
+
+	cmd := &cobra.Command{
+		Use:   "capacity",
+		Short: "Search the highest open-loop arrival rate whose p99 latency meets an SLO",
+		Args:  cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			cores := runtime.GOMAXPROCS(0)
+			if cpuAffinity != "" {
+				cpus, err := benchmark.ParseCPUList(cpuAffinity)
+				if err != nil {
+					return err
+				}
+				capCfg.Cores = len(cpus)
+				cores = capCfg.Cores
+			}
+			if !cmd.Flags().Changed("parallelism") {
+				// Worker counts double up to the CPUs the search runs on.
+				for p := 1; p <= cores; p *= 2 {
+					capCfg.Parallelism = append(capCfg.Parallelism, p)
+				}
+			}
+			if !cmd.Flags().Changed("seed") {
+				capCfg.Seed = time.Now().UnixNano()
+			}
+			if err := capCfg.Validate(); err != nil {
+				return err
+			}
+			return cfg.Validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Capacity command started", "sloP99", capCfg.SLOP99)
+			cmd.SilenceUsage = true
+
+			if cpuAffinity != "" {
+				if err := benchmark.PinCPUs(cpuAffinity); err != nil {
+					return fmt.Errorf("pin CPUs %s: %w", cpuAffinity, err)
+				}
+				slog.Info("Benchmark process pinned", "cpus", cpuAffinity)
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			result, err := benchmark.ExecuteCapacity(ctx, cfg, capCfg)
+			if err != nil {
+				return err
+			}
+			if err := benchmark.PrintCapacity(*result, outputFormat); err != nil {
+				return err
+			}
+			slog.Debug("Capacity command finished")
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&capCfg.SLOP99, "slo-p99", capCfg.SLOP99, "p99 latency from arrival to built transaction that a rate must stay under")
+	cmd.Flags().IntSliceVarP(&capCfg.Parallelism, "parallelism", "p", capCfg.Parallelism, "Worker counts to search, e.g. 1,2,4 (default powers of two up to GOMAXPROCS or the --cpu-affinity CPUs)")
+	cmd.Flags().StringVar(&capCfg.Search, "search", capCfg.Search, "How rates are searched: binary (bisect up to the closed-loop throughput) or step (evenly spaced rates)")
+	cmd.Flags().IntVar(&capCfg.Steps, "steps", capCfg.Steps, "Rates tried per parallelism after the closed-loop probe")
+	cmd.Flags().DurationVar(&capCfg.StepDuration, "step-duration", capCfg.StepDuration, "How long arrivals are generated at every rate")
+	cmd.Flags().IntVar(&capCfg.MaxQueue, "max-queue", capCfg.MaxQueue, "Arrivals that may wait for a worker; more are dropped and miss the SLO")
+	cmd.Flags().StringVar(&capCfg.Arrivals, "arrivals", capCfg.Arrivals, "Arrival process ("+strings.Join(benchmark.ArrivalProcesses(), ", ")+")")
+	cmd.Flags().Int64Var(&capCfg.Seed, "seed", 0, "Seed for Poisson arrivals (default: current time)")
+	cmd.Flags().StringVar(&cpuAffinity, "cpu-affinity", "", "Pin the process to these CPUs (Linux only) and report the rate per pinned core, e.g. 2")
+	cmd.Flags().IntVarP(&cfg.Iterations, "iterations", "i", cfg.Iterations, "Builds of the closed-loop probe that bounds the searched rates")
+	cmd.Flags().IntVar(&cfg.Warmup.Iterations, "warmup-iterations", cfg.Warmup.Iterations, "Number of builds to execute and discard before searching")
+	cmd.Flags().StringVar(&cfg.Scenario, "scenario", cfg.Scenario, "Transaction scenario to build ("+strings.Join(benchmark.Scenarios(), ", ")+")")
+	cmd.Flags().IntVarP(&cfg.UTxOInput, "utxo-input", "u", cfg.UTxOInput, "Number of UTXOs to use as input")
+	cmd.Flags().IntVarP(&cfg.UTxOOutput, "utxo-output", "v", cfg.UTxOOutput, "Number of UTXOs to generate as output")
+	cmd.Flags().IntVar(&cfg.UTxOLevel, "utxo-level", cfg.UTxOLevel, "Set UTXO generation level: 1=simple, 2=differentiated, 3=congested")
+	cmd.Flags().StringVar(&cfg.OutputShape, "output-shape", cfg.OutputShape, "Native tokens of the requested outputs ("+strings.Join(benchmark.OutputShapes(), ", ")+")")
+	cmd.Flags().IntVar(&cfg.AssetsPerOutput, "assets-per-output", cfg.AssetsPerOutput, "Assets (or policies for multi-policy) per output when --output-shape is not lovelace")
+	cmd.Flags().StringVar(&cfg.BackendLatency, "backend-latency", "", "Inject chain context latency, e.g. 5ms or '*=2ms,GetProtocolParams=40ms~10ms+5ms@1%'")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table/json)")
+
+	return cmd
+}
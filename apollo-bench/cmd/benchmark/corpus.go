@@ -0,0 +1,98 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"apollo-bench/pkg/bench"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newCorpusCmd() *cobra.Command {
+	var (
+		cfg       = bench.DefaultConfig()
+		scenarios []string
+		dir       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "corpus",
+		Short: "Write the CBOR of every deterministic scenario's transaction to a golden corpus",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Corpus command started", "scenarios", scenarios, "dir", dir)
+			cmd.SilenceUsage = true
+
+			if dir == "" {
+				var err error
+				if dir, err = benchmark.DefaultCorpusDir(); err != nil {
+					return fmt.Errorf("%w, pass --dir", err)
+				}
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			files, err := benchmark.WriteCorpus(ctx, cfg, scenarios, dir)
+			if err != nil {
+				return err
+			}
+			slog.Info("Golden corpus written", "dir", dir, "transactions", len(files), "apolloVersion", benchmark.ApolloVersion())
+			slog.Debug("Corpus command finished")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&scenarios, "scenario", benchmark.DeterministicScenarios(), "Scenarios to build ("+strings.Join(benchmark.DeterministicScenarios(), ", ")+")")
+	cmd.Flags().StringVar(&dir, "dir", "", "Directory to write <scenario>.cbor files to (default testdata/golden under the module root)")
+	cmd.Flags().IntVarP(&cfg.UTxOInput, "utxo-input", "u", cfg.UTxOInput, "Number of UTXOs to use as input")
+	cmd.Flags().IntVarP(&cfg.UTxOOutput, "utxo-output", "v", cfg.UTxOOutput, "Number of UTXOs to generate as output")
+	cmd.Flags().IntVar(&cfg.UTxOLevel, "utxo-level", cfg.UTxOLevel, "Set UTXO generation level: 1=simple, 2=differentiated, 3=congested")
+	cmd.Flags().StringVar(&cfg.OutputShape, "output-shape", cfg.OutputShape, "Native tokens of the requested outputs ("+strings.Join(benchmark.OutputShapes(), ", ")+")")
+	cmd.Flags().IntVar(&cfg.AssetsPerOutput, "assets-per-output", cfg.AssetsPerOutput, "Assets (or policies for multi-policy) per output when --output-shape is not lovelace")
+
+	return cmd
+}
+
+func newDiffCmd() *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "diff <old> <new>",
+		Short: "Report the structural differences between two golden corpora or transaction files",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Diff command started", "old", args[0], "new", args[1])
+			cmd.SilenceUsage = true
+
+			diffs, err := benchmark.DiffCorpus(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			if outputFormat == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(diffs); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
+			} else {
+				benchmark.PrintCorpusDiff(args[0], args[1], diffs)
+			}
+
+			if benchmark.CorpusChanged(diffs) {
+				return benchmark.ErrCorpusChanged
+			}
+			slog.Debug("Diff command finished")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table/json)")
+
+	return cmd
+}
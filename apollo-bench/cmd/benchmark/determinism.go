@@ -0,0 +1,109 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"apollo-bench/pkg/bench"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newDeterminismCmd() *cobra.Command {
+	var (
+		cfg          = bench.DefaultConfig()
+		scenarios    []string
+		builds       int
+		save         string
+		against      string
+		outputFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "determinism",
+		Short: "Check that identical inputs build identical transactions, sequentially, in parallel and across saved runs",
+		Args:  cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if builds <= 0 {
+				return errors.New("--builds must be > 0")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Determinism command started", "scenarios", scenarios)
+			cmd.SilenceUsage = true
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			report, err := benchmark.CheckDeterminism(ctx, cfg, scenarios, builds)
+			if err != nil {
+				return err
+			}
+			if save != "" {
+				if err := benchmark.WriteDeterminismReport(save, *report); err != nil {
+					return err
+				}
+				slog.Info("Determinism report saved", "file", save)
+			}
+
+			var changes []benchmark.DeterminismChange
+			if against != "" {
+				base, err := benchmark.LoadDeterminismReport(against)
+				if err != nil {
+					return err
+				}
+				if changes, err = benchmark.CompareDeterminism(*base, *report); err != nil {
+					return err
+				}
+				slog.Info("Compared against saved report", "file", against,
+					"apolloVersion", base.ApolloVersion, "changedScenarios", len(changes))
+			}
+
+			if outputFormat == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(struct {
+					*benchmark.DeterminismReport
+					Changes []benchmark.DeterminismChange `json:"changes,omitempty"`
+				}{report, changes}); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
+			} else {
+				benchmark.PrintDeterminism(*report, against, changes)
+			}
+
+			var errs []error
+			if !report.Deterministic() {
+				errs = append(errs, benchmark.ErrNondeterministic)
+			}
+			if report.Failed() {
+				errs = append(errs, benchmark.ErrBuildFailed)
+			}
+			if len(errs) > 0 {
+				return errors.Join(errs...)
+			}
+			slog.Debug("Determinism command finished")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&scenarios, "scenario", benchmark.DeterministicScenarios(), "Scenarios to check ("+strings.Join(benchmark.DeterministicScenarios(), ", ")+")")
+	cmd.Flags().IntVar(&builds, "builds", 200, "Builds per scenario, made once sequentially and once in parallel")
+	cmd.Flags().IntVarP(&cfg.Parallelism, "parallelism", "p", cfg.Parallelism, "Number of parallel goroutines for the parallel builds")
+	cmd.Flags().IntVarP(&cfg.UTxOInput, "utxo-input", "u", cfg.UTxOInput, "Number of UTXOs to use as input")
+	cmd.Flags().IntVarP(&cfg.UTxOOutput, "utxo-output", "v", cfg.UTxOOutput, "Number of UTXOs to generate as output")
+	cmd.Flags().IntVar(&cfg.UTxOLevel, "utxo-level", cfg.UTxOLevel, "Set UTXO generation level: 1=simple, 2=differentiated, 3=congested")
+	cmd.Flags().StringVar(&cfg.OutputShape, "output-shape", cfg.OutputShape, "Native tokens of the requested outputs ("+strings.Join(benchmark.OutputShapes(), ", ")+")")
+	cmd.Flags().IntVar(&cfg.AssetsPerOutput, "assets-per-output", cfg.AssetsPerOutput, "Assets (or policies for multi-policy) per output when --output-shape is not lovelace")
+	cmd.Flags().StringVar(&save, "save", "", "Write the per-scenario hashes and fingerprints to this JSON file")
+	cmd.Flags().StringVar(&against, "against", "", "Report how every scenario's transaction differs from this saved report, e.g. one of another Apollo version")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table/json)")
+
+	return cmd
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"apollo-bench/internal/benchmark"
+	"apollo-bench/pkg/bench"
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/lmittmann/tint"
@@ -13,14 +19,14 @@ import (
 
 func main() {
 	var (
-		utxoInput    int
-		utxoOutput   int
-		iterations   int
-		parallelism  int
+		cfg          = bench.DefaultConfig()
 		outputFormat string
-		cpuProfile   string
 		logLevel     string
-		utxoLevel    int
+		cpuAffinity  string
+		targetCI     string
+		trials       int
+		freshProcess bool
+		outliers     = benchmark.OutlierOptions{Threshold: benchmark.DefaultOutlierThreshold}
 	)
 
 	cmd := &cobra.Command{
@@ -55,35 +61,120 @@ func main() {
 			slog.Debug("Command PersistentPreRunE finished")
 			return nil
 		},
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			slog.Debug("Command Run started")
-			benchmark.Run(utxoInput, utxoOutput, iterations, parallelism, outputFormat, cpuProfile, utxoLevel)
+			// Flags were valid, errors from here on are not usage errors.
+			cmd.SilenceUsage = true
+
+			if cpuAffinity != "" {
+				if err := benchmark.PinCPUs(cpuAffinity); err != nil {
+					return fmt.Errorf("pin CPUs %s: %w", cpuAffinity, err)
+				}
+				slog.Info("Benchmark process pinned", "cpus", cpuAffinity)
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			if trials > 1 {
+				run := func(ctx context.Context, trial int) (*benchmark.BenchmarkResult, error) {
+					// Start every in-process trial from a collected heap.
+					runtime.GC()
+					return bench.Run(ctx, trialConfig(cfg, trial))
+				}
+				if freshProcess {
+					run = func(ctx context.Context, trial int) (*benchmark.BenchmarkResult, error) {
+						return runTrialProcess(ctx, trialArgs(cmd, trial))
+					}
+				}
+				result, err := benchmark.ExecuteTrials(ctx, trials, outliers, run)
+				if err != nil {
+					return err
+				}
+				result.Summary.FreshProcess = freshProcess
+				return benchmark.PrintTrials(*result, outputFormat)
+			}
+
+			result, err := bench.Run(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			if err := benchmark.PrintResults(*result, outputFormat); err != nil {
+				return err
+			}
 			slog.Debug("Command Run finished")
+			return nil
 		},
 	}
 
-	cmd.Flags().IntVarP(&utxoInput, "utxo-input", "u", 10, "Number of UTXOs to use as input")
-	cmd.Flags().IntVarP(&utxoOutput, "utxo-output", "v", 10, "Number of UTXOs to generate as output")
-	cmd.Flags().IntVar(&utxoLevel, "utxo-level", 1, "Set UTXO generation level: 1=simple, 2=differentiated, 3=congested")
-	cmd.Flags().IntVarP(&iterations, "iterations", "i", 1000, "Number of transactions to build")
-	cmd.Flags().IntVarP(&parallelism, "parallelism", "p", 4, "Number of parallel goroutines")
+	cmd.Flags().StringVar(&cfg.Scenario, "scenario", cfg.Scenario, "Transaction scenario to benchmark ("+strings.Join(benchmark.Scenarios(), ", ")+")")
+	cmd.Flags().StringVar(&cfg.Sender, "sender", envOr("APOLLO_BENCH_SENDER", cfg.Sender), "Bech32 address holding the input UTXOs [$APOLLO_BENCH_SENDER]")
+	cmd.Flags().StringVar(&cfg.Receiver, "receiver", envOr("APOLLO_BENCH_RECEIVER", cfg.Receiver), "Bech32 address receiving the outputs [$APOLLO_BENCH_RECEIVER]")
+	cmd.Flags().StringVar(&cfg.Network, "network", envOr("APOLLO_BENCH_NETWORK", cfg.Network), "Network of the addresses ("+strings.Join(benchmark.Networks(), ", ")+") [$APOLLO_BENCH_NETWORK]")
+	cmd.Flags().IntVarP(&cfg.UTxOInput, "utxo-input", "u", cfg.UTxOInput, "Number of UTXOs to use as input")
+	cmd.Flags().IntVarP(&cfg.UTxOOutput, "utxo-output", "v", cfg.UTxOOutput, "Number of UTXOs to generate as output")
+	cmd.Flags().IntVar(&cfg.UTxOLevel, "utxo-level", cfg.UTxOLevel, "Set UTXO generation level: 1=simple, 2=differentiated, 3=congested")
+	cmd.Flags().IntVarP(&cfg.Iterations, "iterations", "i", cfg.Iterations, "Number of transactions to build")
+	cmd.Flags().IntVarP(&cfg.Parallelism, "parallelism", "p", cfg.Parallelism, "Number of parallel goroutines")
 	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table/json)")
-	cmd.Flags().StringVarP(&cpuProfile, "cpu-profile", "c", "", "Write CPU profile to file")
-	cmd.Flags().StringVar(&logLevel, "log-level", "info", "Set logging level (debug, info, warn, error)")
+	cmd.Flags().StringVarP(&cfg.CPUProfile, "cpu-profile", "c", "", "Write CPU profile to file")
+	cmd.Flags().StringVar(&cfg.MemProfile, "mem-profile", "", "Write the alloc profile of the measured iterations to file")
+	cmd.Flags().IntVar(&cfg.Hotspots, "hotspots", cfg.Hotspots, "Functions listed per profile by flat and cumulative value, 0 to skip parsing the profiles")
+	cmd.Flags().IntVar(&cfg.Warmup.Iterations, "warmup-iterations", cfg.Warmup.Iterations, "Number of builds to execute and discard before measuring (upper bound with --warmup-adaptive)")
+	cmd.Flags().BoolVar(&cfg.Warmup.Adaptive, "warmup-adaptive", false, "Keep warming up until the rolling mean latency stabilizes")
+	cmd.Flags().IntVar(&cfg.Warmup.Window, "warmup-window", cfg.Warmup.Window, "Builds per rolling window in adaptive warm-up")
+	cmd.Flags().Float64Var(&cfg.Warmup.Tolerance, "warmup-tolerance", cfg.Warmup.Tolerance, "Relative change between consecutive window means considered stable")
+	cmd.Flags().StringVar(&targetCI, "target-ci", "", "Keep running batches of --iterations until the 95% CI of mean latency is within this relative width, e.g. 1% (±0.5% of the mean)")
+	cmd.Flags().DurationVar(&cfg.Precision.MaxDuration, "max-duration", cfg.Precision.MaxDuration, "Time limit for measuring when --target-ci is set, must be > 0 with it")
+	cmd.Flags().StringVar(&cfg.ReproDir, "repro-dir", "", "Write a reproducer bundle for each failing iteration class to this directory")
+	cmd.Flags().StringVar(&cpuAffinity, "cpu-affinity", "", "Pin the benchmark process to these CPUs (Linux only), e.g. 2-3")
+	cmd.Flags().StringVar(&cfg.BackendLatency, "backend-latency", "", "Inject chain context latency, e.g. 5ms or '*=2ms,GetProtocolParams=40ms~10ms+5ms@1%'")
+	cmd.Flags().IntVar(&cfg.Addresses, "addresses", cfg.Addresses, "Number of wallet addresses the input UTXOs are spread over")
+	cmd.Flags().StringVar(&cfg.AddressMix, "address-mix", "", "Weights of the wallet address types, e.g. base=6,enterprise=2,script=1,pointer=1")
+	cmd.Flags().StringVar(&cfg.OutputShape, "output-shape", cfg.OutputShape, "Native tokens of the requested outputs ("+strings.Join(benchmark.OutputShapes(), ", ")+")")
+	cmd.Flags().IntVar(&cfg.AssetsPerOutput, "assets-per-output", cfg.AssetsPerOutput, "Assets (or policies for multi-policy) per output when --output-shape is not lovelace")
+	cmd.Flags().BoolVar(&cfg.DetectMutation, "detect-mutation", false, "Hash the shared UTxOs and outputs during and after the run and report changes")
+	cmd.Flags().DurationVar(&cfg.MutationInterval, "mutation-interval", cfg.MutationInterval, "Time between mutation checks during the run")
+	cmd.Flags().BoolVar(&cfg.DeepClone, "deep-clone", false, "Give every build a deep copy of the UTxOs instead of sharing their maps and byte slices")
+	cmd.Flags().IntVar(&cfg.Mint.Assets, "mint-assets", cfg.Mint.Assets, "Assets minted per transaction in the mint scenario")
+	cmd.Flags().IntVar(&cfg.Mint.Burns, "burn-assets", cfg.Mint.Burns, "Assets burned per transaction in the mint scenario")
+	cmd.Flags().IntVar(&cfg.Mint.NativePolicies, "native-policies", cfg.Mint.NativePolicies, "Native-script policies the mint scenario spreads its assets over")
+	cmd.Flags().IntVar(&cfg.Mint.PlutusPolicies, "plutus-policies", cfg.Mint.PlutusPolicies, "Plutus policies with redeemers the mint scenario spreads its assets over")
+	cmd.Flags().IntVar(&cfg.Features.MetadataBytes, "metadata-bytes", cfg.Features.MetadataBytes, "Length of the CIP-20 message attached by the metadata scenario")
+	cmd.Flags().IntVar(&cfg.Features.ValidityWindow, "validity-window", cfg.Features.ValidityWindow, "Slots between validity start and TTL in the validity scenario")
+	cmd.Flags().IntVar(&cfg.Features.Withdrawals, "withdrawals", cfg.Features.Withdrawals, "Number of reward withdrawals in the withdrawals scenario")
+	cmd.Flags().IntVar(&cfg.Features.Certificates, "certificates", cfg.Features.Certificates, "Number of stake registrations in the certificates scenario (Apollo v1.3.0+, built with -tags apollo_certificates)")
+	cmd.Flags().IntVar(&trials, "trials", 1, "Run the benchmark this many times and summarize mean, stddev, min, max and CV of every metric")
+	cmd.Flags().BoolVar(&freshProcess, "fresh-process", false, "Run every trial of --trials in a fresh apollo-bench process")
+	cmd.Flags().Float64Var(&outliers.Threshold, "outlier-threshold", outliers.Threshold, "Modified z-score of wall-clock Tx/s above which a trial of --trials is flagged as an outlier")
+	cmd.Flags().BoolVar(&outliers.Exclude, "exclude-outliers", false, "Leave outlier trials of --trials out of the summary instead of only flagging them")
+	cmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Set logging level (debug, info, warn, error)")
+
+	cmd.AddCommand(newReplayCmd())
+	cmd.AddCommand(newVersionsCmd())
+	cmd.AddCommand(newDeterminismCmd())
+	cmd.AddCommand(newCorpusCmd())
+	cmd.AddCommand(newDiffCmd())
+	cmd.AddCommand(newProfDiffCmd())
+	cmd.AddCommand(newCapacityCmd())
+	cmd.AddCommand(newSoakCmd())
 
 	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
 		slog.Debug("Command PreRunE started")
-		if utxoInput <= 0 {
-			slog.Warn("Invalid --utxo-input", "value", utxoInput)
-			return errors.New("--utxo-input must be > 0")
+		var err error
+		if cfg.Precision.TargetCI, err = benchmark.ParseRelative(targetCI); err != nil {
+			slog.Warn("Invalid --target-ci", "value", targetCI)
+			return err
+		}
+		if trials <= 0 {
+			return errors.New("--trials must be > 0")
 		}
-		if utxoOutput <= 0 {
-			slog.Warn("Invalid --utxo-output", "value", utxoOutput)
-			return errors.New("--utxo-output must be > 0")
+		if outliers.Threshold <= 0 {
+			return errors.New("--outlier-threshold must be > 0")
 		}
-		if iterations <= 0 {
-			slog.Warn("Invalid --iterations", "value", iterations)
-			return errors.New("--iterations must be > 0")
+		if err := cfg.Validate(); err != nil {
+			slog.Warn("Invalid benchmark configuration", "error", err)
+			return err
 		}
 		slog.Debug("Command PreRunE finished successfully")
 		return nil
@@ -94,3 +185,12 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// envOr returns the value of the environment variable key, or fallback when
+// it is unset or empty.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newProfDiffCmd() *cobra.Command {
+	var (
+		opts         = benchmark.ProfileDiffOptions{Focus: benchmark.ApolloPackage, Top: 10}
+		outputFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "profdiff <base.pprof> <candidate.pprof>",
+		Short: "Report which functions got hotter or cooler between two CPU or alloc profiles",
+		Args:  cobra.ExactArgs(2),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Top <= 0 {
+				return errors.New("--hotspots must be > 0")
+			}
+			if opts.BaseOps < 0 || opts.CandidateOps < 0 {
+				return errors.New("--base-ops and --candidate-ops must be >= 0")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Profdiff command started", "base", args[0], "candidate", args[1])
+			cmd.SilenceUsage = true
+
+			base, err := benchmark.LoadProfile(args[0])
+			if err != nil {
+				return err
+			}
+			candidate, err := benchmark.LoadProfile(args[1])
+			if err != nil {
+				return err
+			}
+			diff, err := benchmark.DiffProfiles(base, candidate, opts)
+			if err != nil {
+				return err
+			}
+			if outputFormat == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(diff); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
+			} else {
+				benchmark.PrintProfileDiff(args[0], args[1], diff)
+			}
+			slog.Debug("Profdiff command finished")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.SampleType, "sample-type", "", "Sample type to compare, e.g. cpu or alloc_space (default: cpu or alloc_space, whichever the profiles have)")
+	cmd.Flags().StringVar(&opts.Focus, "focus", opts.Focus, "Only report functions whose name starts with this prefix, empty for all")
+	cmd.Flags().IntVar(&opts.BaseOps, "base-ops", 0, "Transactions the base profile covers, to compare per transaction")
+	cmd.Flags().IntVar(&opts.CandidateOps, "candidate-ops", 0, "Transactions the candidate profile covers, to compare per transaction")
+	cmd.Flags().IntVar(&opts.Top, "hotspots", opts.Top, "Functions listed as hotter and as cooler")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table/json)")
+
+	return cmd
+}
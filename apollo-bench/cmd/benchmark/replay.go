@@ -0,0 +1,51 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+)
+
+func newReplayCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "replay <bundle>",
+		Short: "Re-execute the build recorded in a reproducer bundle",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Replay command started", "bundle", args[0])
+
+			repro, utxos, err := benchmark.LoadReproducer(args[0])
+			if err != nil {
+				return fmt.Errorf("load reproducer: %w", err)
+			}
+			slog.Info("Loaded reproducer bundle",
+				"bundle", args[0],
+				"iteration", repro.Iteration,
+				"utxos", len(utxos),
+				"outputs", len(repro.Outputs),
+				"recordedApolloVersion", repro.ApolloVersion,
+				"apolloVersion", benchmark.ApolloVersion())
+
+			res, err := benchmark.Replay(repro, utxos)
+			if err != nil {
+				return fmt.Errorf("replay: %w", err)
+			}
+
+			if res.Panic {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\n", res.Stack)
+			}
+			switch {
+			case res.Error == nil:
+				return fmt.Errorf("%w: build succeeded in %v, recorded error: %s", benchmark.ErrNotReproduced, res.Duration, repro.Error)
+			case !repro.SameFailure(res):
+				return fmt.Errorf("%w: build failed differently: %v, recorded error: %s", benchmark.ErrNotReproduced, res.Error, repro.Error)
+			}
+			slog.Info("Failure reproduced", "error", res.Error, "panic", res.Panic)
+
+			slog.Debug("Replay command finished")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"apollo-bench/pkg/bench"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newSoakCmd() *cobra.Command {
+	var (
+		cfg          = bench.DefaultConfig()
+		soakCfg      = benchmark.DefaultSoakConfig()
+		jsonFile     string
+		csvFile      string
+		outputFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "soak",
+		Short: "Build at a steady rate for hours and flag heap, RSS or goroutine growth and latency drift",
+		Args:  cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("seed") {
+				soakCfg.Seed = time.Now().UnixNano()
+			}
+			if err := soakCfg.Validate(); err != nil {
+				return err
+			}
+			return cfg.Validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Soak command started", "duration", soakCfg.Duration, "rate", soakCfg.Rate)
+			cmd.SilenceUsage = true
+
+			// Stream the time series so hours of samples survive a crash.
+			if csvFile != "" {
+				f, err := os.Create(csvFile)
+				if err != nil {
+					return fmt.Errorf("create CSV file: %w", err)
+				}
+				defer f.Close()
+				w := csv.NewWriter(f)
+				if err := w.Write(benchmark.SoakCSVHeader()); err != nil {
+					return fmt.Errorf("write CSV: %w", err)
+				}
+				w.Flush()
+				soakCfg.OnSample = func(sample benchmark.SoakSample) {
+					if err := w.Write(sample.CSVRecord()); err != nil {
+						slog.Error("Failed to write CSV sample", "file", csvFile, "error", err)
+					}
+					w.Flush()
+				}
+			}
+
+			// Ctrl-C ends the run early and still reports the samples taken.
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			result, err := benchmark.ExecuteSoak(ctx, cfg, soakCfg)
+			if err != nil {
+				return err
+			}
+			if jsonFile != "" {
+				f, err := os.Create(jsonFile)
+				if err != nil {
+					return fmt.Errorf("create JSON file: %w", err)
+				}
+				if err := benchmark.WriteSoakJSON(f, *result); err != nil {
+					f.Close()
+					return err
+				}
+				if err := f.Close(); err != nil {
+					return err
+				}
+				slog.Info("Soak time series saved", "file", jsonFile)
+			}
+			if err := benchmark.PrintSoak(*result, outputFormat); err != nil {
+				return err
+			}
+
+			if result.Flagged() {
+				return benchmark.ErrSoakTrend
+			}
+			slog.Debug("Soak command finished")
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&soakCfg.Duration, "duration", soakCfg.Duration, "How long to build at --rate, e.g. 8h")
+	cmd.Flags().Float64Var(&soakCfg.Rate, "rate", soakCfg.Rate, "Open-loop arrival rate in tx/s")
+	cmd.Flags().DurationVar(&soakCfg.Interval, "interval", soakCfg.Interval, "Time between samples of latency percentiles, heap, RSS and goroutines")
+	cmd.Flags().IntVarP(&cfg.Parallelism, "parallelism", "p", cfg.Parallelism, "Number of workers building the arriving transactions")
+	cmd.Flags().IntVar(&soakCfg.MaxQueue, "max-queue", soakCfg.MaxQueue, "Arrivals that may wait for a worker; more are dropped")
+	cmd.Flags().StringVar(&soakCfg.Arrivals, "arrivals", soakCfg.Arrivals, "Arrival process ("+strings.Join(benchmark.ArrivalProcesses(), ", ")+")")
+	cmd.Flags().Int64Var(&soakCfg.Seed, "seed", 0, "Seed for Poisson arrivals (default: current time)")
+	cmd.Flags().Float64Var(&soakCfg.MaxGrowth, "max-growth", soakCfg.MaxGrowth, "Relative growth of heap, RSS or goroutines over the run above which a monotonic increase is flagged")
+	cmd.Flags().Float64Var(&soakCfg.MaxLatencyDrift, "max-latency-drift", soakCfg.MaxLatencyDrift, "Relative p50 or p99 latency increase over the run above which a monotonic drift is flagged")
+	cmd.Flags().StringVar(&jsonFile, "json", "", "Write the time series, trends and system information to this JSON file")
+	cmd.Flags().StringVar(&csvFile, "csv", "", "Stream the time series to this CSV file, one row per sample")
+	cmd.Flags().IntVar(&cfg.Warmup.Iterations, "warmup-iterations", cfg.Warmup.Iterations, "Number of builds to execute and discard before the soak starts")
+	cmd.Flags().StringVar(&cfg.Scenario, "scenario", cfg.Scenario, "Transaction scenario to build ("+strings.Join(benchmark.Scenarios(), ", ")+")")
+	cmd.Flags().IntVarP(&cfg.UTxOInput, "utxo-input", "u", cfg.UTxOInput, "Number of UTXOs to use as input")
+	cmd.Flags().IntVarP(&cfg.UTxOOutput, "utxo-output", "v", cfg.UTxOOutput, "Number of UTXOs to generate as output")
+	cmd.Flags().IntVar(&cfg.UTxOLevel, "utxo-level", cfg.UTxOLevel, "Set UTXO generation level: 1=simple, 2=differentiated, 3=congested")
+	cmd.Flags().StringVar(&cfg.OutputShape, "output-shape", cfg.OutputShape, "Native tokens of the requested outputs ("+strings.Join(benchmark.OutputShapes(), ", ")+")")
+	cmd.Flags().IntVar(&cfg.AssetsPerOutput, "assets-per-output", cfg.AssetsPerOutput, "Assets (or policies for multi-policy) per output when --output-shape is not lovelace")
+	cmd.Flags().StringVar(&cfg.BackendLatency, "backend-latency", "", "Inject chain context latency, e.g. 5ms or '*=2ms,GetProtocolParams=40ms~10ms+5ms@1%'")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table/json)")
+
+	return cmd
+}
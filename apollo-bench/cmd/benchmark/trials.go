@@ -0,0 +1,95 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"apollo-bench/pkg/bench"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// trialFlags are the flags of the parent process that trial processes
+// must not inherit.
+var trialFlags = map[string]bool{"trials": true, "fresh-process": true, "output": true}
+
+// trialOutputs are the flags naming the files and directories a run writes,
+// with the path every trial writes instead, so trials keep their own.
+var trialOutputs = map[string]func(path string, trial int) string{
+	"cpu-profile": trialFile,
+	"mem-profile": trialFile,
+	"repro-dir":   trialDir,
+}
+
+// trialFile inserts the trial number before the extension of file, e.g.
+// cpu.trial3.pprof.
+func trialFile(file string, trial int) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s.trial%d%s", strings.TrimSuffix(file, ext), trial, ext)
+}
+
+// trialDir returns the trial's subdirectory of dir.
+func trialDir(dir string, trial int) string {
+	return filepath.Join(dir, fmt.Sprintf("trial%d", trial))
+}
+
+// trialConfig returns cfg with the outputs of trial, see trialOutputs.
+func trialConfig(cfg bench.Config, trial int) bench.Config {
+	if cfg.CPUProfile != "" {
+		cfg.CPUProfile = trialFile(cfg.CPUProfile, trial)
+	}
+	if cfg.MemProfile != "" {
+		cfg.MemProfile = trialFile(cfg.MemProfile, trial)
+	}
+	if cfg.ReproDir != "" {
+		cfg.ReproDir = trialDir(cfg.ReproDir, trial)
+	}
+	return cfg
+}
+
+// trialArgs returns the flags set on cmd as arguments for the process of
+// trial, which runs it alone and prints its result as JSON.
+func trialArgs(cmd *cobra.Command, trial int) []string {
+	var args []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if trialFlags[f.Name] {
+			return
+		}
+		value := f.Value.String()
+		if rewrite, ok := trialOutputs[f.Name]; ok && value != "" {
+			value = rewrite(value, trial)
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", f.Name, value))
+	})
+	return append(args, "--output", "json")
+}
+
+// runTrialProcess runs one trial in a fresh apollo-bench process with args,
+// so that no heap, GC or JIT-like warm state carries over between trials.
+// The process logs to the parent's stderr.
+func runTrialProcess(ctx context.Context, args []string) (*benchmark.BenchmarkResult, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("locate apollo-bench binary: %w", err)
+	}
+	var stdout bytes.Buffer
+	child := exec.CommandContext(ctx, exe, args...)
+	child.Stdout = &stdout
+	child.Stderr = os.Stderr
+	if err := child.Run(); err != nil {
+		return nil, err
+	}
+
+	var result benchmark.BenchmarkResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("decode trial output: %w", err)
+	}
+	return &result, nil
+}
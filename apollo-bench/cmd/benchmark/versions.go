@@ -0,0 +1,217 @@
+package main
+
+import (
+	"apollo-bench/internal/benchmark"
+	"apollo-bench/internal/versions"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newVersionsCmd() *cobra.Command {
+	var (
+		params      versions.Params
+		opts        versions.TrialOptions
+		schedule    string
+		moduleDir   string
+		cacheDir    string
+		resultsDir  string
+		noiseCheck  bool
+		noiseWindow time.Duration
+		thresholds  benchmark.NoiseThresholds
+		determinism int
+		corpus      bool
+		hotspots    int
+		compareOpts = benchmark.DefaultCompareOptions()
+	)
+
+	cmd := &cobra.Command{
+		Use:   "versions <version> [version...]",
+		Short: "Benchmark and compare several Apollo versions, tags or commits",
+		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Trials <= 0 {
+				return errors.New("--trials must be > 0")
+			}
+			var err error
+			if opts.Schedule, err = versions.ParseSchedule(schedule); err != nil {
+				return err
+			}
+			if compareOpts.Statistic, err = benchmark.ParseStatistic(compareOpts.Statistic); err != nil {
+				return err
+			}
+			if compareOpts.Outliers.Threshold <= 0 {
+				return errors.New("--outlier-threshold must be > 0")
+			}
+			if opts.CPUAffinity != "" {
+				if _, err := benchmark.ParseCPUList(opts.CPUAffinity); err != nil {
+					return err
+				}
+			}
+			if !cmd.Flags().Changed("seed") {
+				opts.Seed = time.Now().UnixNano()
+			}
+			if hotspots <= 0 {
+				return errors.New("--hotspots must be > 0")
+			}
+			if params.UTxOInput <= 0 || params.UTxOOutput <= 0 || params.Iterations <= 0 {
+				return errors.New("--utxo-input, --utxo-output and --iterations must be > 0")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Debug("Versions command started", "versions", args)
+
+			// Cancel child builds and trials on Ctrl-C so temporary modules
+			// are cleaned up on the way out.
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			builder := &versions.Builder{ModuleDir: moduleDir, CacheDir: cacheDir}
+			bins := make([]versions.Binary, 0, len(args))
+			for _, version := range args {
+				bin, err := builder.Build(ctx, version)
+				if err != nil {
+					return fmt.Errorf("build %s: %w", version, err)
+				}
+				bins = append(bins, bin)
+			}
+
+			runDir := filepath.Join(resultsDir,
+				fmt.Sprintf("%s_%s", strings.Join(args, "_"), time.Now().Format("20060102_150405")))
+			if err := os.MkdirAll(runDir, 0o755); err != nil {
+				return err
+			}
+			slog.Info("Benchmark parameters",
+				"utxoInput", params.UTxOInput,
+				"utxoOutput", params.UTxOOutput,
+				"utxoLevel", params.UTxOLevel,
+				"iterations", params.Iterations,
+				"parallelism", params.Parallelism,
+				"trials", opts.Trials,
+				"schedule", opts.Schedule,
+				"cooldown", opts.Cooldown,
+				"cpuAffinity", opts.CPUAffinity,
+				"resultsDir", runDir)
+
+			if noiseCheck {
+				slog.Info("Checking machine noise before benchmarking", "window", noiseWindow)
+				report, err := benchmark.CheckNoise(ctx, 5, noiseWindow/5, thresholds)
+				if err != nil {
+					return err
+				}
+				for _, warning := range report.Warnings {
+					slog.Warn("Machine may be too busy for a stable comparison", "reason", warning)
+				}
+				if len(report.Warnings) == 0 {
+					slog.Info("Noise check passed", "loadPerCore", report.LoadPerCore, "minCPUMhz", report.MinCPUMhz)
+				}
+			}
+
+			results, err := versions.RunTrials(ctx, bins, params, opts, runDir)
+			if err != nil {
+				return err
+			}
+
+			cmp := benchmark.Compare(args, results, compareOpts)
+			fmt.Println()
+			benchmark.PrintComparison(cmp)
+			fmt.Println()
+			markdown := cmp.Markdown()
+
+			if determinism > 0 {
+				reports, err := versions.RunDeterminism(ctx, bins, params, determinism, runDir)
+				if err != nil {
+					return err
+				}
+				// Every version is compared with the first, like the
+				// transactions a rollout would replace.
+				base := args[0]
+				for _, candidate := range args[1:] {
+					changes, err := benchmark.CompareDeterminism(*reports[base], *reports[candidate])
+					if err != nil {
+						return err
+					}
+					benchmark.PrintDeterminismChanges(base, candidate, changes)
+					fmt.Println()
+					markdown += "\n" + benchmark.DeterminismChangesMarkdown(base, candidate, changes)
+				}
+			}
+
+			if opts.Profile {
+				base := args[0]
+				for _, candidate := range args[1:] {
+					for _, kind := range []string{versions.ProfileCPU, versions.ProfileAlloc} {
+						diff, err := versions.DiffProfiles(runDir, results, base, candidate, kind, hotspots)
+						if err != nil {
+							return err
+						}
+						benchmark.PrintProfileDiff(base, candidate, diff)
+						fmt.Println()
+						markdown += "\n" + benchmark.ProfileDiffMarkdown(base, candidate, diff)
+					}
+				}
+			}
+
+			if corpus {
+				dirs, err := versions.WriteCorpora(ctx, bins, params, runDir)
+				if err != nil {
+					return err
+				}
+				base := args[0]
+				for _, candidate := range args[1:] {
+					diffs, err := benchmark.DiffCorpus(dirs[base], dirs[candidate])
+					if err != nil {
+						return err
+					}
+					benchmark.PrintCorpusDiff(base, candidate, diffs)
+					fmt.Println()
+					markdown += "\n" + benchmark.CorpusDiffMarkdown(base, candidate, diffs)
+				}
+			}
+
+			resultsFile := filepath.Join(runDir, "comparison_results.md")
+			if err := os.WriteFile(resultsFile, []byte(markdown), 0o644); err != nil {
+				return err
+			}
+			slog.Info("Comparison results saved", "file", resultsFile)
+
+			slog.Debug("Versions command finished")
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&params.UTxOInput, "utxo-input", "u", 20, "Number of UTXOs to use as input")
+	cmd.Flags().IntVarP(&params.UTxOOutput, "utxo-output", "v", 20, "Number of UTXOs to generate as output")
+	cmd.Flags().IntVar(&params.UTxOLevel, "utxo-level", 2, "Set UTXO generation level: 1=simple, 2=differentiated, 3=congested")
+	cmd.Flags().IntVarP(&params.Iterations, "iterations", "i", 10000, "Number of transactions to build per trial")
+	cmd.Flags().IntVarP(&params.Parallelism, "parallelism", "p", 10, "Number of parallel goroutines")
+	cmd.Flags().IntVar(&opts.Trials, "trials", 10, "Number of benchmark trials per version")
+	cmd.Flags().StringVar(&schedule, "schedule", string(versions.ScheduleInterleaved), "Trial order across versions (sequential, interleaved, random)")
+	cmd.Flags().Int64Var(&opts.Seed, "seed", 0, "Seed for the random schedule (default: current time)")
+	cmd.Flags().DurationVar(&opts.Cooldown, "cooldown", 0, "Pause between consecutive trials, e.g. 10s")
+	cmd.Flags().StringVar(&opts.CPUAffinity, "cpu-affinity", "", "Pin every trial process to these CPUs (Linux only), e.g. 2-3")
+	cmd.Flags().StringVar(&compareOpts.Statistic, "statistic", compareOpts.Statistic, "Throughput statistic versions are compared by (mean, median, trimmed-mean)")
+	cmd.Flags().Float64Var(&compareOpts.Outliers.Threshold, "outlier-threshold", compareOpts.Outliers.Threshold, "Modified z-score above which a trial is flagged as an outlier")
+	cmd.Flags().BoolVar(&compareOpts.Outliers.Exclude, "exclude-outliers", false, "Leave outlier trials out of the statistics instead of only flagging them")
+	cmd.Flags().BoolVar(&noiseCheck, "noise-check", true, "Sample load average and CPU frequency before benchmarking and warn when the machine is busy")
+	cmd.Flags().DurationVar(&noiseWindow, "noise-window", 5*time.Second, "How long the noise check samples for")
+	cmd.Flags().Float64Var(&thresholds.MaxLoadPerCore, "max-load", 0.3, "Warn when the 1-minute load average per core exceeds this value")
+	cmd.Flags().Float64Var(&thresholds.MinFreqRatio, "min-freq-ratio", 0.9, "Warn when the CPU frequency drops below this fraction of its maximum")
+	cmd.Flags().IntVar(&determinism, "determinism", 0, "Also check every version for deterministic builds with this many builds per scenario and report which scenarios build different transactions than the first version")
+	cmd.Flags().BoolVar(&opts.Profile, "profile", false, "Also write CPU and alloc profiles of every trial and report which Apollo functions got hotter or cooler than in the first version")
+	cmd.Flags().IntVar(&hotspots, "hotspots", 10, "Functions listed as hotter and as cooler per profile diff with --profile")
+	cmd.Flags().BoolVar(&corpus, "corpus", false, "Also write the golden corpus of every version and report how its transactions differ from the first version's")
+	cmd.Flags().StringVar(&moduleDir, "module-dir", ".", "Path to the apollo-bench module to build")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", versions.DefaultCacheDir(), "Directory to cache per-version binaries in")
+	cmd.Flags().StringVar(&resultsDir, "results-dir", filepath.Join("scripts", "results"), "Directory to store trial results and comparisons in")
+
+	return cmd
+}
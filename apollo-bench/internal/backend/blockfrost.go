@@ -0,0 +1,279 @@
+package backend
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
+	"github.com/Salvionied/cbor/v2"
+)
+
+// blockfrostPageSize is the number of items Blockfrost returns per page.
+const blockfrostPageSize = 100
+
+// Ledger is the chain state served by a MockBlockfrost.
+type Ledger struct {
+	ProtocolParams Base.ProtocolParameters
+	GenesisParams  Base.GenesisParameters
+	Epoch          Base.Epoch
+	Tip            Base.Block
+
+	utxos map[string][]Base.AddressUTXO
+	txs   map[string][]Base.Output
+}
+
+// NewLedger returns an empty ledger with the given parameters whose current
+// epoch does not end for a week, so chain contexts never refresh it
+// mid-run.
+func NewLedger(pp Base.ProtocolParameters, gp Base.GenesisParameters) *Ledger {
+	now := time.Now()
+	return &Ledger{
+		ProtocolParams: pp,
+		GenesisParams:  gp,
+		Epoch: Base.Epoch{
+			Epoch:     500,
+			StartTime: int(now.Add(-24 * time.Hour).Unix()),
+			EndTime:   int(now.Add(7 * 24 * time.Hour).Unix()),
+		},
+		Tip: Base.Block{
+			Time:   int(now.Unix()),
+			Height: 3_000_000,
+			Slot:   int(now.Unix()) - gp.SystemStart,
+			Epoch:  500,
+		},
+		utxos: make(map[string][]Base.AddressUTXO),
+		txs:   make(map[string][]Base.Output),
+	}
+}
+
+// AddUTxOs makes utxos available under their output addresses. It must not
+// be called once the ledger is being served.
+func (l *Ledger) AddUTxOs(utxos ...UTxO.UTxO) {
+	for _, u := range utxos {
+		addr := u.Output.GetAddress().String()
+		txHash := hex.EncodeToString(u.Input.TransactionId)
+		amount := blockfrostAmount(u)
+
+		l.utxos[addr] = append(l.utxos[addr], Base.AddressUTXO{
+			TxHash:      txHash,
+			OutputIndex: u.Input.Index,
+			Amount:      amount,
+		})
+		l.txs[txHash] = append(l.txs[txHash], Base.Output{
+			Address:     addr,
+			Amount:      amount,
+			OutputIndex: u.Input.Index,
+		})
+	}
+}
+
+// blockfrostAmount lists the value of u the way Blockfrost does: lovelace
+// first, then one entry per asset keyed by policy id and hex asset name.
+func blockfrostAmount(u UTxO.UTxO) []Base.AddressAmount {
+	value := u.Output.GetAmount()
+	amount := []Base.AddressAmount{{Unit: "lovelace", Quantity: strconv.FormatInt(value.GetCoin(), 10)}}
+	for policy, assets := range value.GetAssets() {
+		for name, quantity := range assets {
+			amount = append(amount, Base.AddressAmount{
+				Unit:     policy.Value + name.HexString(),
+				Quantity: strconv.FormatInt(quantity, 10),
+			})
+		}
+	}
+	sort.Slice(amount[1:], func(i, j int) bool { return amount[i+1].Unit < amount[j+1].Unit })
+	return amount
+}
+
+// MockBlockfrost is an in-process HTTP server answering the Blockfrost
+// endpoints BlockFrostChainContext uses from a fixture Ledger. Submitted
+// transactions are decoded and counted but never applied to the ledger, so
+// every request sees the same state.
+type MockBlockfrost struct {
+	*httptest.Server
+	ledger *Ledger
+
+	mu        sync.Mutex
+	requests  map[string]int64
+	submitted atomic.Int64
+}
+
+// NewMockBlockfrost starts a mock serving ledger. Pass its URL as the base
+// URL to BlockFrostChainContext.NewBlockfrostChainContext and Close it when
+// done.
+func NewMockBlockfrost(ledger *Ledger) *MockBlockfrost {
+	m := &MockBlockfrost{ledger: ledger, requests: make(map[string]int64)}
+
+	mux := http.NewServeMux()
+	m.handle(mux, "GET /v0/epochs/latest", m.serveJSON(ledger.Epoch))
+	m.handle(mux, "GET /v0/epochs/latest/parameters", m.serveJSON(ledger.ProtocolParams))
+	// Apollo requests /Genesis while the Blockfrost API documents /genesis.
+	m.handle(mux, "GET /v0/Genesis", m.serveJSON(ledger.GenesisParams))
+	m.handle(mux, "GET /v0/genesis", m.serveJSON(ledger.GenesisParams))
+	m.handle(mux, "GET /v0/blocks/latest", m.serveJSON(ledger.Tip))
+	m.handle(mux, "GET /v0/addresses/{address}/utxos", m.addressUtxos)
+	m.handle(mux, "GET /v0/txs/{hash}/utxos", m.txUtxos)
+	m.handle(mux, "GET /v0/scripts/{hash}/cbor", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "The requested component has not been found.")
+	})
+	m.handle(mux, "POST /v0/tx/submit", m.submit)
+	m.handle(mux, "POST /v0/utils/txs/evaluate", m.evaluate)
+
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// Requests returns how often each endpoint was called, keyed by route.
+func (m *MockBlockfrost) Requests() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	requests := make(map[string]int64, len(m.requests))
+	for route, n := range m.requests {
+		requests[route] = n
+	}
+	return requests
+}
+
+// TotalRequests returns the number of requests served.
+func (m *MockBlockfrost) TotalRequests() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total int64
+	for _, n := range m.requests {
+		total += n
+	}
+	return total
+}
+
+// Submitted returns the number of transactions accepted by /tx/submit.
+func (m *MockBlockfrost) Submitted() int64 {
+	return m.submitted.Load()
+}
+
+// ResetStats clears the request and submission counters.
+func (m *MockBlockfrost) ResetStats() {
+	m.mu.Lock()
+	clear(m.requests)
+	m.mu.Unlock()
+	m.submitted.Store(0)
+}
+
+// handle registers h for pattern, counting requests and rejecting those
+// without a project_id header like the real API does.
+func (m *MockBlockfrost) handle(mux *http.ServeMux, pattern string, h http.HandlerFunc) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requests[pattern]++
+		m.mu.Unlock()
+
+		if r.Header.Get("project_id") == "" {
+			writeError(w, http.StatusForbidden, "Missing project token. Please include project_id in your request.")
+			return
+		}
+		h(w, r)
+	})
+}
+
+// serveJSON returns a handler writing v, encoded once up front.
+func (m *MockBlockfrost) serveJSON(v any) http.HandlerFunc {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+func (m *MockBlockfrost) addressUtxos(w http.ResponseWriter, r *http.Request) {
+	utxos, ok := m.ledger.utxos[r.PathValue("address")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "The requested component has not been found.")
+		return
+	}
+
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid page.")
+			return
+		}
+		page = n
+	}
+	start := min((page-1)*blockfrostPageSize, len(utxos))
+	end := min(start+blockfrostPageSize, len(utxos))
+	writeJSON(w, http.StatusOK, utxos[start:end])
+}
+
+func (m *MockBlockfrost) txUtxos(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	outputs, ok := m.ledger.txs[hash]
+	if !ok {
+		writeError(w, http.StatusNotFound, "The requested component has not been found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, Base.TxUtxos{TxHash: hash, Inputs: []Base.Input{}, Outputs: outputs})
+}
+
+func (m *MockBlockfrost) submit(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var tx Transaction.Transaction
+	if err := cbor.Unmarshal(body, &tx); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid transaction CBOR: "+err.Error())
+		return
+	}
+	hash, err := tx.TransactionBody.Hash()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	m.submitted.Add(1)
+	writeJSON(w, http.StatusOK, hex.EncodeToString(hash))
+}
+
+// evaluate accepts hex encoded transactions and reports no redeemers, which
+// is what Ogmios answers for transactions without scripts.
+func (m *MockBlockfrost) evaluate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := hex.DecodeString(string(body)); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid transaction hex.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"type":   "jsonwsp/response",
+		"result": map[string]any{"EvaluationResult": map[string]any{}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"status_code": status,
+		"error":       http.StatusText(status),
+		"message":     message,
+	})
+}
@@ -0,0 +1,311 @@
+package backend
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Asset"
+	"github.com/Salvionied/apollo/serialization/AssetName"
+	"github.com/Salvionied/apollo/serialization/MultiAsset"
+	"github.com/Salvionied/apollo/serialization/Policy"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/TransactionInput"
+	"github.com/Salvionied/apollo/serialization/TransactionOutput"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/serialization/Value"
+	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
+	"github.com/Salvionied/apollo/txBuilding/Backend/BlockFrostChainContext"
+	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+	"github.com/Salvionied/cbor/v2"
+)
+
+const (
+	testAddress   = "addr_test1qrp4wsrz6vsjjkhja7j60tyfvnhzf7v97asw29r56kd7pw5rrml46886jg3mwuaq9svtznns6p53gxx7ut9y6pv9e9rsukn05x"
+	testProjectID = "previewtest"
+	testPolicy    = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+)
+
+// testMock serves a ledger of n UTxOs at testAddress, one per transaction,
+// the first of which also holds a token.
+func testMock(t *testing.T, n int) (*MockBlockfrost, []UTxO.UTxO) {
+	t.Helper()
+	addr, err := Address.DecodeAddress(testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxos := make([]UTxO.UTxO, n)
+	for i := range utxos {
+		value := Value.PureLovelaceValue(int64(1_000_000 * (i + 1)))
+		if i == 0 {
+			value = Value.SimpleValue(1_000_000, MultiAsset.MultiAsset[int64]{
+				Policy.PolicyId{Value: testPolicy}: Asset.Asset[int64]{AssetName.NewAssetNameFromString("token"): 5},
+			})
+		}
+		utxos[i] = UTxO.UTxO{
+			Input:  TransactionInput.TransactionInput{TransactionId: testTxHash(i), Index: 0},
+			Output: TransactionOutput.SimpleTransactionOutput(addr, value),
+		}
+	}
+
+	fixed := FixedChainContext.InitFixedChainContext()
+	ledger := NewLedger(fixed.ProtocolParams, fixed.GenesisParams)
+	ledger.AddUTxOs(utxos...)
+	m := NewMockBlockfrost(ledger)
+	t.Cleanup(m.Close)
+	return m, utxos
+}
+
+func testTxHash(i int) []byte {
+	hash := make([]byte, 32)
+	copy(hash, fmt.Sprintf("tx%d", i))
+	return hash
+}
+
+// do sends a request to the mock, with a project_id unless projectID is
+// empty, and returns the response status and body.
+func do(t *testing.T, m *MockBlockfrost, method, path, projectID, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, m.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projectID != "" {
+		req.Header.Set("project_id", projectID)
+	}
+	res, err := m.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, raw
+}
+
+func TestMockBlockfrostRequiresProjectID(t *testing.T) {
+	m, _ := testMock(t, 1)
+	status, body := do(t, m, "GET", "/v0/epochs/latest", "", "")
+	if status != http.StatusForbidden || !strings.Contains(string(body), "project_id") {
+		t.Errorf("request without project_id = %d %s, want %d", status, body, http.StatusForbidden)
+	}
+	// Rejected requests are counted too.
+	if n := m.Requests()["GET /v0/epochs/latest"]; n != 1 {
+		t.Errorf("counted %d requests, want 1", n)
+	}
+	if status, _ := do(t, m, "GET", "/v0/epochs/latest", testProjectID, ""); status != http.StatusOK {
+		t.Errorf("request with project_id = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestMockBlockfrostChainParams(t *testing.T) {
+	m, _ := testMock(t, 1)
+	tests := []struct {
+		name string
+		path string
+		want any
+		got  any
+	}{
+		{"epoch", "/v0/epochs/latest", m.ledger.Epoch, &Base.Epoch{}},
+		{"protocol params", "/v0/epochs/latest/parameters", m.ledger.ProtocolParams, &Base.ProtocolParameters{}},
+		// Apollo requests /Genesis, the Blockfrost API documents /genesis.
+		{"genesis as requested by Apollo", "/v0/Genesis", m.ledger.GenesisParams, &Base.GenesisParameters{}},
+		{"genesis as documented", "/v0/genesis", m.ledger.GenesisParams, &Base.GenesisParameters{}},
+		{"tip", "/v0/blocks/latest", m.ledger.Tip, &Base.Block{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, m, "GET", tt.path, testProjectID, "")
+			if status != http.StatusOK {
+				t.Fatalf("GET %s = %d %s", tt.path, status, body)
+			}
+			if err := json.Unmarshal(body, tt.got); err != nil {
+				t.Fatalf("decode %s: %v", tt.path, err)
+			}
+			want, _ := json.Marshal(tt.want)
+			got, _ := json.Marshal(tt.got)
+			if string(got) != string(want) {
+				t.Errorf("GET %s = %s, want %s", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestMockBlockfrostAddressUtxosPaging(t *testing.T) {
+	m, _ := testMock(t, 2*blockfrostPageSize+50)
+	path := "/v0/addresses/" + testAddress + "/utxos"
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		items  int
+	}{
+		{"first page by default", "", http.StatusOK, blockfrostPageSize},
+		{"first page", "?page=1", http.StatusOK, blockfrostPageSize},
+		{"last full page", "?page=2", http.StatusOK, blockfrostPageSize},
+		{"partial page", "?page=3", http.StatusOK, 50},
+		{"past the end", "?page=4", http.StatusOK, 0},
+		{"page zero", "?page=0", http.StatusBadRequest, 0},
+		{"invalid page", "?page=next", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, m, "GET", path+tt.query, testProjectID, "")
+			if status != tt.status {
+				t.Fatalf("GET %s = %d %s, want %d", tt.query, status, body, tt.status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			var utxos []Base.AddressUTXO
+			if err := json.Unmarshal(body, &utxos); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			// An empty page must be an empty list, it ends Apollo's paging.
+			if len(utxos) != tt.items || utxos == nil {
+				t.Errorf("page has %d UTxOs, want %d", len(utxos), tt.items)
+			}
+		})
+	}
+
+	status, _ := do(t, m, "GET", "/v0/addresses/addr_test1unknown/utxos", testProjectID, "")
+	if status != http.StatusNotFound {
+		t.Errorf("unknown address = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestMockBlockfrostAmounts(t *testing.T) {
+	m, _ := testMock(t, 1)
+	_, body := do(t, m, "GET", "/v0/addresses/"+testAddress+"/utxos", testProjectID, "")
+	var utxos []Base.AddressUTXO
+	if err := json.Unmarshal(body, &utxos); err != nil {
+		t.Fatal(err)
+	}
+	want := []Base.AddressAmount{
+		{Unit: "lovelace", Quantity: "1000000"},
+		{Unit: testPolicy + hex.EncodeToString([]byte("token")), Quantity: "5"},
+	}
+	if len(utxos) != 1 || fmt.Sprint(utxos[0].Amount) != fmt.Sprint(want) {
+		t.Errorf("UTxOs = %+v, want one with amount %v", utxos, want)
+	}
+}
+
+func TestMockBlockfrostTxUtxos(t *testing.T) {
+	m, _ := testMock(t, 2)
+	hash := hex.EncodeToString(testTxHash(1))
+	status, body := do(t, m, "GET", "/v0/txs/"+hash+"/utxos", testProjectID, "")
+	if status != http.StatusOK {
+		t.Fatalf("GET tx utxos = %d %s", status, body)
+	}
+	var tx Base.TxUtxos
+	if err := json.Unmarshal(body, &tx); err != nil {
+		t.Fatal(err)
+	}
+	if tx.TxHash != hash || len(tx.Outputs) != 1 || tx.Outputs[0].Address != testAddress || tx.Outputs[0].Amount[0].Quantity != "2000000" {
+		t.Errorf("tx utxos = %+v, want the 2 ADA output of %s", tx, hash)
+	}
+
+	status, _ = do(t, m, "GET", "/v0/txs/"+strings.Repeat("00", 32)+"/utxos", testProjectID, "")
+	if status != http.StatusNotFound {
+		t.Errorf("unknown transaction = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestMockBlockfrostScriptCbor(t *testing.T) {
+	m, _ := testMock(t, 1)
+	status, _ := do(t, m, "GET", "/v0/scripts/"+testPolicy+"/cbor", testProjectID, "")
+	if status != http.StatusNotFound {
+		t.Errorf("script cbor = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestMockBlockfrostSubmit(t *testing.T) {
+	m, _ := testMock(t, 1)
+	txBytes, err := cbor.Marshal(Transaction.Transaction{Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body := do(t, m, "POST", "/v0/tx/submit", testProjectID, string(txBytes))
+	if status != http.StatusOK {
+		t.Fatalf("submit = %d %s", status, body)
+	}
+	var hash string
+	if err := json.Unmarshal(body, &hash); err != nil || len(hash) != 64 {
+		t.Errorf("submit returned %s, want a transaction hash", body)
+	}
+
+	status, _ = do(t, m, "POST", "/v0/tx/submit", testProjectID, "not a transaction")
+	if status != http.StatusBadRequest {
+		t.Errorf("submitting garbage = %d, want %d", status, http.StatusBadRequest)
+	}
+	if n := m.Submitted(); n != 1 {
+		t.Errorf("Submitted() = %d, want 1", n)
+	}
+}
+
+func TestMockBlockfrostEvaluate(t *testing.T) {
+	m, _ := testMock(t, 1)
+	status, body := do(t, m, "POST", "/v0/utils/txs/evaluate", testProjectID, "84a0a0f5f6")
+	if status != http.StatusOK || !strings.Contains(string(body), `"EvaluationResult":{}`) {
+		t.Errorf("evaluate = %d %s, want an empty evaluation result", status, body)
+	}
+	status, _ = do(t, m, "POST", "/v0/utils/txs/evaluate", testProjectID, "not hex")
+	if status != http.StatusBadRequest {
+		t.Errorf("evaluating garbage = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+// TestMockBlockfrostChainContext drives the mock through Apollo's client,
+// making the calls of the blockfrost-mock scenario.
+func TestMockBlockfrostChainContext(t *testing.T) {
+	m, utxos := testMock(t, blockfrostPageSize+1)
+	addr, _ := Address.DecodeAddress(testAddress)
+
+	bfc, err := BlockFrostChainContext.NewBlockfrostChainContext(m.URL, int(addr.Network), testProjectID)
+	if err != nil {
+		t.Fatalf("create chain context: %v", err)
+	}
+	got, err := bfc.Utxos(addr)
+	if err != nil {
+		t.Fatalf("fetch utxos: %v", err)
+	}
+	if len(got) != len(utxos) {
+		t.Fatalf("fetched %d UTxOs, want %d", len(got), len(utxos))
+	}
+	if !got[0].Output.GetAmount().Equal(utxos[0].Output.GetAmount()) {
+		t.Errorf("first UTxO holds %v, want %v", got[0].Output.GetAmount(), utxos[0].Output.GetAmount())
+	}
+	slot, err := bfc.LastBlockSlot()
+	if err != nil || slot != m.ledger.Tip.Slot {
+		t.Errorf("LastBlockSlot() = %d, %v, want %d", slot, err, m.ledger.Tip.Slot)
+	}
+	ref, err := bfc.GetUtxoFromRef(hex.EncodeToString(testTxHash(1)), 0)
+	if err != nil || ref.Output.GetAmount().GetCoin() != 2_000_000 {
+		t.Errorf("GetUtxoFromRef() = %v, %v, want the 2 ADA UTxO", ref, err)
+	}
+	if _, err := bfc.EvaluateTx([]byte{0x84}); err != nil {
+		t.Errorf("EvaluateTx: %v", err)
+	}
+	if _, err := bfc.SubmitTx(Transaction.Transaction{Valid: true}); err != nil {
+		t.Errorf("SubmitTx: %v", err)
+	}
+
+	// Three paged requests fetch the UTxOs, the last one empty.
+	requests := m.Requests()
+	if n := requests["GET /v0/addresses/{address}/utxos"]; n != 3 {
+		t.Errorf("fetching UTxOs took %d requests, want 3", n)
+	}
+	if n := requests["GET /v0/Genesis"]; n != 1 {
+		t.Errorf("Apollo fetched /v0/Genesis %d times, want 1", n)
+	}
+	if m.Submitted() != 1 {
+		t.Errorf("Submitted() = %d, want 1", m.Submitted())
+	}
+}
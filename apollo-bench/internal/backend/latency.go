@@ -0,0 +1,408 @@
+// Package backend provides chain contexts that behave like remote backends
+// without needing a real one.
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Salvionied/apollo/serialization"
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Redeemer"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
+)
+
+// ErrInjected is wrapped by every error a LatencyContext injects.
+var ErrInjected = errors.New("injected backend error")
+
+// methods are the Base.ChainContext methods latency can be configured for.
+var methods = []string{
+	"GetProtocolParams",
+	"GetGenesisParams",
+	"Network",
+	"Epoch",
+	"MaxTxFee",
+	"LastBlockSlot",
+	"Utxos",
+	"SubmitTx",
+	"EvaluateTx",
+	"GetUtxoFromRef",
+	"GetContractCbor",
+}
+
+// Distribution draws a single round-trip delay.
+type Distribution interface {
+	Sample() time.Duration
+	String() string
+}
+
+// Constant always returns the same delay.
+type Constant time.Duration
+
+func (d Constant) Sample() time.Duration { return time.Duration(d) }
+func (d Constant) String() string        { return time.Duration(d).String() }
+
+// Uniform returns delays evenly spread over [Min, Max].
+type Uniform struct{ Min, Max time.Duration }
+
+func (d Uniform) Sample() time.Duration {
+	return d.Min + time.Duration(rand.Int64N(int64(d.Max-d.Min)+1))
+}
+func (d Uniform) String() string { return d.Min.String() + ".." + d.Max.String() }
+
+// Normal returns normally distributed delays, clamped at zero.
+type Normal struct{ Mean, StdDev time.Duration }
+
+func (d Normal) Sample() time.Duration {
+	return max(0, d.Mean+time.Duration(rand.NormFloat64()*float64(d.StdDev)))
+}
+func (d Normal) String() string { return d.Mean.String() + "~" + d.StdDev.String() }
+
+// Exponential returns exponentially distributed delays with the given mean,
+// which gives the long tail typical of loaded HTTP backends.
+type Exponential struct{ Mean time.Duration }
+
+func (d Exponential) Sample() time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(d.Mean))
+}
+func (d Exponential) String() string { return "exp:" + d.Mean.String() }
+
+// Latency describes how one chain context method responds.
+type Latency struct {
+	Delay Distribution
+	// Jitter is added uniformly in [-Jitter, +Jitter] on top of Delay.
+	Jitter time.Duration
+	// ErrorRate is the fraction of calls, in [0, 1], that fail with
+	// ErrInjected after the delay.
+	ErrorRate float64
+}
+
+func (l Latency) String() string {
+	s := "0s"
+	if l.Delay != nil {
+		s = l.Delay.String()
+	}
+	if l.Jitter > 0 {
+		s += "+" + l.Jitter.String()
+	}
+	if l.ErrorRate > 0 {
+		s += "@" + strconv.FormatFloat(l.ErrorRate*100, 'g', -1, 64) + "%"
+	}
+	return s
+}
+
+func (l Latency) sample() time.Duration {
+	var d time.Duration
+	if l.Delay != nil {
+		d = l.Delay.Sample()
+	}
+	if l.Jitter > 0 {
+		d += time.Duration(rand.Int64N(2*int64(l.Jitter)+1)) - l.Jitter
+	}
+	return max(0, d)
+}
+
+// Profile maps chain context methods to their latency. Methods without an
+// entry use Default.
+type Profile struct {
+	Default Latency
+	Methods map[string]Latency
+}
+
+func (p Profile) latency(method string) Latency {
+	if l, ok := p.Methods[method]; ok {
+		return l
+	}
+	return p.Default
+}
+
+func (p Profile) String() string {
+	parts := []string{"*=" + p.Default.String()}
+	names := make([]string, 0, len(p.Methods))
+	for name := range p.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+"="+p.Methods[name].String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseProfile parses a comma separated list of method=latency entries, e.g.
+//
+//	*=2ms,GetProtocolParams=40ms~10ms+5ms@1%
+//
+// The method is a Base.ChainContext method name, matched case-insensitively,
+// or * for every method without its own entry. A bare latency applies to all
+// methods. A latency is a delay distribution
+//
+//	30ms         constant
+//	10ms..50ms   uniform
+//	30ms~5ms     normal, mean~stddev
+//	exp:30ms     exponential with the given mean
+//
+// optionally followed by +jitter and @error-rate, where the error rate is a
+// percentage ("1%") or a fraction ("0.01").
+func ParseProfile(spec string) (Profile, error) {
+	p := Profile{Methods: make(map[string]Latency)}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		method, value, found := strings.Cut(entry, "=")
+		if !found {
+			method, value = "*", entry
+		}
+		l, err := parseLatency(strings.TrimSpace(value))
+		if err != nil {
+			return Profile{}, fmt.Errorf("backend latency %q: %w", entry, err)
+		}
+		method = strings.TrimSpace(method)
+		if method == "*" {
+			p.Default = l
+			continue
+		}
+		name, ok := canonicalMethod(method)
+		if !ok {
+			return Profile{}, fmt.Errorf("backend latency %q: unknown chain context method %q", entry, method)
+		}
+		p.Methods[name] = l
+	}
+	return p, nil
+}
+
+func canonicalMethod(name string) (string, bool) {
+	for _, m := range methods {
+		if strings.EqualFold(m, name) {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+func parseLatency(s string) (Latency, error) {
+	var (
+		l   Latency
+		err error
+	)
+	if dist, rate, found := strings.Cut(s, "@"); found {
+		if l.ErrorRate, err = parseRate(rate); err != nil {
+			return l, err
+		}
+		s = dist
+	}
+	if dist, jitter, found := strings.Cut(s, "+"); found {
+		if l.Jitter, err = parseDuration(jitter); err != nil {
+			return l, err
+		}
+		s = dist
+	}
+	l.Delay, err = parseDistribution(s)
+	return l, err
+}
+
+func parseDistribution(s string) (Distribution, error) {
+	if mean, found := strings.CutPrefix(s, "exp:"); found {
+		d, err := parseDuration(mean)
+		return Exponential{Mean: d}, err
+	}
+	if lo, hi, found := strings.Cut(s, ".."); found {
+		minD, err := parseDuration(lo)
+		if err != nil {
+			return nil, err
+		}
+		maxD, err := parseDuration(hi)
+		if err != nil {
+			return nil, err
+		}
+		if maxD < minD {
+			return nil, fmt.Errorf("uniform range %s is empty", s)
+		}
+		return Uniform{Min: minD, Max: maxD}, nil
+	}
+	if mean, stddev, found := strings.Cut(s, "~"); found {
+		m, err := parseDuration(mean)
+		if err != nil {
+			return nil, err
+		}
+		sd, err := parseDuration(stddev)
+		return Normal{Mean: m, StdDev: sd}, err
+	}
+	d, err := parseDuration(s)
+	return Constant(d), err
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", s)
+	}
+	return d, nil
+}
+
+func parseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	pct, isPct := strings.CutSuffix(s, "%")
+	v, err := strconv.ParseFloat(pct, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid error rate %q", s)
+	}
+	if isPct {
+		v /= 100
+	}
+	if v < 0 || v > 1 {
+		return 0, fmt.Errorf("error rate %q out of range", s)
+	}
+	return v, nil
+}
+
+// Stats summarizes the calls a LatencyContext has served.
+type Stats struct {
+	Calls  int64
+	Errors int64
+	Delay  time.Duration
+}
+
+// LatencyContext wraps a chain context and delays every call, and fails a
+// share of them, as configured by its Profile. It is safe for concurrent use.
+type LatencyContext struct {
+	inner   Base.ChainContext
+	profile Profile
+
+	calls  atomic.Int64
+	errors atomic.Int64
+	delay  atomic.Int64
+}
+
+func NewLatencyContext(inner Base.ChainContext, profile Profile) *LatencyContext {
+	return &LatencyContext{inner: inner, profile: profile}
+}
+
+// Stats returns the calls served since creation or the last ResetStats.
+func (c *LatencyContext) Stats() Stats {
+	return Stats{
+		Calls:  c.calls.Load(),
+		Errors: c.errors.Load(),
+		Delay:  time.Duration(c.delay.Load()),
+	}
+}
+
+// ResetStats clears the call counters, e.g. after a warm-up phase.
+func (c *LatencyContext) ResetStats() {
+	c.calls.Store(0)
+	c.errors.Store(0)
+	c.delay.Store(0)
+}
+
+// wait sleeps for one sample of the method's latency and returns it.
+func (c *LatencyContext) wait(method string) Latency {
+	l := c.profile.latency(method)
+	d := l.sample()
+	time.Sleep(d)
+	c.calls.Add(1)
+	c.delay.Add(int64(d))
+	return l
+}
+
+// roundTrip waits like wait and returns an injected error for the
+// configured share of calls.
+func (c *LatencyContext) roundTrip(method string) error {
+	l := c.wait(method)
+	if l.ErrorRate > 0 && rand.Float64() < l.ErrorRate {
+		c.errors.Add(1)
+		return fmt.Errorf("%s: %w", method, ErrInjected)
+	}
+	return nil
+}
+
+func (c *LatencyContext) GetProtocolParams() (Base.ProtocolParameters, error) {
+	if err := c.roundTrip("GetProtocolParams"); err != nil {
+		return Base.ProtocolParameters{}, err
+	}
+	return c.inner.GetProtocolParams()
+}
+
+func (c *LatencyContext) GetGenesisParams() (Base.GenesisParameters, error) {
+	if err := c.roundTrip("GetGenesisParams"); err != nil {
+		return Base.GenesisParameters{}, err
+	}
+	return c.inner.GetGenesisParams()
+}
+
+// Network is delayed like every other call but never fails, its signature
+// has no way to report an error.
+func (c *LatencyContext) Network() int {
+	c.wait("Network")
+	return c.inner.Network()
+}
+
+func (c *LatencyContext) Epoch() (int, error) {
+	if err := c.roundTrip("Epoch"); err != nil {
+		return 0, err
+	}
+	return c.inner.Epoch()
+}
+
+func (c *LatencyContext) MaxTxFee() (int, error) {
+	if err := c.roundTrip("MaxTxFee"); err != nil {
+		return 0, err
+	}
+	return c.inner.MaxTxFee()
+}
+
+func (c *LatencyContext) LastBlockSlot() (int, error) {
+	if err := c.roundTrip("LastBlockSlot"); err != nil {
+		return 0, err
+	}
+	return c.inner.LastBlockSlot()
+}
+
+func (c *LatencyContext) Utxos(address Address.Address) ([]UTxO.UTxO, error) {
+	if err := c.roundTrip("Utxos"); err != nil {
+		return nil, err
+	}
+	return c.inner.Utxos(address)
+}
+
+func (c *LatencyContext) SubmitTx(tx Transaction.Transaction) (serialization.TransactionId, error) {
+	if err := c.roundTrip("SubmitTx"); err != nil {
+		return serialization.TransactionId{}, err
+	}
+	return c.inner.SubmitTx(tx)
+}
+
+func (c *LatencyContext) EvaluateTx(tx []uint8) (map[string]Redeemer.ExecutionUnits, error) {
+	if err := c.roundTrip("EvaluateTx"); err != nil {
+		return nil, err
+	}
+	return c.inner.EvaluateTx(tx)
+}
+
+func (c *LatencyContext) GetUtxoFromRef(txHash string, txIndex int) (*UTxO.UTxO, error) {
+	if err := c.roundTrip("GetUtxoFromRef"); err != nil {
+		return nil, err
+	}
+	return c.inner.GetUtxoFromRef(txHash, txIndex)
+}
+
+func (c *LatencyContext) GetContractCbor(scriptHash string) (string, error) {
+	if err := c.roundTrip("GetContractCbor"); err != nil {
+		return "", err
+	}
+	return c.inner.GetContractCbor(scriptHash)
+}
+
+var _ Base.ChainContext = (*LatencyContext)(nil)
@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
+)
+
+func TestParseProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want Profile
+	}{
+		{"empty", "", Profile{}},
+		{"bare constant", "30ms", Profile{Default: Latency{Delay: Constant(30 * time.Millisecond)}}},
+		{"default", "*=2ms", Profile{Default: Latency{Delay: Constant(2 * time.Millisecond)}}},
+		{"uniform", "10ms..50ms", Profile{Default: Latency{Delay: Uniform{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond}}}},
+		{"normal", "30ms~5ms", Profile{Default: Latency{Delay: Normal{Mean: 30 * time.Millisecond, StdDev: 5 * time.Millisecond}}}},
+		{"exponential", "exp:30ms", Profile{Default: Latency{Delay: Exponential{Mean: 30 * time.Millisecond}}}},
+		{"jitter", "30ms+5ms", Profile{Default: Latency{Delay: Constant(30 * time.Millisecond), Jitter: 5 * time.Millisecond}}},
+		{"error percentage", "30ms@1%", Profile{Default: Latency{Delay: Constant(30 * time.Millisecond), ErrorRate: 0.01}}},
+		{"error fraction", "30ms@0.25", Profile{Default: Latency{Delay: Constant(30 * time.Millisecond), ErrorRate: 0.25}}},
+		{"all parts", "40ms~10ms+5ms@1%", Profile{Default: Latency{
+			Delay:     Normal{Mean: 40 * time.Millisecond, StdDev: 10 * time.Millisecond},
+			Jitter:    5 * time.Millisecond,
+			ErrorRate: 0.01,
+		}}},
+		{"method override", "*=2ms, getprotocolparams = exp:40ms", Profile{
+			Default: Latency{Delay: Constant(2 * time.Millisecond)},
+			Methods: map[string]Latency{"GetProtocolParams": {Delay: Exponential{Mean: 40 * time.Millisecond}}},
+		}},
+		{"later entry wins", "Utxos=1ms,Utxos=2ms", Profile{
+			Methods: map[string]Latency{"Utxos": {Delay: Constant(2 * time.Millisecond)}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProfile(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseProfile(%q): %v", tt.spec, err)
+			}
+			if tt.want.Methods == nil {
+				tt.want.Methods = map[string]Latency{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseProfile(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProfileInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"unknown method", "GetEverything=30ms"},
+		{"no duration", "*="},
+		{"bad duration", "30"},
+		{"negative duration", "-30ms"},
+		{"empty uniform range", "50ms..10ms"},
+		{"bad uniform bound", "10ms..fast"},
+		{"bad normal stddev", "30ms~wide"},
+		{"bad exponential mean", "exp:slow"},
+		{"bad jitter", "30ms+some"},
+		{"negative jitter", "30ms+-5ms"},
+		{"bad error rate", "30ms@often"},
+		{"error rate above one", "30ms@150%"},
+		{"negative error rate", "30ms@-0.1"},
+		{"one bad entry", "*=2ms,Utxos=fast"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p, err := ParseProfile(tt.spec); err == nil {
+				t.Errorf("ParseProfile(%q) = %v, want an error", tt.spec, p)
+			}
+		})
+	}
+}
+
+// countingContext answers Epoch and Utxos and counts the calls reaching it.
+// Its other methods are not called by the tests.
+type countingContext struct {
+	Base.ChainContext
+	calls int
+}
+
+func (c *countingContext) Epoch() (int, error) {
+	c.calls++
+	return 42, nil
+}
+
+func (c *countingContext) Utxos(Address.Address) ([]UTxO.UTxO, error) {
+	c.calls++
+	return make([]UTxO.UTxO, 3), nil
+}
+
+func TestLatencyContextDelegates(t *testing.T) {
+	inner := &countingContext{}
+	delay := 2 * time.Millisecond
+	ctx := NewLatencyContext(inner, Profile{Methods: map[string]Latency{"Utxos": {Delay: Constant(delay)}}})
+
+	if epoch, err := ctx.Epoch(); epoch != 42 || err != nil {
+		t.Errorf("Epoch() = %d, %v, want 42, nil", epoch, err)
+	}
+	start := time.Now()
+	utxos, err := ctx.Utxos(Address.Address{})
+	if len(utxos) != 3 || err != nil {
+		t.Errorf("Utxos() = %d UTxOs, %v, want 3, nil", len(utxos), err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Utxos() took %v, want at least %v", elapsed, delay)
+	}
+	if inner.calls != 2 {
+		t.Errorf("inner context got %d calls, want 2", inner.calls)
+	}
+	if stats := ctx.Stats(); stats.Calls != 2 || stats.Errors != 0 || stats.Delay != delay {
+		t.Errorf("Stats() = %+v, want 2 calls, no errors, %v delay", stats, delay)
+	}
+
+	ctx.ResetStats()
+	if stats := ctx.Stats(); stats != (Stats{}) {
+		t.Errorf("Stats() after reset = %+v, want zero", stats)
+	}
+}
+
+func TestLatencyContextInjectsErrors(t *testing.T) {
+	const calls = 2000
+	tests := []struct {
+		name     string
+		rate     float64
+		min, max int
+	}{
+		{"never", 0, 0, 0},
+		{"half", 0.5, calls * 4 / 10, calls * 6 / 10},
+		{"always", 1, calls, calls},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &countingContext{}
+			ctx := NewLatencyContext(inner, Profile{Default: Latency{ErrorRate: tt.rate}})
+			failed := 0
+			for range calls {
+				if _, err := ctx.Epoch(); err != nil {
+					if !errors.Is(err, ErrInjected) {
+						t.Fatalf("Epoch() = %v, want %v", err, ErrInjected)
+					}
+					failed++
+				}
+			}
+			if failed < tt.min || failed > tt.max {
+				t.Errorf("%d of %d calls failed, want %d to %d", failed, calls, tt.min, tt.max)
+			}
+			// Failed calls never reach the inner context.
+			if inner.calls != calls-failed {
+				t.Errorf("inner context got %d calls, want %d", inner.calls, calls-failed)
+			}
+			if stats := ctx.Stats(); stats.Calls != calls || stats.Errors != int64(failed) {
+				t.Errorf("Stats() = %+v, want %d calls, %d errors", stats, calls, failed)
+			}
+		})
+	}
+}
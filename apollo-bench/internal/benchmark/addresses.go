@@ -0,0 +1,435 @@
+package benchmark
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Salvionied/apollo/constants"
+	"github.com/Salvionied/apollo/serialization"
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/TransactionOutput"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+)
+
+// Address types UTxOs can be spread over, see ParseAddressMix.
+const (
+	// AddressBase is a key payment credential with a key stake credential.
+	AddressBase = "base"
+	// AddressEnterprise is a key payment credential without stake rights.
+	AddressEnterprise = "enterprise"
+	// AddressScript is a script payment credential with a key stake
+	// credential.
+	AddressScript = "script"
+	// AddressPointer is a key payment credential whose stake rights are a
+	// pointer to a stake registration certificate.
+	AddressPointer = "pointer"
+)
+
+// addressTypes lists the mixable types in report order.
+var addressTypes = []string{AddressBase, AddressEnterprise, AddressScript, AddressPointer}
+
+const (
+	// addressProbeIterations is the number of builds measured per address
+	// type when probing a mix.
+	addressProbeIterations = 100
+	// addressProbeWarmup builds are discarded before each type is measured.
+	addressProbeWarmup = 10
+	// addressSlowdownThreshold is the mean latency, relative to base
+	// addresses, above which an address type is reported as slow.
+	addressSlowdownThreshold = 1.25
+)
+
+// networks maps the names accepted by Config.Network to Apollo networks.
+var networks = map[string]constants.Network{
+	"mainnet": constants.MAINNET,
+	"preprod": constants.PREPROD,
+	"preview": constants.PREVIEW,
+}
+
+// Networks returns the names accepted by Config.Network, sorted.
+func Networks() []string {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseNetwork returns the Apollo network called name.
+func ParseNetwork(name string) (constants.Network, error) {
+	network, ok := networks[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown network %q (available: %s)", name, strings.Join(Networks(), ", "))
+	}
+	return network, nil
+}
+
+// decodeWalletAddress decodes a bech32 address that must be able to hold
+// UTxOs on network.
+func decodeWalletAddress(role, bech32 string, network constants.Network) (Address.Address, error) {
+	if bech32 == "" {
+		return Address.Address{}, fmt.Errorf("%s address is required", role)
+	}
+	addr, err := Address.DecodeAddress(bech32)
+	if err != nil {
+		return Address.Address{}, fmt.Errorf("decode %s address %q: %w", role, bech32, err)
+	}
+	if len(addr.PaymentPart) != serialization.VERIFICATION_KEY_HASH_SIZE {
+		return Address.Address{}, fmt.Errorf("%s address %s is a %s address without a payment credential",
+			role, bech32, AddressTypeName(addr))
+	}
+	// Address headers only tell mainnet (1) from any testnet (0).
+	if isMainnet := network == constants.MAINNET; isMainnet != (addr.Network == 1) {
+		return Address.Address{}, fmt.Errorf("%s address %s does not belong to network %s", role, bech32, networkName(network))
+	}
+	return addr, nil
+}
+
+func networkName(network constants.Network) string {
+	for name, n := range networks {
+		if n == network {
+			return name
+		}
+	}
+	return strconv.Itoa(int(network))
+}
+
+// AddressTypeName names the CIP-19 type of addr: the address types of
+// ParseAddressMix, or one of script-stake, script-script, script-pointer,
+// script-enterprise, reward and script-reward.
+func AddressTypeName(addr Address.Address) string {
+	switch addr.AddressType {
+	case Address.KEY_KEY:
+		return AddressBase
+	case Address.SCRIPT_KEY:
+		return AddressScript
+	case Address.KEY_SCRIPT:
+		return "script-stake"
+	case Address.SCRIPT_SCRIPT:
+		return "script-script"
+	case Address.KEY_POINTER:
+		return AddressPointer
+	case Address.SCRIPT_POINTER:
+		return "script-pointer"
+	case Address.KEY_NONE:
+		return AddressEnterprise
+	case Address.SCRIPT_NONE:
+		return "script-enterprise"
+	case Address.NONE_KEY:
+		return "reward"
+	case Address.NONE_SCRIPT:
+		return "script-reward"
+	}
+	return fmt.Sprintf("unknown (%d)", addr.AddressType)
+}
+
+// AddressMix maps address types to their relative weight among the derived
+// wallet addresses.
+type AddressMix map[string]int
+
+// ParseAddressMix parses a comma separated list of type=weight entries, e.g.
+//
+//	base=6,enterprise=2,script=1,pointer=1
+//
+// A type without a weight counts once. An empty spec is a wallet of base
+// addresses only.
+func ParseAddressMix(spec string) (AddressMix, error) {
+	mix := AddressMix{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, weight, found := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isAddressType(name) {
+			return nil, fmt.Errorf("address mix %q: unknown address type %q (available: %s)",
+				entry, name, strings.Join(addressTypes, ", "))
+		}
+		w := 1
+		if found {
+			var err error
+			if w, err = strconv.Atoi(strings.TrimSpace(weight)); err != nil || w < 0 {
+				return nil, fmt.Errorf("address mix %q: invalid weight %q", entry, weight)
+			}
+		}
+		if w > 0 {
+			mix[name] += w
+		}
+	}
+	if len(mix) == 0 {
+		mix[AddressBase] = 1
+	}
+	return mix, nil
+}
+
+func isAddressType(name string) bool {
+	for _, t := range addressTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Types returns the types with a non-zero weight in report order.
+func (m AddressMix) Types() []string {
+	var types []string
+	for _, t := range addressTypes {
+		if m[t] > 0 {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func (m AddressMix) String() string {
+	var parts []string
+	for _, t := range m.Types() {
+		parts = append(parts, t+"="+strconv.Itoa(m[t]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// counts splits n addresses over the types of m in proportion to their
+// weights, giving every type at least one address.
+func (m AddressMix) counts(n int) map[string]int {
+	types := m.Types()
+	total := 0
+	for _, t := range types {
+		total += m[t]
+	}
+
+	counts := make(map[string]int, len(types))
+	remainders := make([]float64, len(types))
+	assigned := 0
+	for i, t := range types {
+		share := float64(n-len(types)) * float64(m[t]) / float64(total)
+		counts[t] = 1 + int(share)
+		remainders[i] = share - float64(int(share))
+		assigned += counts[t]
+	}
+	// Largest remainders get the addresses lost to rounding down.
+	order := make([]int, len(types))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; assigned < n; i++ {
+		counts[types[order[i%len(order)]]]++
+		assigned++
+	}
+	return counts
+}
+
+// WalletAddresses returns n addresses of sender's wallet split over the
+// types of mix. The first base address is sender itself, the others get
+// payment credentials derived from sender's and share its stake credential,
+// like the addresses of one HD wallet account. Derived credentials are hashes,
+// not keys, so the addresses can receive but not sign.
+func WalletAddresses(sender Address.Address, n int, mix AddressMix) ([]Address.Address, error) {
+	if n < len(mix.Types()) {
+		return nil, fmt.Errorf("%d addresses cannot cover the %d address types of %s", n, len(mix.Types()), mix)
+	}
+
+	counts := mix.counts(n)
+	addrs := make([]Address.Address, 0, n)
+	for _, t := range mix.Types() {
+		for i := range counts[t] {
+			if t == AddressBase && i == 0 {
+				addrs = append(addrs, sender)
+				continue
+			}
+			addrs = append(addrs, deriveAddress(sender, t, i))
+		}
+	}
+	return addrs, nil
+}
+
+// deriveAddress returns the index-th address of type t in sender's wallet.
+func deriveAddress(sender Address.Address, t string, index int) Address.Address {
+	seed := sha256.Sum256(fmt.Appendf(nil, "%x/%s/%d", sender.PaymentPart, t, index))
+	payment := seed[:serialization.VERIFICATION_KEY_HASH_SIZE]
+
+	var (
+		addrType uint8
+		staking  []byte
+	)
+	switch t {
+	case AddressBase:
+		addrType, staking = Address.KEY_KEY, sender.StakingPart
+	case AddressEnterprise:
+		addrType, staking = Address.KEY_NONE, []byte{}
+	case AddressScript:
+		addrType, staking = Address.SCRIPT_KEY, sender.StakingPart
+	case AddressPointer:
+		// The pointer of the CIP-19 test vectors.
+		addrType, staking = Address.KEY_POINTER, encodePointer(2498243, 27, 3)
+	}
+	return Address.Address{
+		PaymentPart: payment,
+		StakingPart: staking,
+		Network:     sender.Network,
+		AddressType: addrType,
+		HeaderByte:  addrType<<4 | sender.Network,
+		Hrp:         Address.ComputeHrp(addrType, sender.Network),
+	}
+}
+
+// encodePointer encodes a stake pointer as three variable-length naturals,
+// seven bits per byte with the high bit set on all but the last byte.
+func encodePointer(slot, txIndex, certIndex uint64) []byte {
+	var b []byte
+	for _, n := range []uint64{slot, txIndex, certIndex} {
+		chunk := []byte{byte(n & 0x7f)}
+		for n >>= 7; n > 0; n >>= 7 {
+			chunk = append([]byte{byte(n&0x7f) | 0x80}, chunk...)
+		}
+		b = append(b, chunk...)
+	}
+	return b
+}
+
+// SpreadUtxos returns utxos with their outputs moved round-robin over addrs,
+// keeping their values.
+func SpreadUtxos(utxos []UTxO.UTxO, addrs []Address.Address) []UTxO.UTxO {
+	spread := make([]UTxO.UTxO, len(utxos))
+	for i, u := range utxos {
+		spread[i] = UTxO.UTxO{
+			Input:  u.Input,
+			Output: TransactionOutput.SimpleTransactionOutput(addrs[i%len(addrs)], u.Output.GetAmount()),
+		}
+	}
+	return spread
+}
+
+// AddressTypeResult is the outcome of building from UTxOs held by a single
+// address type.
+type AddressTypeResult struct {
+	Type       string        `json:"type"`
+	Addresses  int           `json:"addresses"`
+	AvgLatency time.Duration `json:"avg_latency"`
+	// Slowdown is AvgLatency relative to base addresses.
+	Slowdown   float64 `json:"slowdown"`
+	Failures   int     `json:"failures"`
+	Iterations int     `json:"iterations"`
+	FirstError string  `json:"first_error,omitempty"`
+	// Degraded is set when builds fail or are slower than base addresses
+	// by more than addressSlowdownThreshold.
+	Degraded bool `json:"degraded"`
+}
+
+// probeAddressTypes builds the transactions of scn sequentially from UTxOs
+// spread over the addresses of one type at a time, so address types that
+// make Complete fail or slow down can be told apart from base addresses.
+// Every type is warmed up before any is measured, and the measured builds
+// rotate through the types so none is measured on a colder process.
+func probeAddressTypes(scn scenario, env *scenarioEnv, mix AddressMix) ([]AddressTypeResult, error) {
+	counts := mix.counts(env.cfg.Addresses)
+	types := mix.Types()
+	if mix[AddressBase] == 0 {
+		types = append([]string{AddressBase}, types...)
+		counts[AddressBase] = 1
+	}
+
+	results := make([]AddressTypeResult, len(types))
+	runs := make([]*scenarioRun, len(types))
+	for i, t := range types {
+		addrs, err := WalletAddresses(env.sender, counts[t], AddressMix{t: 1})
+		if err != nil {
+			return nil, err
+		}
+		results[i] = AddressTypeResult{Type: t, Addresses: len(addrs), Iterations: addressProbeIterations}
+		typeEnv := *env
+		typeEnv.utxos = SpreadUtxos(InitUtxosForLevel(env.cfg.UTxOLevel, env.cfg.UTxOInput), addrs)
+		run, err := prepareSafe(scn, &typeEnv)
+		if err != nil {
+			// The type fails every build of the scenario.
+			results[i].Failures = addressProbeIterations
+			results[i].FirstError = err.Error()
+			continue
+		}
+		if run.close != nil {
+			defer run.close()
+		}
+		runs[i] = run
+	}
+
+	totals := make([]time.Duration, len(types))
+	for i := range addressProbeWarmup + addressProbeIterations {
+		for k := range types {
+			t := (i + k) % len(types)
+			if runs[t] == nil {
+				continue
+			}
+			elapsed, err := buildSafe(runs[t])
+			if i < addressProbeWarmup {
+				continue
+			}
+			res := &results[t]
+			if err != nil {
+				if res.Failures == 0 {
+					res.FirstError = err.Error()
+				}
+				res.Failures++
+				continue
+			}
+			totals[t] += elapsed
+		}
+	}
+	for i := range results {
+		if succeeded := addressProbeIterations - results[i].Failures; succeeded > 0 {
+			results[i].AvgLatency = totals[i] / time.Duration(succeeded)
+		}
+	}
+
+	base := results[0].AvgLatency
+	for i := range results {
+		r := &results[i]
+		if base > 0 && r.AvgLatency > 0 {
+			r.Slowdown = float64(r.AvgLatency) / float64(base)
+		}
+		r.Degraded = r.Failures > 0 || r.Slowdown > addressSlowdownThreshold
+		if r.Degraded {
+			slog.Warn("Address type degrades transaction building",
+				"type", r.Type,
+				"failures", r.Failures,
+				"slowdown", r.Slowdown,
+				"firstError", r.FirstError)
+		}
+	}
+	return results, nil
+}
+
+// prepareSafe prepares scn for env with panics reported as errors,
+// malformed addresses can make Apollo panic.
+func prepareSafe(scn scenario, env *scenarioEnv) (run *scenarioRun, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return scn.prepare(env)
+}
+
+// buildSafe times one build of run with panics reported as errors.
+func buildSafe(run *scenarioRun) (elapsed time.Duration, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	utxos, err := run.inputs(false)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	_, err = run.build(utxos)
+	return time.Since(start), err
+}
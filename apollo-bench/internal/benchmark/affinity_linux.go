@@ -0,0 +1,45 @@
+//go:build linux
+
+package benchmark
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// PinCPUs restricts the current process to the CPUs in list. Every existing
+// thread is pinned; threads the Go runtime starts later inherit the mask.
+// GOMAXPROCS is lowered to the number of pinned CPUs so the scheduler does
+// not run more threads than there are CPUs.
+func PinCPUs(list string) error {
+	cpus, err := ParseCPUList(list)
+	if err != nil {
+		return err
+	}
+
+	var set unix.CPUSet
+	set.Zero()
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return fmt.Errorf("list threads: %w", err)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := unix.SchedSetaffinity(tid, &set); err != nil {
+			return fmt.Errorf("pin thread %d to CPUs %s: %w", tid, list, err)
+		}
+	}
+	runtime.GOMAXPROCS(set.Count())
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package benchmark
+
+import "errors"
+
+// PinCPUs is only implemented on Linux.
+func PinCPUs(list string) error {
+	if _, err := ParseCPUList(list); err != nil {
+		return err
+	}
+	return errors.New("CPU pinning is only supported on Linux")
+}
@@ -0,0 +1,425 @@
+package benchmark
+
+import (
+	"apollo-bench/internal/backend"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
+	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Capacity search strategies.
+const (
+	// CapacitySearchBinary bisects the arrival rate between zero and the
+	// closed-loop throughput.
+	CapacitySearchBinary = "binary"
+	// CapacitySearchStep tries evenly spaced rates up to the closed-loop
+	// throughput, which traces the whole latency curve.
+	CapacitySearchStep = "step"
+)
+
+// CapacityConfig controls a capacity search. The builds themselves are
+// described by the benchmark Config, whose Iterations size the closed-loop
+// probe of every parallelism.
+type CapacityConfig struct {
+	// SLOP99 is the p99 latency, from arrival to built transaction, a rate
+	// must stay under.
+	SLOP99 time.Duration
+	// Parallelism lists the worker counts searched.
+	Parallelism []int
+	// Search is CapacitySearchBinary or CapacitySearchStep.
+	Search string
+	// Steps is the number of rates tried per parallelism after the
+	// closed-loop throughput: bisections or evenly spaced rates.
+	Steps int
+	// StepDuration is how long arrivals are generated at every rate.
+	StepDuration time.Duration
+	// MaxQueue bounds the arrivals waiting for a worker. Arrivals finding
+	// it full are dropped, and a rate dropping any misses the SLO.
+	MaxQueue int
+	// Arrivals is one of ArrivalProcesses, Seed seeds the Poisson gaps.
+	Arrivals string
+	Seed     int64
+	// Cores is the number of CPUs the process may use, e.g. the size of its
+	// CPU affinity list. Zero means GOMAXPROCS.
+	Cores int
+}
+
+// DefaultCapacityConfig returns the settings the capacity command uses when
+// no flags are given.
+func DefaultCapacityConfig() CapacityConfig {
+	return CapacityConfig{
+		SLOP99:       50 * time.Millisecond,
+		Parallelism:  []int{1},
+		Search:       CapacitySearchBinary,
+		Steps:        8,
+		StepDuration: 5 * time.Second,
+		MaxQueue:     10000,
+		Arrivals:     ArrivalsPoisson,
+	}
+}
+
+// Validate reports the first invalid setting in c.
+func (c CapacityConfig) Validate() error {
+	switch {
+	case c.SLOP99 <= 0:
+		return errors.New("p99 SLO must be > 0")
+	case len(c.Parallelism) == 0:
+		return errors.New("at least one parallelism is required")
+	case c.Search != CapacitySearchBinary && c.Search != CapacitySearchStep:
+		return fmt.Errorf("unknown capacity search %q (%s, %s)", c.Search, CapacitySearchBinary, CapacitySearchStep)
+	case c.Steps <= 0:
+		return errors.New("steps must be > 0")
+	case c.StepDuration <= 0:
+		return errors.New("step duration must be > 0")
+	case c.Cores < 0:
+		return errors.New("cores must be >= 0")
+	case c.MaxQueue <= 0:
+		return errors.New("max queue must be > 0")
+	case c.Arrivals != ArrivalsPoisson && c.Arrivals != ArrivalsUniform:
+		return fmt.Errorf("unknown arrival process %q (%s, %s)", c.Arrivals, ArrivalsPoisson, ArrivalsUniform)
+	}
+	for _, p := range c.Parallelism {
+		if p <= 0 {
+			return errors.New("parallelism must be > 0")
+		}
+	}
+	return nil
+}
+
+// CapacityPoint is one open-loop step: the latency and throughput of
+// builds arriving at Rate.
+type CapacityPoint struct {
+	Rate       float64 `json:"rate"`
+	Throughput float64 `json:"throughput"`
+	LatencyPercentiles
+	// AvgService is the mean build time without the time spent queueing.
+	AvgService time.Duration `json:"avg_service"`
+	Arrivals   int           `json:"arrivals"`
+	Dropped    int           `json:"dropped"`
+	Failures   int           `json:"failures"`
+	MeetsSLO   bool          `json:"meets_slo"`
+}
+
+// CapacityLevel is the search result of one parallelism.
+type CapacityLevel struct {
+	Parallelism int `json:"parallelism"`
+	// ClosedLoopTPS is the throughput of builds back to back, the upper
+	// bound of the searched rates.
+	ClosedLoopTPS float64 `json:"closed_loop_tps"`
+	// MaxRate is the highest tried rate meeting the SLO, zero when none did.
+	MaxRate float64 `json:"max_rate"`
+	// Curve holds every tried rate in ascending order.
+	Curve []CapacityPoint `json:"curve"`
+}
+
+// CapacityResult is the outcome of a capacity search.
+type CapacityResult struct {
+	Scenario     string        `json:"scenario"`
+	SLOP99       time.Duration `json:"slo_p99"`
+	Search       string        `json:"search"`
+	Arrivals     string        `json:"arrivals"`
+	StepDuration time.Duration `json:"step_duration"`
+	UTXOInput    int           `json:"utxo_input"`
+	UTXOOutput   int           `json:"utxo_output"`
+	UTxOLevel    int           `json:"utxo_level"`
+	// BackendLatency is the injected chain context latency, if any.
+	BackendLatency string          `json:"backend_latency,omitempty"`
+	Levels         []CapacityLevel `json:"levels"`
+	// MaxRate is the highest rate meeting the SLO over all levels, reached
+	// with Parallelism workers. Cores is the number of CPUs the process
+	// could use and RatePerCore MaxRate divided by it.
+	MaxRate     float64    `json:"max_rate"`
+	Parallelism int        `json:"parallelism"`
+	Cores       int        `json:"cores"`
+	RatePerCore float64    `json:"rate_per_core"`
+	SystemInfo  SystemInfo `json:"system_info"`
+}
+
+// prepareIterate prepares cfg.Scenario against the fixed chain context,
+// wrapped in the backend latency of cfg if any, and returns the function
+// building iteration iter and the function releasing the scenario.
+func prepareIterate(cfg Config) (func(iter int) Result, func(), error) {
+	scn, err := lookupScenario(cfg.Scenario)
+	if err != nil {
+		return nil, nil, err
+	}
+	var chainCtx Base.ChainContext = FixedChainContext.InitFixedChainContext()
+	if cfg.BackendLatency != "" {
+		profile, err := backend.ParseProfile(cfg.BackendLatency)
+		if err != nil {
+			return nil, nil, err
+		}
+		chainCtx = backend.NewLatencyContext(chainCtx, profile)
+	}
+	env, _, _, err := newScenarioEnv(cfg, chainCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	run, err := scn.prepare(env)
+	if err != nil {
+		return nil, nil, fmt.Errorf("prepare %s scenario: %w", cfg.Scenario, err)
+	}
+	closeRun := func() {
+		if run.close != nil {
+			run.close()
+		}
+	}
+	return iterateRun(run, cfg.DeepClone), closeRun, nil
+}
+
+// ExecuteCapacity searches, for every parallelism of capCfg, the highest
+// open-loop arrival rate whose p99 latency meets the SLO, and returns the
+// latency curve of every rate tried.
+func ExecuteCapacity(ctx context.Context, cfg Config, capCfg CapacityConfig) (*CapacityResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := capCfg.Validate(); err != nil {
+		return nil, err
+	}
+	slog.Info("Starting capacity search",
+		"scenario", cfg.Scenario,
+		"sloP99", capCfg.SLOP99,
+		"parallelism", capCfg.Parallelism,
+		"search", capCfg.Search,
+		"steps", capCfg.Steps,
+		"stepDuration", capCfg.StepDuration,
+		"arrivals", capCfg.Arrivals)
+
+	iterate, closeRun, err := prepareIterate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRun()
+
+	if _, err := runWarmup(ctx, cfg.Warmup, capCfg.Parallelism[0], iterate); err != nil {
+		return nil, err
+	}
+
+	result := &CapacityResult{
+		Scenario:       cfg.Scenario,
+		SLOP99:         capCfg.SLOP99,
+		Search:         capCfg.Search,
+		Arrivals:       capCfg.Arrivals,
+		StepDuration:   capCfg.StepDuration,
+		UTXOInput:      cfg.UTxOInput,
+		UTXOOutput:     cfg.UTxOOutput,
+		UTxOLevel:      cfg.UTxOLevel,
+		BackendLatency: cfg.BackendLatency,
+	}
+	rng := rand.New(rand.NewSource(capCfg.Seed))
+	for _, parallelism := range capCfg.Parallelism {
+		level, err := searchCapacity(ctx, cfg.Iterations, parallelism, capCfg, rng, iterate)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Capacity level finished", "parallelism", parallelism,
+			"closedLoopTPS", level.ClosedLoopTPS, "maxRate", level.MaxRate)
+		result.Levels = append(result.Levels, *level)
+		if level.MaxRate > result.MaxRate {
+			result.MaxRate = level.MaxRate
+			result.Parallelism = parallelism
+		}
+	}
+	result.Cores = capCfg.Cores
+	if result.Cores == 0 {
+		result.Cores = runtime.GOMAXPROCS(0)
+	}
+	result.RatePerCore = result.MaxRate / float64(result.Cores)
+	result.SystemInfo = GetSystemInfo()
+	return result, nil
+}
+
+// searchCapacity measures the closed-loop throughput of parallelism workers
+// with probe builds and searches the open-loop rates below it.
+func searchCapacity(ctx context.Context, probe, parallelism int, capCfg CapacityConfig, rng *rand.Rand, fn func(iter int) Result) (*CapacityLevel, error) {
+	start := time.Now()
+	results := runBatch(ctx, 0, probe, parallelism, fn)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	successes := 0
+	for _, res := range results {
+		if res.Error == nil {
+			successes++
+		}
+	}
+	if successes == 0 {
+		return nil, fmt.Errorf("parallelism %d: %w", parallelism, ErrAllIterationsFailed)
+	}
+	level := &CapacityLevel{
+		Parallelism:   parallelism,
+		ClosedLoopTPS: float64(successes) / time.Since(start).Seconds(),
+	}
+	slog.Info("Closed-loop throughput measured", "parallelism", parallelism, "tps", level.ClosedLoopTPS)
+
+	loop := openLoop{
+		parallelism: parallelism,
+		maxQueue:    capCfg.MaxQueue,
+		arrivals:    capCfg.Arrivals,
+		rng:         rng,
+	}
+	err := searchRates(capCfg, level.ClosedLoopTPS, func(rate float64) (bool, error) {
+		loop.rate = rate
+		point := runCapacityStep(ctx, loop, capCfg, fn)
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		slog.Info("Capacity step finished", "parallelism", parallelism, "rate", rate,
+			"p99", point.P99, "dropped", point.Dropped, "failures", point.Failures, "meetsSLO", point.MeetsSLO)
+		level.Curve = append(level.Curve, point)
+		if point.MeetsSLO && rate > level.MaxRate {
+			level.MaxRate = rate
+		}
+		return point.MeetsSLO, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(level.Curve, func(a, b int) bool { return level.Curve[a].Rate < level.Curve[b].Rate })
+	return level, nil
+}
+
+// searchRates tries the open-loop rates up to maxRate that capCfg.Search
+// selects, try reporting whether a rate meets the SLO.
+func searchRates(capCfg CapacityConfig, maxRate float64, try func(rate float64) (bool, error)) error {
+	switch capCfg.Search {
+	case CapacitySearchStep:
+		for k := 1; k <= capCfg.Steps; k++ {
+			if _, err := try(maxRate * float64(k) / float64(capCfg.Steps)); err != nil {
+				return err
+			}
+		}
+	default:
+		// The SLO is assumed to hold below some rate and fail above it.
+		lo, hi := 0.0, maxRate
+		meets, err := try(hi)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < capCfg.Steps && !meets; i++ {
+			mid := (lo + hi) / 2
+			ok, err := try(mid)
+			if err != nil {
+				return err
+			}
+			if ok {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+	}
+	return nil
+}
+
+// runCapacityStep runs one open-loop step at loop.rate.
+func runCapacityStep(ctx context.Context, loop openLoop, capCfg CapacityConfig, fn func(iter int) Result) CapacityPoint {
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		service   time.Duration
+		failures  int
+		last      time.Time
+	)
+	start := time.Now()
+	arrived, dropped := loop.run(ctx, 0, capCfg.StepDuration, fn, func(res Result, latency time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Failed builds count against the SLO like slow ones.
+		latencies = append(latencies, latency)
+		service += res.Duration
+		if res.Error != nil {
+			failures++
+		}
+		last = time.Now()
+	})
+
+	point := CapacityPoint{
+		Rate:               loop.rate,
+		LatencyPercentiles: percentiles(latencies),
+		Arrivals:           arrived,
+		Dropped:            dropped,
+		Failures:           failures,
+	}
+	if n := len(latencies); n > 0 {
+		point.AvgService = service / time.Duration(n)
+		point.Throughput = float64(n-failures) / last.Sub(start).Seconds()
+	}
+	point.MeetsSLO = len(latencies) > 0 && point.P99 <= capCfg.SLOP99 && dropped == 0 && failures == 0
+	return point
+}
+
+// PrintCapacity writes result in the given format: the latency curves as a
+// table, or the result as JSON.
+func PrintCapacity(result CapacityResult, format string) error {
+	switch format {
+	case "json":
+		return WriteCapacityJSON(os.Stdout, result)
+	default:
+		printCapacityTable(result)
+	}
+	return nil
+}
+
+// WriteCapacityJSON writes result to w as indented JSON.
+func WriteCapacityJSON(w io.Writer, result CapacityResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("encode JSON: %w", err)
+	}
+	return nil
+}
+
+func printCapacityTable(result CapacityResult) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Parallelism", "Rate (tx/s)", "Throughput (tx/s)", "p50", "p90", "p99", "Max", "Avg Service", "Dropped", "Failures", "SLO"})
+	table.SetBorder(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+
+	round := func(d time.Duration) string { return d.Round(time.Microsecond).String() }
+	for _, level := range result.Levels {
+		table.Append([]string{color.HiMagentaString("%d WORKER(S)", level.Parallelism),
+			color.HiMagentaString("closed loop %.2f tx/s", level.ClosedLoopTPS), "", "", "", "", "", "", "", "", ""})
+		for _, p := range level.Curve {
+			slo := color.HiGreenString("met")
+			if !p.MeetsSLO {
+				slo = color.HiRedString("missed")
+			}
+			rate := fmt.Sprintf("%.2f", p.Rate)
+			if p.MeetsSLO && p.Rate == level.MaxRate {
+				rate = color.HiGreenString(rate + " (max)")
+			}
+			table.Append([]string{strconv.Itoa(level.Parallelism), rate, fmt.Sprintf("%.2f", p.Throughput),
+				round(p.P50), round(p.P90), round(p.P99), round(p.Max), round(p.AvgService),
+				strconv.Itoa(p.Dropped), strconv.Itoa(p.Failures), slo})
+		}
+	}
+	table.Render()
+
+	if result.MaxRate == 0 {
+		fmt.Fprintln(os.Stdout, color.HiRedString("No rate met the p99 SLO of %s", result.SLOP99))
+		return
+	}
+	fmt.Fprintln(os.Stdout, color.HiGreenString("Capacity: %.2f tx/s with p99 <= %s at parallelism %d, %.2f tx/s per core over %d core(s)",
+		result.MaxRate, result.SLOP99, result.Parallelism, result.RatePerCore, result.Cores))
+}
@@ -0,0 +1,113 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"testing"
+)
+
+func TestSearchRates(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		steps  int
+		// slo is the highest rate meeting the SLO.
+		slo   float64
+		tried []float64
+	}{
+		{"binary converges", CapacitySearchBinary, 4, 30, []float64{100, 50, 25, 37.5, 31.25}},
+		{"binary meets at closed loop", CapacitySearchBinary, 4, 150, []float64{100}},
+		{"binary never meets", CapacitySearchBinary, 3, 0, []float64{100, 50, 25, 12.5}},
+		{"binary single step", CapacitySearchBinary, 1, 60, []float64{100, 50}},
+		{"step", CapacitySearchStep, 4, 30, []float64{25, 50, 75, 100}},
+		{"step single", CapacitySearchStep, 1, 0, []float64{100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capCfg := DefaultCapacityConfig()
+			capCfg.Search = tt.search
+			capCfg.Steps = tt.steps
+			var tried []float64
+			err := searchRates(capCfg, 100, func(rate float64) (bool, error) {
+				tried = append(tried, rate)
+				return rate <= tt.slo, nil
+			})
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			if len(tried) != len(tt.tried) {
+				t.Fatalf("tried %v, want %v", tried, tt.tried)
+			}
+			for i := range tried {
+				if !approx(tried[i], tt.tried[i]) {
+					t.Fatalf("tried %v, want %v", tried, tt.tried)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchRatesError(t *testing.T) {
+	errStep := errors.New("step failed")
+	for _, search := range []string{CapacitySearchBinary, CapacitySearchStep} {
+		t.Run(search, func(t *testing.T) {
+			capCfg := DefaultCapacityConfig()
+			capCfg.Search = search
+			calls := 0
+			err := searchRates(capCfg, 100, func(rate float64) (bool, error) {
+				calls++
+				if calls == 2 {
+					return false, errStep
+				}
+				return false, nil
+			})
+			if !errors.Is(err, errStep) || calls != 2 {
+				t.Errorf("search returned %v after %d steps, want %v after 2", err, calls, errStep)
+			}
+		})
+	}
+}
+
+func TestSearchCapacityAllFailed(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	fail := func(iter int) Result {
+		return Result{Iteration: iter, Error: errors.New("build failed")}
+	}
+	_, err := searchCapacity(context.Background(), 3, 1, DefaultCapacityConfig(), rand.New(rand.NewSource(1)), fail)
+	if !errors.Is(err, ErrAllIterationsFailed) {
+		t.Errorf("search returned %v, want %v", err, ErrAllIterationsFailed)
+	}
+}
+
+func TestCapacityConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *CapacityConfig)
+		ok     bool
+	}{
+		{"default", func(c *CapacityConfig) {}, true},
+		{"no SLO", func(c *CapacityConfig) { c.SLOP99 = 0 }, false},
+		{"no parallelism", func(c *CapacityConfig) { c.Parallelism = nil }, false},
+		{"zero parallelism", func(c *CapacityConfig) { c.Parallelism = []int{2, 0} }, false},
+		{"unknown search", func(c *CapacityConfig) { c.Search = "linear" }, false},
+		{"no steps", func(c *CapacityConfig) { c.Steps = 0 }, false},
+		{"no step duration", func(c *CapacityConfig) { c.StepDuration = 0 }, false},
+		{"negative cores", func(c *CapacityConfig) { c.Cores = -1 }, false},
+		{"no queue", func(c *CapacityConfig) { c.MaxQueue = 0 }, false},
+		{"unknown arrivals", func(c *CapacityConfig) { c.Arrivals = "bursty" }, false},
+		{"uniform arrivals", func(c *CapacityConfig) { c.Arrivals = ArrivalsUniform }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultCapacityConfig()
+			tt.modify(&c)
+			if err := c.Validate(); (err == nil) != tt.ok {
+				t.Errorf("Validate() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
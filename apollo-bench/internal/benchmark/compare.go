@@ -0,0 +1,229 @@
+package benchmark
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Statistics a comparison can rank versions by.
+const (
+	StatisticMean        = "mean"
+	StatisticMedian      = "median"
+	StatisticTrimmedMean = "trimmed-mean"
+)
+
+// ParseStatistic validates a statistic name.
+func ParseStatistic(name string) (string, error) {
+	switch name {
+	case StatisticMean, StatisticMedian, StatisticTrimmedMean:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown statistic %q (%s, %s, %s)", name, StatisticMean, StatisticMedian, StatisticTrimmedMean)
+}
+
+// OutlierOptions control how trials far from the median are handled.
+type OutlierOptions struct {
+	// Threshold is the modified z-score above which a trial is an outlier.
+	Threshold float64
+	// Exclude leaves outlier trials out of the statistics instead of only
+	// flagging them.
+	Exclude bool
+}
+
+// CompareOptions control how Compare aggregates trials.
+type CompareOptions struct {
+	// Statistic is the throughput statistic versions are ranked by.
+	Statistic string
+	Outliers  OutlierOptions
+}
+
+// DefaultCompareOptions ranks versions by median throughput and flags, but
+// keeps, outlier trials.
+func DefaultCompareOptions() CompareOptions {
+	return CompareOptions{
+		Statistic: StatisticMedian,
+		Outliers:  OutlierOptions{Threshold: DefaultOutlierThreshold},
+	}
+}
+
+// VersionSummary aggregates the trials of one Apollo version.
+type VersionSummary struct {
+	Version        string  `json:"version"`
+	Trials         int     `json:"trials"`
+	MeanTPS        float64 `json:"mean_tps"`
+	MedianTPS      float64 `json:"median_tps"`
+	TrimmedMeanTPS float64 `json:"trimmed_mean_tps"`
+	StdDevTPS      float64 `json:"stddev_tps"`
+	MADTPS         float64 `json:"mad_tps"`
+	// TPS is the throughput of the compared statistic.
+	TPS float64 `json:"tps"`
+	// Outliers are the trials whose throughput is far from the median,
+	// Excluded the number of them left out of the statistics.
+	Outliers []Outlier `json:"outliers,omitempty"`
+	Excluded int       `json:"excluded,omitempty"`
+}
+
+// PairComparison compares the throughput of Candidate against Base.
+type PairComparison struct {
+	Base       string  `json:"base"`
+	Candidate  string  `json:"candidate"`
+	DiffTPS    float64 `json:"diff_tps"`
+	DiffPct    float64 `json:"diff_pct"`
+	Comparable bool    `json:"comparable"`
+	// MeanDiffPct is the difference of the mean throughputs. MeanDisagrees
+	// is set when the means rank the versions the other way round, which
+	// points at outlier trials.
+	MeanDiffPct   float64 `json:"mean_diff_pct"`
+	MeanDisagrees bool    `json:"mean_disagrees,omitempty"`
+}
+
+type Comparison struct {
+	Date      time.Time        `json:"date"`
+	Statistic string           `json:"statistic"`
+	Outliers  OutlierOptions   `json:"outlier_options"`
+	Versions  []VersionSummary `json:"versions"`
+	Pairs     []PairComparison `json:"pairs"`
+}
+
+// Compare summarizes the trial results of each version, in the given order,
+// and compares every pair of versions once by the statistic of opts.
+func Compare(versions []string, results map[string][]BenchmarkResult, opts CompareOptions) Comparison {
+	cmp := Comparison{Date: time.Now(), Statistic: opts.Statistic, Outliers: opts.Outliers}
+	for _, version := range versions {
+		cmp.Versions = append(cmp.Versions, summarizeVersion(version, results[version], opts))
+	}
+
+	for i := range cmp.Versions {
+		for j := i + 1; j < len(cmp.Versions); j++ {
+			base, candidate := cmp.Versions[i], cmp.Versions[j]
+			pair := PairComparison{
+				Base:       base.Version,
+				Candidate:  candidate.Version,
+				Comparable: base.Trials > 0 && candidate.Trials > 0,
+			}
+			if pair.Comparable {
+				pair.DiffTPS = candidate.TPS - base.TPS
+				if base.TPS != 0 {
+					pair.DiffPct = pair.DiffTPS / base.TPS * 100
+				}
+				meanDiff := candidate.MeanTPS - base.MeanTPS
+				if base.MeanTPS != 0 {
+					pair.MeanDiffPct = meanDiff / base.MeanTPS * 100
+				}
+				pair.MeanDisagrees = opts.Statistic != StatisticMean && meanDiff*pair.DiffTPS < 0
+			}
+			cmp.Pairs = append(cmp.Pairs, pair)
+		}
+	}
+	return cmp
+}
+
+func summarizeVersion(version string, results []BenchmarkResult, opts CompareOptions) VersionSummary {
+	summary := VersionSummary{Version: version, Trials: len(results)}
+	if len(results) == 0 {
+		return summary
+	}
+	kept, outliers := trialOutliers(results, opts.Outliers)
+	summary.Outliers = outliers
+	summary.Excluded = len(results) - len(kept)
+	tps := make([]float64, len(kept))
+	for i, res := range kept {
+		tps[i] = res.WallClockTPS
+	}
+
+	summary.MeanTPS = Mean(tps)
+	summary.MedianTPS = Median(tps)
+	summary.TrimmedMeanTPS = TrimmedMean(tps, DefaultTrimFraction)
+	summary.StdDevTPS = StdDev(tps)
+	summary.MADTPS = MAD(tps)
+	switch opts.Statistic {
+	case StatisticMean:
+		summary.TPS = summary.MeanTPS
+	case StatisticTrimmedMean:
+		summary.TPS = summary.TrimmedMeanTPS
+	default:
+		summary.TPS = summary.MedianTPS
+	}
+	return summary
+}
+
+// Markdown renders the comparison in the same layout compare_versions.sh
+// used for comparison_results.md.
+func (c Comparison) Markdown() string {
+	var sb strings.Builder
+	c.render(func(_ func(string, ...any) string, format string, args ...any) {
+		fmt.Fprintf(&sb, format, args...)
+	})
+	return sb.String()
+}
+
+// PrintComparison writes the comparison to stdout with colors.
+func PrintComparison(c Comparison) {
+	c.render(func(paint func(string, ...any) string, format string, args ...any) {
+		fmt.Fprint(os.Stdout, paint(format, args...))
+	})
+}
+
+func (c Comparison) render(write func(paint func(string, ...any) string, format string, args ...any)) {
+	cyan, green, red, white := color.CyanString, color.GreenString, color.RedString, color.WhiteString
+
+	write(cyan, "# Benchmark Analysis Results\n\n")
+	write(cyan, "Date: %s\n\n", c.Date.Format("2006-01-02 15:04:05"))
+
+	statistic := map[string]string{
+		StatisticMean:        "Average",
+		StatisticMedian:      "Median",
+		StatisticTrimmedMean: "Trimmed Mean",
+	}[c.Statistic]
+	write(cyan, "## %s Transactions Per Second (Tx/s) Across Versions\n\n", statistic)
+	for _, v := range c.Versions {
+		if v.Trials == 0 {
+			write(red, "* %s: No successful trials to calculate %s Tx/s.\n", v.Version, strings.ToLower(statistic))
+			continue
+		}
+		trials := fmt.Sprintf("%d trials", v.Trials)
+		if v.Excluded > 0 {
+			trials += fmt.Sprintf(", %d excluded", v.Excluded)
+		}
+		write(green, "* %s: %.2f Tx/s (%s; mean %.2f ± %.2f, median %.2f, trimmed mean %.2f, MAD %.2f)\n",
+			v.Version, v.TPS, trials, v.MeanTPS, v.StdDevTPS, v.MedianTPS, v.TrimmedMeanTPS, v.MADTPS)
+		for _, o := range v.Outliers {
+			action := "flagged"
+			if v.Excluded > 0 {
+				action = "excluded"
+			}
+			write(red, "  - Trial %d %s: %s\n", o.Trial, action, o.Reason)
+		}
+	}
+	write(white, "\n")
+
+	if len(c.Versions) < 2 {
+		write(white, "* Only one version provided. No comparisons to perform.\n")
+		return
+	}
+
+	write(cyan, "## Pairwise Comparisons\n\n")
+	for _, p := range c.Pairs {
+		if !p.Comparable {
+			write(red, "* Cannot compare %s with %s: %s Tx/s not available for both.\n", p.Base, p.Candidate, strings.ToLower(statistic))
+			continue
+		}
+		write(cyan, "* %s vs %s:\n", p.Candidate, p.Base)
+		write(green, "  - Difference: %.2f Tx/s\n", p.DiffTPS)
+		switch {
+		case p.DiffTPS > 0:
+			write(green, "  - %s is faster by %.2f%%\n", p.Candidate, p.DiffPct)
+		case p.DiffTPS < 0:
+			write(red, "  - %s is slower by %.2f%%\n", p.Candidate, -p.DiffPct)
+		default:
+			write(white, "  - Both versions have similar %s Tx/s.\n", strings.ToLower(statistic))
+		}
+		if p.MeanDisagrees {
+			write(red, "  - The means differ by %.2f%% the other way: outlier trials skew the average.\n", p.MeanDiffPct)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package benchmark
+
+import (
+	"apollo-bench/internal/backend"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Salvionied/apollo/constants"
+	"github.com/Salvionied/apollo/serialization/Address"
+)
+
+// Config describes a single benchmark run.
+type Config struct {
+	// Scenario selects what every iteration builds, see Scenarios.
+	Scenario string
+	// Sender holds the generated UTxOs and Receiver gets the requested
+	// outputs, both bech32 addresses on Network.
+	Sender   string
+	Receiver string
+	// Network is one of Networks.
+	Network     string
+	UTxOInput   int
+	UTxOOutput  int
+	UTxOLevel   int
+	Iterations  int
+	Parallelism int
+	// CPUProfile, when set, is the file the CPU profile of the measured
+	// iterations is written to.
+	CPUProfile string
+	// MemProfile, when set, is the file the alloc profile of the measured
+	// iterations is written to.
+	MemProfile string
+	// Hotspots is the number of functions the result lists per profile by
+	// flat and by cumulative value. Zero leaves the profiles unparsed.
+	Hotspots int
+	// ReproDir, when set, receives a reproducer bundle per failure class.
+	ReproDir string
+	// BackendLatency, when set, wraps the chain context in a
+	// backend.LatencyContext using this profile, see backend.ParseProfile.
+	BackendLatency string
+	// Addresses is the number of wallet addresses the generated UTxOs are
+	// spread over, split between the address types of AddressMix.
+	Addresses int
+	// AddressMix weights the address types of the wallet, see
+	// ParseAddressMix. Empty means base addresses only.
+	AddressMix string
+	// OutputShape is one of OutputShapes and selects the native tokens the
+	// requested outputs carry, up to AssetsPerOutput each.
+	OutputShape     string
+	AssetsPerOutput int
+	// DetectMutation hashes the shared build inputs before, every
+	// MutationInterval during and after the run and reports changes.
+	DetectMutation   bool
+	MutationInterval time.Duration
+	// DeepClone gives every build its own deep copy of the UTxOs instead
+	// of a copy of the slice only.
+	DeepClone bool
+	// Mint sizes the mint map of the mint scenario.
+	Mint MintConfig
+	// Features sizes the builder feature of the feature scenarios.
+	Features  FeatureConfig
+	Warmup    WarmupConfig
+	Precision PrecisionConfig
+}
+
+// DefaultConfig returns the configuration the CLI uses when no flags are
+// given.
+func DefaultConfig() Config {
+	return Config{
+		Scenario:         ScenarioPayment,
+		Sender:           TEST_WALLET_ADDRESS_1,
+		Receiver:         TEST_WALLET_ADDRESS_2,
+		Network:          "preview",
+		UTxOInput:        10,
+		UTxOOutput:       10,
+		UTxOLevel:        1,
+		Iterations:       1000,
+		Parallelism:      4,
+		Hotspots:         10,
+		Addresses:        1,
+		OutputShape:      OutputShapeLovelace,
+		AssetsPerOutput:  3,
+		MutationInterval: 100 * time.Millisecond,
+		Mint: MintConfig{
+			Assets:         10,
+			NativePolicies: 1,
+			PlutusPolicies: 1,
+		},
+		Features: FeatureConfig{
+			MetadataBytes:  64,
+			ValidityWindow: 7200,
+			Withdrawals:    1,
+			Certificates:   1,
+		},
+		Warmup: WarmupConfig{
+			Iterations: 100,
+			Window:     50,
+			Tolerance:  0.05,
+		},
+		Precision: PrecisionConfig{
+			MaxDuration: 5 * time.Minute,
+		},
+	}
+}
+
+// Validate reports the first invalid setting in c.
+func (c Config) Validate() error {
+	switch {
+	case c.UTxOInput <= 0:
+		return errors.New("utxo input must be > 0")
+	case c.UTxOOutput <= 0:
+		return errors.New("utxo output must be > 0")
+	case c.UTxOLevel < 1 || c.UTxOLevel > 3:
+		return fmt.Errorf("invalid utxo level %d", c.UTxOLevel)
+	case c.Iterations <= 0:
+		return errors.New("iterations must be > 0")
+	case c.Parallelism <= 0:
+		return errors.New("parallelism must be > 0")
+	case c.Hotspots < 0:
+		return errors.New("hotspots must be >= 0")
+	case c.Addresses <= 0:
+		return errors.New("addresses must be > 0")
+	case c.AssetsPerOutput <= 0:
+		return errors.New("assets per output must be > 0")
+	case c.DetectMutation && c.MutationInterval <= 0:
+		return errors.New("mutation check interval must be > 0")
+	case c.Warmup.Iterations < 0:
+		return errors.New("warm-up iterations must be >= 0")
+	case c.Warmup.Adaptive && (c.Warmup.Window <= 0 || c.Warmup.Tolerance <= 0):
+		return errors.New("adaptive warm-up window and tolerance must be > 0")
+	case c.Precision.TargetCI < 0:
+		return errors.New("target confidence interval must be >= 0")
+	case c.Precision.TargetCI > 0 && c.Precision.MaxDuration <= 0:
+		// An unreachable target would otherwise run forever.
+		return errors.New("max duration must be > 0 when a target confidence interval is set")
+	}
+	scn, err := lookupScenario(c.Scenario)
+	if err != nil {
+		return err
+	}
+	// Mint and Features only size the scenarios that use them.
+	if scn.validate != nil {
+		if err := scn.validate(c); err != nil {
+			return err
+		}
+	}
+	if err := lookupOutputShape(c.OutputShape); err != nil {
+		return err
+	}
+	if _, _, _, err := c.wallet(); err != nil {
+		return err
+	}
+	if c.BackendLatency != "" {
+		if _, err := backend.ParseProfile(c.BackendLatency); err != nil {
+			return err
+		}
+	}
+	mix, err := ParseAddressMix(c.AddressMix)
+	if err != nil {
+		return err
+	}
+	if c.Addresses < len(mix.Types()) {
+		return fmt.Errorf("%d addresses cannot cover the %d address types of %s", c.Addresses, len(mix.Types()), mix)
+	}
+	// These wrap, spread or replay the inputs of the fixed chain context
+	// builds.
+	if !scn.fixedContext {
+		if c.BackendLatency != "" {
+			return fmt.Errorf("backend latency is not supported by the %s scenario", c.Scenario)
+		}
+		if c.Addresses > 1 || c.AddressMix != "" {
+			return fmt.Errorf("address mixes are not supported by the %s scenario", c.Scenario)
+		}
+		if c.ReproDir != "" {
+			return fmt.Errorf("reproducer bundles are not supported by the %s scenario", c.Scenario)
+		}
+	}
+	return nil
+}
+
+// wallet decodes the sender and receiver addresses and checks that they
+// belong to the configured network.
+func (c Config) wallet() (Address.Address, Address.Address, constants.Network, error) {
+	network, err := ParseNetwork(c.Network)
+	if err != nil {
+		return Address.Address{}, Address.Address{}, 0, err
+	}
+	sender, err := decodeWalletAddress("sender", c.Sender, network)
+	if err != nil {
+		return Address.Address{}, Address.Address{}, 0, err
+	}
+	receiver, err := decodeWalletAddress("receiver", c.Receiver, network)
+	if err != nil {
+		return Address.Address{}, Address.Address{}, 0, err
+	}
+	return sender, receiver, network, nil
+}
@@ -0,0 +1,379 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/TransactionInput"
+	"github.com/Salvionied/apollo/serialization/TransactionOutput"
+	"github.com/Salvionied/cbor/v2"
+	"github.com/fatih/color"
+)
+
+// DefaultCorpusDir returns where the golden transactions are committed:
+// testdata/golden under the module root, the nearest directory at or above
+// the working directory holding a go.mod.
+func DefaultCorpusDir() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "testdata", "golden"), nil
+		}
+		if filepath.Dir(dir) == dir {
+			return "", fmt.Errorf("no module root at or above %s", wd)
+		}
+	}
+}
+
+// corpusExt is the extension of the golden transaction files.
+const corpusExt = ".cbor"
+
+// WriteCorpus builds the transaction of every named scenario once and
+// writes its CBOR to dir/<scenario>.cbor. It returns the files written.
+func WriteCorpus(ctx context.Context, cfg Config, names []string, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		cfg.Scenario = name
+		tx, err := buildGolden(cfg)
+		if err != nil {
+			return files, fmt.Errorf("build %s scenario: %w", name, err)
+		}
+		cbor, err := tx.Bytes()
+		if err != nil {
+			return files, fmt.Errorf("encode %s transaction: %w", name, err)
+		}
+		file := filepath.Join(dir, name+corpusExt)
+		if err := os.WriteFile(file, cbor, 0o644); err != nil {
+			return files, err
+		}
+		slog.Info("Golden transaction written", "scenario", name, "file", file, "size", len(cbor))
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func buildGolden(cfg Config) (*Transaction.Transaction, error) {
+	_, run, err := prepareDeterministic(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if run.close != nil {
+		defer run.close()
+	}
+	return run.buildOnce(cfg.DeepClone)
+}
+
+// TxDiff is the structural difference between an old and a new build of a
+// transaction. Inputs and outputs are compared as multisets, so a reorder
+// alone shows up in InputsReordered only.
+type TxDiff struct {
+	InputsAdded     []string `json:"inputs_added,omitempty"`
+	InputsRemoved   []string `json:"inputs_removed,omitempty"`
+	InputsReordered bool     `json:"inputs_reordered,omitempty"`
+	OutputsAdded    []string `json:"outputs_added,omitempty"`
+	OutputsRemoved  []string `json:"outputs_removed,omitempty"`
+	OldFee          int64    `json:"old_fee"`
+	NewFee          int64    `json:"new_fee"`
+	OldSize         int      `json:"old_size"`
+	NewSize         int      `json:"new_size"`
+	// CollateralAdded and CollateralRemoved are the changed collateral
+	// inputs, OldTotalCollateral and NewTotalCollateral the declared totals.
+	CollateralAdded    []string `json:"collateral_added,omitempty"`
+	CollateralRemoved  []string `json:"collateral_removed,omitempty"`
+	OldTotalCollateral int      `json:"old_total_collateral,omitempty"`
+	NewTotalCollateral int      `json:"new_total_collateral,omitempty"`
+	OldScriptDataHash  string   `json:"old_script_data_hash,omitempty"`
+	NewScriptDataHash  string   `json:"new_script_data_hash,omitempty"`
+	// Other names the remaining body fields that differ.
+	Other []string `json:"other,omitempty"`
+}
+
+// FeeDelta and SizeDelta return the change from the old to the new build.
+func (d TxDiff) FeeDelta() int64 { return d.NewFee - d.OldFee }
+func (d TxDiff) SizeDelta() int  { return d.NewSize - d.OldSize }
+
+// Identical reports whether both builds are the same transaction.
+func (d TxDiff) Identical() bool {
+	return len(d.InputsAdded) == 0 && len(d.InputsRemoved) == 0 && !d.InputsReordered &&
+		len(d.OutputsAdded) == 0 && len(d.OutputsRemoved) == 0 &&
+		d.FeeDelta() == 0 && d.SizeDelta() == 0 &&
+		len(d.CollateralAdded) == 0 && len(d.CollateralRemoved) == 0 &&
+		d.OldTotalCollateral == d.NewTotalCollateral &&
+		d.OldScriptDataHash == d.NewScriptDataHash && len(d.Other) == 0
+}
+
+// DiffTransactions decodes the CBOR of two transactions and compares them.
+func DiffTransactions(oldCBOR, newCBOR []byte) (TxDiff, error) {
+	var oldTx, newTx Transaction.Transaction
+	if err := cbor.Unmarshal(oldCBOR, &oldTx); err != nil {
+		return TxDiff{}, fmt.Errorf("decode old transaction: %w", err)
+	}
+	if err := cbor.Unmarshal(newCBOR, &newTx); err != nil {
+		return TxDiff{}, fmt.Errorf("decode new transaction: %w", err)
+	}
+	o, n := oldTx.TransactionBody, newTx.TransactionBody
+
+	d := TxDiff{
+		OldFee:             o.Fee,
+		NewFee:             n.Fee,
+		OldSize:            len(oldCBOR),
+		NewSize:            len(newCBOR),
+		OldTotalCollateral: o.TotalCollateral,
+		NewTotalCollateral: n.TotalCollateral,
+		OldScriptDataHash:  hex.EncodeToString(o.ScriptDataHash),
+		NewScriptDataHash:  hex.EncodeToString(n.ScriptDataHash),
+	}
+	oldInputs, newInputs := inputStrings(o.Inputs), inputStrings(n.Inputs)
+	d.InputsAdded, d.InputsRemoved = setDiff(oldInputs, newInputs)
+	d.InputsReordered = len(d.InputsAdded) == 0 && len(d.InputsRemoved) == 0 &&
+		strings.Join(oldInputs, ",") != strings.Join(newInputs, ",")
+	d.OutputsAdded, d.OutputsRemoved = setDiff(outputStrings(o.Outputs), outputStrings(n.Outputs))
+	d.CollateralAdded, d.CollateralRemoved = setDiff(inputStrings(o.Collateral), inputStrings(n.Collateral))
+
+	// The remaining fields are compared by their encoding.
+	other := []struct {
+		name     string
+		old, new any
+	}{
+		{"ttl", o.Ttl, n.Ttl},
+		{"validity start", o.ValidityStart, n.ValidityStart},
+		{"certificates", o.Certificates, n.Certificates},
+		{"withdrawals", o.Withdrawals, n.Withdrawals},
+		{"auxiliary data hash", o.AuxiliaryDataHash, n.AuxiliaryDataHash},
+		{"mint", o.Mint, n.Mint},
+		{"required signers", o.RequiredSigners, n.RequiredSigners},
+		{"collateral return", o.CollateralReturn, n.CollateralReturn},
+		{"reference inputs", o.ReferenceInputs, n.ReferenceInputs},
+		{"witnesses", oldTx.TransactionWitnessSet, newTx.TransactionWitnessSet},
+	}
+	for _, field := range other {
+		oldHash, err := stateHash(field.old)
+		if err != nil {
+			return d, fmt.Errorf("encode old %s: %w", field.name, err)
+		}
+		newHash, err := stateHash(field.new)
+		if err != nil {
+			return d, fmt.Errorf("encode new %s: %w", field.name, err)
+		}
+		if oldHash != newHash {
+			d.Other = append(d.Other, field.name)
+		}
+	}
+	return d, nil
+}
+
+func inputStrings(inputs []TransactionInput.TransactionInput) []string {
+	s := make([]string, len(inputs))
+	for i, in := range inputs {
+		s[i] = in.String()
+	}
+	return s
+}
+
+// outputStrings describes every output by its address, lovelace and
+// sorted assets.
+func outputStrings(outputs []TransactionOutput.TransactionOutput) []string {
+	s := make([]string, len(outputs))
+	for i, out := range outputs {
+		var units []string
+		for policy, assets := range out.GetValue().GetAssets() {
+			for name, quantity := range assets {
+				units = append(units, fmt.Sprintf("%d %s.%s", quantity, policy.Value, name.HexString()))
+			}
+		}
+		sort.Strings(units)
+		s[i] = fmt.Sprintf("%s: %d lovelace", out.GetAddress().String(), out.Lovelace())
+		if len(units) > 0 {
+			s[i] += " + " + strings.Join(units, ", ")
+		}
+	}
+	return s
+}
+
+// CorpusDiff compares the golden transaction of one scenario.
+type CorpusDiff struct {
+	Scenario string `json:"scenario"`
+	// Missing names the corpus ("old" or "new") that lacks the scenario.
+	Missing string  `json:"missing,omitempty"`
+	Diff    *TxDiff `json:"diff,omitempty"`
+}
+
+// DiffCorpus compares the golden transactions of two corpus directories,
+// or of two single transaction files, by scenario name.
+func DiffCorpus(oldPath, newPath string) ([]CorpusDiff, error) {
+	oldFiles, err := corpusFiles(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := corpusFiles(newPath)
+	if err != nil {
+		return nil, err
+	}
+	// Two single files are compared with each other whatever their names.
+	if !isDir(oldPath) && !isDir(newPath) {
+		name := strings.TrimSuffix(filepath.Base(oldPath), corpusExt)
+		newFiles = map[string]string{name: newPath}
+	}
+
+	names := make([]string, 0, len(oldFiles)+len(newFiles))
+	for name := range oldFiles {
+		names = append(names, name)
+	}
+	for name := range newFiles {
+		if _, ok := oldFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := make([]CorpusDiff, 0, len(names))
+	for _, name := range names {
+		oldFile, inOld := oldFiles[name]
+		newFile, inNew := newFiles[name]
+		switch {
+		case !inOld:
+			diffs = append(diffs, CorpusDiff{Scenario: name, Missing: "old"})
+			continue
+		case !inNew:
+			diffs = append(diffs, CorpusDiff{Scenario: name, Missing: "new"})
+			continue
+		}
+		oldCBOR, err := os.ReadFile(oldFile)
+		if err != nil {
+			return nil, err
+		}
+		newCBOR, err := os.ReadFile(newFile)
+		if err != nil {
+			return nil, err
+		}
+		d, err := DiffTransactions(oldCBOR, newCBOR)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		diffs = append(diffs, CorpusDiff{Scenario: name, Diff: &d})
+	}
+	return diffs, nil
+}
+
+// corpusFiles returns the golden transaction files at path by scenario name.
+// path is either a corpus directory or a single file.
+func corpusFiles(path string) (map[string]string, error) {
+	if !isDir(path) {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return map[string]string{strings.TrimSuffix(filepath.Base(path), corpusExt): path}, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(path, "*"+corpusExt))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no %s files in %s", corpusExt, path)
+	}
+	files := make(map[string]string, len(matches))
+	for _, file := range matches {
+		files[strings.TrimSuffix(filepath.Base(file), corpusExt)] = file
+	}
+	return files, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// ErrCorpusChanged is returned when two corpora hold different transactions.
+var ErrCorpusChanged = errors.New("golden transactions differ")
+
+// CorpusChanged reports whether any scenario differs between the corpora.
+func CorpusChanged(diffs []CorpusDiff) bool {
+	for _, d := range diffs {
+		if d.Missing != "" || !d.Diff.Identical() {
+			return true
+		}
+	}
+	return false
+}
+
+// maxDiffItem is the length listed inputs and outputs are cut to.
+const maxDiffItem = 200
+
+// PrintCorpusDiff writes diffs to stdout with colors.
+func PrintCorpusDiff(oldPath, newPath string, diffs []CorpusDiff) {
+	renderCorpusDiff(func(paint func(string, ...any) string, format string, args ...any) {
+		fmt.Fprint(os.Stdout, paint(format, args...))
+	}, fmt.Sprintf("%s -> %s", oldPath, newPath), diffs)
+}
+
+// CorpusDiffMarkdown renders diffs as a section of comparison_results.md.
+func CorpusDiffMarkdown(base, candidate string, diffs []CorpusDiff) string {
+	var sb strings.Builder
+	renderCorpusDiff(func(_ func(string, ...any) string, format string, args ...any) {
+		fmt.Fprintf(&sb, format, args...)
+	}, fmt.Sprintf("%s -> %s", base, candidate), diffs)
+	return sb.String()
+}
+
+func renderCorpusDiff(write func(paint func(string, ...any) string, format string, args ...any), title string, diffs []CorpusDiff) {
+	cyan, green, red, white := color.CyanString, color.GreenString, color.RedString, color.WhiteString
+	list := func(label string, items []string) {
+		for _, item := range items {
+			if len(item) > maxDiffItem {
+				item = item[:maxDiffItem-3] + "..."
+			}
+			write(white, "  - %s %s\n", label, item)
+		}
+	}
+
+	write(cyan, "## Golden Transaction Diff: %s\n\n", title)
+	for _, c := range diffs {
+		switch {
+		case c.Missing != "":
+			write(red, "* %s: missing in %s corpus\n", c.Scenario, c.Missing)
+			continue
+		case c.Diff.Identical():
+			write(green, "* %s: identical\n", c.Scenario)
+			continue
+		}
+		d := c.Diff
+		write(red, "* %s:\n", c.Scenario)
+		write(white, "  - fee %+d lovelace (%d -> %d)\n", d.FeeDelta(), d.OldFee, d.NewFee)
+		write(white, "  - size %+d bytes (%d -> %d)\n", d.SizeDelta(), d.OldSize, d.NewSize)
+		list("input added", d.InputsAdded)
+		list("input removed", d.InputsRemoved)
+		if d.InputsReordered {
+			write(white, "  - inputs reordered\n")
+		}
+		list("output added", d.OutputsAdded)
+		list("output removed", d.OutputsRemoved)
+		list("collateral added", d.CollateralAdded)
+		list("collateral removed", d.CollateralRemoved)
+		if d.OldTotalCollateral != d.NewTotalCollateral {
+			write(white, "  - total collateral %d -> %d\n", d.OldTotalCollateral, d.NewTotalCollateral)
+		}
+		if d.OldScriptDataHash != d.NewScriptDataHash {
+			write(white, "  - script data hash %q -> %q\n", d.OldScriptDataHash, d.NewScriptDataHash)
+		}
+		if len(d.Other) > 0 {
+			write(white, "  - also changed: %s\n", strings.Join(d.Other, ", "))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package benchmark
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"testing"
+)
+
+// TestCorpusMatchesGolden rebuilds the committed golden corpus with the
+// pinned Apollo version and the default inputs it was built with.
+func TestCorpusMatchesGolden(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	golden, err := DefaultCorpusDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := corpusFiles(golden)
+	if err != nil {
+		t.Fatalf("golden corpus: %v", err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dir := t.TempDir()
+	if _, err := WriteCorpus(context.Background(), DefaultConfig(), names, dir); err != nil {
+		t.Fatalf("write corpus: %v", err)
+	}
+	diffs, err := DiffCorpus(golden, dir)
+	if err != nil {
+		t.Fatalf("diff corpus: %v", err)
+	}
+	for _, d := range diffs {
+		switch {
+		case d.Missing != "":
+			t.Errorf("%s: missing from the %s corpus", d.Scenario, d.Missing)
+		case !d.Diff.Identical():
+			t.Errorf("%s: rebuilt transaction differs: %+v", d.Scenario, *d.Diff)
+		}
+	}
+}
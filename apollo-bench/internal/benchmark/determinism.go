@@ -0,0 +1,474 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+	"github.com/fatih/color"
+)
+
+// ErrNondeterministic is returned when builds of the same inputs produced
+// transactions with different body hashes.
+var ErrNondeterministic = errors.New("identical inputs built different transactions")
+
+// ErrBuildFailed is returned when builds of a determinism check failed, so
+// the check could not tell whether they are deterministic.
+var ErrBuildFailed = errors.New("determinism check builds failed")
+
+// TxFingerprint summarizes a built transaction, so that two builds can be
+// told apart by more than their body hash.
+type TxFingerprint struct {
+	BodyHash string `json:"body_hash"`
+	Fee      int64  `json:"fee"`
+	Size     int    `json:"size"`
+	// Inputs are the spent inputs as transaction_id.index, in body order.
+	Inputs  []string `json:"inputs"`
+	Outputs int      `json:"outputs"`
+	// Change is the lovelace of the outputs Apollo added after the
+	// requested ones, ChangeOutputs their number.
+	Change        int64 `json:"change"`
+	ChangeOutputs int   `json:"change_outputs"`
+}
+
+// ScenarioDeterminism is the determinism check of one scenario.
+type ScenarioDeterminism struct {
+	Scenario string `json:"scenario"`
+	// Builds is the number of builds made sequentially and again in
+	// parallel. SequentialHashes and ParallelHashes count the distinct body
+	// hashes of the successful ones.
+	Builds           int           `json:"builds"`
+	SequentialHashes int           `json:"sequential_hashes"`
+	ParallelHashes   int           `json:"parallel_hashes"`
+	Deterministic    bool          `json:"deterministic"`
+	Fingerprint      TxFingerprint `json:"fingerprint"`
+	// Failures counts the builds that failed and Error holds the first of
+	// them. A scenario with failures is neither deterministic nor not.
+	Failures int    `json:"failures,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Failed reports whether builds of the scenario failed.
+func (s ScenarioDeterminism) Failed() bool {
+	return s.Error != ""
+}
+
+// DeterminismReport is the result of CheckDeterminism. Saved reports of
+// different runs or Apollo versions are compared with CompareDeterminism.
+type DeterminismReport struct {
+	Date          time.Time             `json:"date"`
+	ApolloVersion string                `json:"apollo_version"`
+	UTxOInput     int                   `json:"utxo_input"`
+	UTxOOutput    int                   `json:"utxo_output"`
+	UTxOLevel     int                   `json:"utxo_level"`
+	OutputShape   string                `json:"output_shape"`
+	Parallelism   int                   `json:"parallelism"`
+	Scenarios     []ScenarioDeterminism `json:"scenarios"`
+}
+
+// Deterministic reports whether no scenario built different transactions.
+// Scenarios whose builds failed are left to Failed.
+func (r DeterminismReport) Deterministic() bool {
+	for _, s := range r.Scenarios {
+		if !s.Failed() && !s.Deterministic {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed reports whether builds of any scenario failed.
+func (r DeterminismReport) Failed() bool {
+	for _, s := range r.Scenarios {
+		if s.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// DeterministicScenarios returns the names of the scenarios whose builds
+// only depend on the configuration, sorted.
+func DeterministicScenarios() []string {
+	var names []string
+	for _, name := range Scenarios() {
+		if scenarios[name].deterministic {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// CheckDeterminism builds the transaction of every named scenario builds
+// times sequentially and builds times over cfg.Parallelism goroutines, and
+// compares the body hashes. Every build starts from the same inputs, so all
+// of them must hash the same.
+func CheckDeterminism(ctx context.Context, cfg Config, names []string, builds int) (*DeterminismReport, error) {
+	if builds <= 0 {
+		return nil, errors.New("builds must be > 0")
+	}
+	report := &DeterminismReport{
+		Date:          time.Now(),
+		ApolloVersion: ApolloVersion(),
+		UTxOInput:     cfg.UTxOInput,
+		UTxOOutput:    cfg.UTxOOutput,
+		UTxOLevel:     cfg.UTxOLevel,
+		OutputShape:   cfg.OutputShape,
+		Parallelism:   cfg.Parallelism,
+	}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		cfg.Scenario = name
+		slog.Info("Checking determinism", "scenario", name, "builds", builds, "parallelism", cfg.Parallelism)
+		res, err := checkScenarioDeterminism(cfg, builds)
+		if err != nil {
+			return nil, fmt.Errorf("check %s scenario: %w", name, err)
+		}
+		switch {
+		case res.Failed():
+			slog.Warn("Scenario builds failed", "scenario", name, "failures", res.Failures, "error", res.Error)
+		case !res.Deterministic:
+			slog.Warn("Scenario is not deterministic", "scenario", name,
+				"sequentialHashes", res.SequentialHashes, "parallelHashes", res.ParallelHashes)
+		}
+		report.Scenarios = append(report.Scenarios, res)
+	}
+	return report, nil
+}
+
+// prepareDeterministic prepares cfg.Scenario, which must be deterministic,
+// against a fixed chain context.
+func prepareDeterministic(cfg Config) (*scenarioEnv, *scenarioRun, error) {
+	scn, err := lookupScenario(cfg.Scenario)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !scn.deterministic {
+		return nil, nil, fmt.Errorf("scenario %s is not deterministic (available: %v)", cfg.Scenario, DeterministicScenarios())
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	env, _, _, err := newScenarioEnv(cfg, FixedChainContext.InitFixedChainContext())
+	if err != nil {
+		return nil, nil, err
+	}
+	run, err := scn.prepare(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return env, run, nil
+}
+
+func checkScenarioDeterminism(cfg Config, builds int) (ScenarioDeterminism, error) {
+	res := ScenarioDeterminism{Scenario: cfg.Scenario, Builds: builds}
+	env, run, err := prepareDeterministic(cfg)
+	if err != nil {
+		return res, err
+	}
+	if run.close != nil {
+		defer run.close()
+	}
+
+	var (
+		mu        sync.Mutex
+		reference *TxFingerprint
+		buildErr  error
+		failures  int
+	)
+	// build builds once and returns the body hash, keeping the fingerprint
+	// of the first transaction as the reference. Failed builds return "".
+	build := func() string {
+		tx, err := run.buildOnce(cfg.DeepClone)
+		if err == nil {
+			var fp TxFingerprint
+			if fp, err = fingerprint(tx, len(env.outputs)); err == nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if reference == nil {
+					reference = &fp
+				}
+				return fp.BodyHash
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		failures++
+		if buildErr == nil {
+			buildErr = err
+		}
+		return ""
+	}
+
+	sequential := make(map[string]bool)
+	for range builds {
+		if hash := build(); hash != "" {
+			sequential[hash] = true
+		}
+	}
+
+	parallel := make(map[string]bool)
+	var (
+		wg   sync.WaitGroup
+		next = make(chan struct{})
+	)
+	for range max(cfg.Parallelism, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range next {
+				if hash := build(); hash != "" {
+					mu.Lock()
+					parallel[hash] = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for range builds {
+		next <- struct{}{}
+	}
+	close(next)
+	wg.Wait()
+
+	res.SequentialHashes, res.ParallelHashes = len(sequential), len(parallel)
+	if reference != nil {
+		res.Fingerprint = *reference
+	}
+	if buildErr != nil {
+		res.Failures = failures
+		res.Error = buildErr.Error()
+		return res, nil
+	}
+	res.Deterministic = len(sequential) == 1 && len(parallel) == 1 && parallel[reference.BodyHash]
+	return res, nil
+}
+
+// fingerprint summarizes tx, which pays requested outputs before its change.
+func fingerprint(tx *Transaction.Transaction, requested int) (TxFingerprint, error) {
+	hash, err := tx.TransactionBody.Hash()
+	if err != nil {
+		return TxFingerprint{}, fmt.Errorf("hash transaction body: %w", err)
+	}
+	cbor, err := tx.Bytes()
+	if err != nil {
+		return TxFingerprint{}, fmt.Errorf("encode transaction: %w", err)
+	}
+	body := tx.TransactionBody
+	fp := TxFingerprint{
+		BodyHash: hex.EncodeToString(hash),
+		Fee:      body.Fee,
+		Size:     len(cbor),
+		Inputs:   make([]string, len(body.Inputs)),
+		Outputs:  len(body.Outputs),
+	}
+	for i, in := range body.Inputs {
+		fp.Inputs[i] = in.String()
+	}
+	for i := requested; i < len(body.Outputs); i++ {
+		fp.Change += body.Outputs[i].Lovelace()
+		fp.ChangeOutputs++
+	}
+	return fp, nil
+}
+
+// DeterminismChange lists how the transaction of a scenario differs between
+// two determinism reports.
+type DeterminismChange struct {
+	Scenario string   `json:"scenario"`
+	Changes  []string `json:"changes"`
+}
+
+// CompareDeterminism returns the scenarios whose transaction in candidate
+// differs from the one in base, in base order followed by scenarios only
+// candidate checked. It fails when the reports were built from different
+// inputs.
+func CompareDeterminism(base, candidate DeterminismReport) ([]DeterminismChange, error) {
+	if base.UTxOInput != candidate.UTxOInput || base.UTxOOutput != candidate.UTxOOutput ||
+		base.UTxOLevel != candidate.UTxOLevel || base.OutputShape != candidate.OutputShape {
+		return nil, fmt.Errorf("reports use different inputs: -u %d -v %d --utxo-level %d --output-shape %s vs -u %d -v %d --utxo-level %d --output-shape %s",
+			base.UTxOInput, base.UTxOOutput, base.UTxOLevel, base.OutputShape,
+			candidate.UTxOInput, candidate.UTxOOutput, candidate.UTxOLevel, candidate.OutputShape)
+	}
+
+	checked := make(map[string]ScenarioDeterminism, len(candidate.Scenarios))
+	for _, s := range candidate.Scenarios {
+		checked[s.Scenario] = s
+	}
+	var changes []DeterminismChange
+	for _, b := range base.Scenarios {
+		c, ok := checked[b.Scenario]
+		delete(checked, b.Scenario)
+		if !ok {
+			changes = append(changes, DeterminismChange{Scenario: b.Scenario, Changes: []string{"not checked by candidate"}})
+			continue
+		}
+		if diff := diffFingerprints(b, c); len(diff) > 0 {
+			changes = append(changes, DeterminismChange{Scenario: b.Scenario, Changes: diff})
+		}
+	}
+	for _, c := range candidate.Scenarios {
+		if _, ok := checked[c.Scenario]; ok {
+			changes = append(changes, DeterminismChange{Scenario: c.Scenario, Changes: []string{"not checked by base"}})
+		}
+	}
+	return changes, nil
+}
+
+func diffFingerprints(base, candidate ScenarioDeterminism) []string {
+	var diff []string
+	switch {
+	case base.Error != candidate.Error && candidate.Error != "":
+		diff = append(diff, "build fails: "+candidate.Error)
+	case base.Error != candidate.Error:
+		diff = append(diff, "build no longer fails")
+	}
+	if base.Deterministic != candidate.Deterministic {
+		diff = append(diff, fmt.Sprintf("deterministic %t -> %t", base.Deterministic, candidate.Deterministic))
+	}
+
+	b, c := base.Fingerprint, candidate.Fingerprint
+	if b.BodyHash == c.BodyHash {
+		return diff
+	}
+	if d := c.Fee - b.Fee; d != 0 {
+		diff = append(diff, fmt.Sprintf("fee %+d lovelace (%d -> %d)", d, b.Fee, c.Fee))
+	}
+	if d := c.Size - b.Size; d != 0 {
+		diff = append(diff, fmt.Sprintf("size %+d bytes (%d -> %d)", d, b.Size, c.Size))
+	}
+	if added, removed := setDiff(b.Inputs, c.Inputs); len(added) > 0 || len(removed) > 0 {
+		diff = append(diff, fmt.Sprintf("inputs changed: %d added, %d removed", len(added), len(removed)))
+	} else if strings.Join(b.Inputs, ",") != strings.Join(c.Inputs, ",") {
+		diff = append(diff, "inputs reordered")
+	}
+	if b.Outputs != c.Outputs {
+		diff = append(diff, fmt.Sprintf("outputs %d -> %d", b.Outputs, c.Outputs))
+	}
+	if d := c.Change - b.Change; d != 0 || b.ChangeOutputs != c.ChangeOutputs {
+		diff = append(diff, fmt.Sprintf("change %+d lovelace (%d in %d output(s) -> %d in %d output(s))",
+			d, b.Change, b.ChangeOutputs, c.Change, c.ChangeOutputs))
+	}
+	if len(diff) == 0 {
+		diff = append(diff, fmt.Sprintf("body hash %s -> %s", b.BodyHash, c.BodyHash))
+	}
+	return diff
+}
+
+// setDiff returns the elements of candidate missing from base and those of
+// base missing from candidate.
+func setDiff(base, candidate []string) (added, removed []string) {
+	in := make(map[string]int, len(base))
+	for _, s := range base {
+		in[s]++
+	}
+	for _, s := range candidate {
+		if in[s] > 0 {
+			in[s]--
+			continue
+		}
+		added = append(added, s)
+	}
+	for _, s := range base {
+		if in[s] > 0 {
+			in[s]--
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// LoadDeterminismReport reads a report saved with WriteDeterminismReport.
+func LoadDeterminismReport(path string) (*DeterminismReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report DeterminismReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("decode determinism report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// WriteDeterminismReport saves report to path as indented JSON.
+func WriteDeterminismReport(path string, report DeterminismReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode determinism report: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// PrintDeterminism writes report, and the changes against the saved report
+// against if one was given, to stdout with colors.
+func PrintDeterminism(report DeterminismReport, against string, changes []DeterminismChange) {
+	write := func(paint func(string, ...any) string, format string, args ...any) {
+		fmt.Fprint(os.Stdout, paint(format, args...))
+	}
+	cyan, green, red := color.CyanString, color.GreenString, color.RedString
+
+	write(cyan, "# Determinism Check\n\n")
+	write(cyan, "Apollo %s, -u %d -v %d --utxo-level %d --output-shape %s, parallelism %d\n\n",
+		report.ApolloVersion, report.UTxOInput, report.UTxOOutput, report.UTxOLevel, report.OutputShape, report.Parallelism)
+	for _, s := range report.Scenarios {
+		switch {
+		case s.Failed():
+			write(red, "* %s: %d of %d builds failed, determinism unknown: %s\n", s.Scenario, s.Failures, 2*s.Builds, s.Error)
+		case s.Deterministic:
+			write(green, "* %s: %d sequential and %d parallel builds hash to %s\n", s.Scenario, s.Builds, s.Builds, s.Fingerprint.BodyHash)
+		default:
+			write(red, "* %s: %d distinct hashes in %d sequential builds, %d in %d parallel builds\n",
+				s.Scenario, s.SequentialHashes, s.Builds, s.ParallelHashes, s.Builds)
+		}
+	}
+	if against != "" {
+		write(cyan, "\n")
+		renderDeterminismChanges(write, against, changes)
+	}
+}
+
+// PrintDeterminismChanges writes the changes of candidate against base to
+// stdout with colors.
+func PrintDeterminismChanges(base, candidate string, changes []DeterminismChange) {
+	renderDeterminismChanges(func(paint func(string, ...any) string, format string, args ...any) {
+		fmt.Fprint(os.Stdout, paint(format, args...))
+	}, fmt.Sprintf("%s vs %s", candidate, base), changes)
+}
+
+// DeterminismChangesMarkdown renders the changes of candidate against base
+// as a section of comparison_results.md.
+func DeterminismChangesMarkdown(base, candidate string, changes []DeterminismChange) string {
+	var sb strings.Builder
+	renderDeterminismChanges(func(_ func(string, ...any) string, format string, args ...any) {
+		fmt.Fprintf(&sb, format, args...)
+	}, fmt.Sprintf("%s vs %s", candidate, base), changes)
+	return sb.String()
+}
+
+func renderDeterminismChanges(write func(paint func(string, ...any) string, format string, args ...any), title string, changes []DeterminismChange) {
+	cyan, green, red, white := color.CyanString, color.GreenString, color.RedString, color.WhiteString
+
+	write(cyan, "## Transaction Changes: %s\n\n", title)
+	if len(changes) == 0 {
+		write(green, "* Every scenario builds the same transaction.\n")
+		return
+	}
+	for _, c := range changes {
+		write(red, "* %s:\n", c.Scenario)
+		for _, change := range c.Changes {
+			write(white, "  - %s\n", change)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package benchmark
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/pprof/profile"
+)
+
+// ApolloPackage is the import path prefix of Apollo's functions in profiles.
+const ApolloPackage = "github.com/Salvionied/apollo"
+
+// Sample types summarized in results: CPU time of CPU profiles and bytes
+// allocated of alloc profiles.
+const (
+	SampleTypeCPU   = "cpu"
+	SampleTypeAlloc = "alloc_space"
+)
+
+// Hotspot is the flat and cumulative value of one function in a profile.
+// Flat counts samples in the function itself, Cum also those in its callees;
+// the shares are relative to the profile total.
+type Hotspot struct {
+	Function  string  `json:"function"`
+	Flat      int64   `json:"flat"`
+	FlatShare float64 `json:"flat_share"`
+	Cum       int64   `json:"cum"`
+	CumShare  float64 `json:"cum_share"`
+}
+
+// ProfileSummary lists the top functions of a profile by flat and by
+// cumulative value of one sample type.
+type ProfileSummary struct {
+	File       string    `json:"file"`
+	SampleType string    `json:"sample_type"`
+	Unit       string    `json:"unit"`
+	Total      int64     `json:"total"`
+	TopFlat    []Hotspot `json:"top_flat"`
+	TopCum     []Hotspot `json:"top_cum"`
+}
+
+// LoadProfile parses the pprof profile in file.
+func LoadProfile(file string) (*profile.Profile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse profile %s: %w", file, err)
+	}
+	return p, nil
+}
+
+// MergeProfiles parses and merges the profiles in files, e.g. those of the
+// trials of one version.
+func MergeProfiles(files []string) (*profile.Profile, error) {
+	profiles := make([]*profile.Profile, 0, len(files))
+	for _, file := range files {
+		p, err := LoadProfile(file)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles to merge")
+	}
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return nil, fmt.Errorf("merge profiles: %w", err)
+	}
+	return merged, nil
+}
+
+// DefaultSampleType returns the sample type results summarize for p: CPU
+// time for CPU profiles, bytes allocated for alloc profiles and the last
+// sample type otherwise.
+func DefaultSampleType(p *profile.Profile) string {
+	for _, want := range []string{SampleTypeCPU, SampleTypeAlloc} {
+		for _, st := range p.SampleType {
+			if st.Type == want {
+				return want
+			}
+		}
+	}
+	if len(p.SampleType) == 0 {
+		return ""
+	}
+	return p.SampleType[len(p.SampleType)-1].Type
+}
+
+// functionValues returns the flat and cumulative value of sampleType per
+// function of p, and the profile total.
+func functionValues(p *profile.Profile, sampleType string) (map[string]*Hotspot, string, int64, error) {
+	index := -1
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			index = i
+		}
+	}
+	if index < 0 {
+		types := make([]string, len(p.SampleType))
+		for i, st := range p.SampleType {
+			types[i] = st.Type
+		}
+		return nil, "", 0, fmt.Errorf("profile has no %q samples (%s)", sampleType, strings.Join(types, ", "))
+	}
+
+	var total int64
+	functions := make(map[string]*Hotspot)
+	get := func(name string) *Hotspot {
+		h, ok := functions[name]
+		if !ok {
+			h = &Hotspot{Function: name}
+			functions[name] = h
+		}
+		return h
+	}
+	for _, s := range p.Sample {
+		v := s.Value[index]
+		if v == 0 {
+			continue
+		}
+		total += v
+		// Location[0] is the leaf and Line[0] the innermost inlined
+		// function, which is where flat samples belong.
+		seen := make(map[string]bool)
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				name := line.Function.Name
+				if i == 0 && j == 0 {
+					get(name).Flat += v
+				}
+				// Recursive functions count once per sample.
+				if !seen[name] {
+					seen[name] = true
+					get(name).Cum += v
+				}
+			}
+		}
+	}
+	for _, h := range functions {
+		if total != 0 {
+			h.FlatShare = float64(h.Flat) / float64(total)
+			h.CumShare = float64(h.Cum) / float64(total)
+		}
+	}
+	return functions, p.SampleType[index].Unit, total, nil
+}
+
+// SummarizeProfile returns the top n functions of p by flat and by
+// cumulative value of sampleType.
+func SummarizeProfile(p *profile.Profile, sampleType string, n int) (*ProfileSummary, error) {
+	functions, unit, total, err := functionValues(p, sampleType)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]Hotspot, 0, len(functions))
+	for _, h := range functions {
+		all = append(all, *h)
+	}
+	top := func(value func(Hotspot) int64) []Hotspot {
+		sorted := append([]Hotspot(nil), all...)
+		sort.Slice(sorted, func(a, b int) bool {
+			if value(sorted[a]) != value(sorted[b]) {
+				return value(sorted[a]) > value(sorted[b])
+			}
+			return sorted[a].Function < sorted[b].Function
+		})
+		var hotspots []Hotspot
+		for _, h := range sorted {
+			if len(hotspots) == n || value(h) == 0 {
+				break
+			}
+			hotspots = append(hotspots, h)
+		}
+		return hotspots
+	}
+	return &ProfileSummary{
+		SampleType: sampleType,
+		Unit:       unit,
+		Total:      total,
+		TopFlat:    top(func(h Hotspot) int64 { return h.Flat }),
+		TopCum:     top(func(h Hotspot) int64 { return h.Cum }),
+	}, nil
+}
+
+// summarizeProfileFile summarizes the profile in file for a result.
+func summarizeProfileFile(file, sampleType string, n int) (*ProfileSummary, error) {
+	p, err := LoadProfile(file)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := SummarizeProfile(p, sampleType, n)
+	if err != nil {
+		return nil, fmt.Errorf("summarize %s: %w", file, err)
+	}
+	summary.File = file
+	return summary, nil
+}
+
+// allocProfile returns the alloc profile of the process as of a fresh
+// garbage collection, which is when the runtime publishes allocations.
+func allocProfile() (*profile.Profile, error) {
+	runtime.GC()
+	var buf bytes.Buffer
+	if err := pprof.Lookup("allocs").WriteTo(&buf, 0); err != nil {
+		return nil, fmt.Errorf("write alloc profile: %w", err)
+	}
+	return profile.Parse(&buf)
+}
+
+// writeAllocDelta writes the allocations made since base to file, so the
+// profile covers the measured iterations only instead of the whole process.
+func writeAllocDelta(base *profile.Profile, file string) error {
+	current, err := allocProfile()
+	if err != nil {
+		return err
+	}
+	// The in-use sample types are a snapshot rather than a counter, keep
+	// the current ones instead of subtracting.
+	ratios := make([]float64, len(base.SampleType))
+	for i, st := range base.SampleType {
+		if strings.HasPrefix(st.Type, "alloc_") {
+			ratios[i] = -1
+		}
+	}
+	base = base.Copy()
+	if err := base.ScaleN(ratios); err != nil {
+		return err
+	}
+	delta, err := profile.Merge([]*profile.Profile{current, base})
+	if err != nil {
+		return fmt.Errorf("subtract alloc profiles: %w", err)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("create alloc profile file: %w", err)
+	}
+	if err := delta.Compact().Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("write alloc profile: %w", err)
+	}
+	return f.Close()
+}
+
+// HotspotDelta is how one function's flat and cumulative value changed
+// between two profiles, per operation when the diff is normalized.
+type HotspotDelta struct {
+	Function      string  `json:"function"`
+	BaseFlat      float64 `json:"base_flat"`
+	CandidateFlat float64 `json:"candidate_flat"`
+	BaseCum       float64 `json:"base_cum"`
+	CandidateCum  float64 `json:"candidate_cum"`
+	// FlatShareDelta is the change of the function's share of the profile
+	// total, in percentage points.
+	FlatShareDelta float64 `json:"flat_share_delta"`
+}
+
+// FlatDelta is the change of the function's flat value.
+func (d HotspotDelta) FlatDelta() float64 {
+	return d.CandidateFlat - d.BaseFlat
+}
+
+// FlatDeltaPct is FlatDelta relative to the base value, 0 for functions
+// missing from the base profile.
+func (d HotspotDelta) FlatDeltaPct() float64 {
+	if d.BaseFlat == 0 {
+		return 0
+	}
+	return d.FlatDelta() / d.BaseFlat * 100
+}
+
+// ProfileDiffOptions select what DiffProfiles compares.
+type ProfileDiffOptions struct {
+	SampleType string
+	// Focus keeps only functions whose name starts with it, e.g.
+	// ApolloPackage. Empty keeps all.
+	Focus string
+	// BaseOps and CandidateOps, when set, are the operations each profile
+	// covers, e.g. transactions built, and normalize values per operation
+	// so profiles of runs of different length compare.
+	BaseOps      int
+	CandidateOps int
+	// Top is the number of functions listed as hotter and as cooler.
+	Top int
+}
+
+// ProfileDiff lists the functions whose flat value grew (Hotter) or shrank
+// (Cooler) the most between two profiles.
+type ProfileDiff struct {
+	SampleType string `json:"sample_type"`
+	Unit       string `json:"unit"`
+	Focus      string `json:"focus,omitempty"`
+	PerOp      bool   `json:"per_op,omitempty"`
+	// BaseTotal and CandidateTotal are the focused functions' flat totals.
+	BaseTotal      float64        `json:"base_total"`
+	CandidateTotal float64        `json:"candidate_total"`
+	Hotter         []HotspotDelta `json:"hotter"`
+	Cooler         []HotspotDelta `json:"cooler"`
+}
+
+// DiffProfiles compares the functions of two profiles of the same kind.
+func DiffProfiles(base, candidate *profile.Profile, opts ProfileDiffOptions) (*ProfileDiff, error) {
+	if opts.SampleType == "" {
+		opts.SampleType = DefaultSampleType(base)
+	}
+	baseFuncs, unit, _, err := functionValues(base, opts.SampleType)
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	candFuncs, _, _, err := functionValues(candidate, opts.SampleType)
+	if err != nil {
+		return nil, fmt.Errorf("candidate: %w", err)
+	}
+
+	baseScale, candScale := 1.0, 1.0
+	perOp := opts.BaseOps > 0 && opts.CandidateOps > 0
+	if perOp {
+		baseScale, candScale = 1/float64(opts.BaseOps), 1/float64(opts.CandidateOps)
+	}
+	diff := &ProfileDiff{SampleType: opts.SampleType, Unit: unit, Focus: opts.Focus, PerOp: perOp}
+
+	names := make(map[string]bool, len(baseFuncs)+len(candFuncs))
+	for name := range baseFuncs {
+		names[name] = true
+	}
+	for name := range candFuncs {
+		names[name] = true
+	}
+	var deltas []HotspotDelta
+	for name := range names {
+		if !strings.HasPrefix(name, opts.Focus) {
+			continue
+		}
+		d := HotspotDelta{Function: name}
+		if h, ok := baseFuncs[name]; ok {
+			d.BaseFlat, d.BaseCum = float64(h.Flat)*baseScale, float64(h.Cum)*baseScale
+			d.FlatShareDelta -= h.FlatShare * 100
+		}
+		if h, ok := candFuncs[name]; ok {
+			d.CandidateFlat, d.CandidateCum = float64(h.Flat)*candScale, float64(h.Cum)*candScale
+			d.FlatShareDelta += h.FlatShare * 100
+		}
+		diff.BaseTotal += d.BaseFlat
+		diff.CandidateTotal += d.CandidateFlat
+		deltas = append(deltas, d)
+	}
+
+	sort.Slice(deltas, func(a, b int) bool {
+		if deltas[a].FlatDelta() != deltas[b].FlatDelta() {
+			return deltas[a].FlatDelta() > deltas[b].FlatDelta()
+		}
+		return deltas[a].Function < deltas[b].Function
+	})
+	for _, d := range deltas {
+		if len(diff.Hotter) == opts.Top || d.FlatDelta() <= 0 {
+			break
+		}
+		diff.Hotter = append(diff.Hotter, d)
+	}
+	for i := len(deltas) - 1; i >= 0; i-- {
+		d := deltas[i]
+		if len(diff.Cooler) == opts.Top || d.FlatDelta() >= 0 {
+			break
+		}
+		diff.Cooler = append(diff.Cooler, d)
+	}
+	return diff, nil
+}
+
+// formatProfileValue formats v of a profile unit for reading.
+func formatProfileValue(v float64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).Round(time.Nanosecond).String()
+	case "bytes":
+		switch abs := math.Abs(v); {
+		case abs >= 1<<30:
+			return fmt.Sprintf("%.2f GiB", v/(1<<30))
+		case abs >= 1<<20:
+			return fmt.Sprintf("%.2f MiB", v/(1<<20))
+		case abs >= 1<<10:
+			return fmt.Sprintf("%.2f KiB", v/(1<<10))
+		}
+		return fmt.Sprintf("%.0f B", v)
+	}
+	return fmt.Sprintf("%.0f %s", v, unit)
+}
+
+// PrintProfileDiff writes diff to stdout with colors.
+func PrintProfileDiff(base, candidate string, diff *ProfileDiff) {
+	renderProfileDiff(func(paint func(string, ...any) string, format string, args ...any) {
+		fmt.Fprint(os.Stdout, paint(format, args...))
+	}, fmt.Sprintf("%s -> %s", base, candidate), diff)
+}
+
+// ProfileDiffMarkdown renders diff as a section of comparison_results.md.
+func ProfileDiffMarkdown(base, candidate string, diff *ProfileDiff) string {
+	var sb strings.Builder
+	renderProfileDiff(func(_ func(string, ...any) string, format string, args ...any) {
+		fmt.Fprintf(&sb, format, args...)
+	}, fmt.Sprintf("%s -> %s", base, candidate), diff)
+	return sb.String()
+}
+
+func renderProfileDiff(write func(paint func(string, ...any) string, format string, args ...any), title string, diff *ProfileDiff) {
+	cyan, green, red, white := color.CyanString, color.GreenString, color.RedString, color.WhiteString
+	format := func(v float64) string { return formatProfileValue(v, diff.Unit) }
+
+	kind := map[string]string{SampleTypeCPU: "CPU", SampleTypeAlloc: "Allocation"}[diff.SampleType]
+	if kind == "" {
+		kind = diff.SampleType
+	}
+	write(cyan, "## %s Profile Diff: %s\n\n", kind, title)
+	scope := "all functions"
+	if diff.Focus != "" {
+		scope = diff.Focus + " functions"
+	}
+	per := ""
+	if diff.PerOp {
+		per = " per transaction"
+	}
+	write(white, "* %s, flat%s: %s -> %s\n", scope, per, format(diff.BaseTotal), format(diff.CandidateTotal))
+
+	list := func(paint func(string, ...any) string, label string, deltas []HotspotDelta) {
+		if len(deltas) == 0 {
+			return
+		}
+		write(white, "* %s:\n", label)
+		for _, d := range deltas {
+			var change string
+			switch {
+			case d.BaseCum == 0:
+				change = "new"
+			case d.BaseFlat == 0:
+				change = "no flat samples before"
+			default:
+				change = fmt.Sprintf("%+.1f%%", d.FlatDeltaPct())
+			}
+			write(paint, "  - %s: flat %s -> %s (%s, %+.2f pp of total), cum %s -> %s\n",
+				d.Function, format(d.BaseFlat), format(d.CandidateFlat), change, d.FlatShareDelta,
+				format(d.BaseCum), format(d.CandidateCum))
+		}
+	}
+	list(red, "Hotter", diff.Hotter)
+	list(green, "Cooler", diff.Cooler)
+	if len(diff.Hotter) == 0 && len(diff.Cooler) == 0 {
+		write(green, "* No function changed\n")
+	}
+}
@@ -0,0 +1,265 @@
+package benchmark
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// testProfile builds a CPU profile from stacks, each listing its frames
+// leaf first and counting value nanoseconds. Frames joined by "+" share
+// one location, the first being inlined into the others.
+func testProfile(stacks map[string]int64) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: SampleTypeCPU, Unit: "nanoseconds"},
+		},
+		PeriodType: &profile.ValueType{Type: SampleTypeCPU, Unit: "nanoseconds"},
+	}
+	functions := make(map[string]*profile.Function)
+	locations := make(map[string]*profile.Location)
+	for stack, value := range stacks {
+		sample := &profile.Sample{Value: []int64{1, value}}
+		for _, frame := range strings.Split(stack, ";") {
+			loc, ok := locations[frame]
+			if !ok {
+				loc = &profile.Location{ID: uint64(len(p.Location) + 1)}
+				for _, name := range strings.Split(frame, "+") {
+					fn, ok := functions[name]
+					if !ok {
+						fn = &profile.Function{ID: uint64(len(p.Function) + 1), Name: name}
+						functions[name] = fn
+						p.Function = append(p.Function, fn)
+					}
+					loc.Line = append(loc.Line, profile.Line{Function: fn})
+				}
+				locations[frame] = loc
+				p.Location = append(p.Location, loc)
+			}
+			sample.Location = append(sample.Location, loc)
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	return p
+}
+
+func TestSummarizeProfile(t *testing.T) {
+	p := testProfile(map[string]int64{
+		"leaf;mid;main":    60,
+		"mid;main":         20,
+		"rec;rec;rec;main": 10,
+		"inner+outer;main": 10,
+		"idle;main":        0,
+	})
+	// Write and parse the profile, as results do with profile files.
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	summary, err := summarizeProfileFile(file, SampleTypeCPU, 3)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if summary.Total != 100 || summary.Unit != "nanoseconds" || summary.File != file {
+		t.Errorf("total %d %s of %s, want 100 nanoseconds of %s", summary.Total, summary.Unit, summary.File, file)
+	}
+
+	tests := []struct {
+		name string
+		got  []Hotspot
+		want []Hotspot
+	}{
+		{"flat", summary.TopFlat, []Hotspot{
+			{Function: "leaf", Flat: 60, FlatShare: 0.6, Cum: 60, CumShare: 0.6},
+			{Function: "mid", Flat: 20, FlatShare: 0.2, Cum: 80, CumShare: 0.8},
+			// Flat samples of inlined frames belong to the innermost one.
+			{Function: "inner", Flat: 10, FlatShare: 0.1, Cum: 10, CumShare: 0.1},
+		}},
+		{"cum", summary.TopCum, []Hotspot{
+			{Function: "main", Cum: 100, CumShare: 1},
+			{Function: "mid", Flat: 20, FlatShare: 0.2, Cum: 80, CumShare: 0.8},
+			{Function: "leaf", Flat: 60, FlatShare: 0.6, Cum: 60, CumShare: 0.6},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("hotspots = %+v, want %+v", tt.got, tt.want)
+			}
+			for i := range tt.got {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("hotspot %d = %+v, want %+v", i, tt.got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Recursive frames count once per sample and zero samples not at all.
+	all, err := SummarizeProfile(p, SampleTypeCPU, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range all.TopCum {
+		switch h.Function {
+		case "rec":
+			if h.Flat != 10 || h.Cum != 10 {
+				t.Errorf("recursive function counted %d flat, %d cum, want 10, 10", h.Flat, h.Cum)
+			}
+		case "idle":
+			t.Errorf("function without samples listed")
+		}
+	}
+
+	if _, err := SummarizeProfile(p, SampleTypeAlloc, 3); err == nil {
+		t.Errorf("summarizing missing sample type succeeded")
+	}
+}
+
+func TestDefaultSampleType(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []string
+		want  string
+	}{
+		{"none", nil, ""},
+		{"cpu", []string{"samples", SampleTypeCPU}, SampleTypeCPU},
+		{"alloc", []string{"alloc_objects", SampleTypeAlloc, "inuse_objects", "inuse_space"}, SampleTypeAlloc},
+		{"other", []string{"contentions", "delay"}, "delay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &profile.Profile{}
+			for _, st := range tt.types {
+				p.SampleType = append(p.SampleType, &profile.ValueType{Type: st})
+			}
+			if got := DefaultSampleType(p); got != tt.want {
+				t.Errorf("DefaultSampleType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffProfiles(t *testing.T) {
+	apollo := func(name string) string { return ApolloPackage + "." + name }
+	base := testProfile(map[string]int64{
+		apollo("Complete") + ";main": 40,
+		apollo("Select") + ";main":   40,
+		apollo("Gone") + ";main":     10,
+		"runtime.mallocgc;main":      10,
+	})
+	candidate := testProfile(map[string]int64{
+		apollo("Complete") + ";main": 160,
+		apollo("Select") + ";main":   20,
+		apollo("New") + ";main":      10,
+		"runtime.mallocgc;main":      50,
+	})
+
+	type delta struct {
+		function   string
+		base, cand float64
+	}
+	tests := []struct {
+		name           string
+		opts           ProfileDiffOptions
+		hotter, cooler []delta
+		baseTotal      float64
+	}{
+		{
+			name: "all",
+			opts: ProfileDiffOptions{Top: 10},
+			hotter: []delta{
+				{apollo("Complete"), 40, 160},
+				{"runtime.mallocgc", 10, 50},
+				{apollo("New"), 0, 10},
+			},
+			cooler: []delta{
+				{apollo("Select"), 40, 20},
+				{apollo("Gone"), 10, 0},
+			},
+			baseTotal: 100,
+		},
+		{
+			name: "focus",
+			opts: ProfileDiffOptions{Focus: ApolloPackage, Top: 10},
+			hotter: []delta{
+				{apollo("Complete"), 40, 160},
+				{apollo("New"), 0, 10},
+			},
+			cooler: []delta{
+				{apollo("Select"), 40, 20},
+				{apollo("Gone"), 10, 0},
+			},
+			baseTotal: 90,
+		},
+		{
+			name:      "top",
+			opts:      ProfileDiffOptions{Focus: ApolloPackage, Top: 1},
+			hotter:    []delta{{apollo("Complete"), 40, 160}},
+			cooler:    []delta{{apollo("Select"), 40, 20}},
+			baseTotal: 90,
+		},
+		{
+			// The candidate built twice as many transactions.
+			name: "per op",
+			opts: ProfileDiffOptions{Focus: ApolloPackage, BaseOps: 10, CandidateOps: 20, Top: 10},
+			hotter: []delta{
+				{apollo("Complete"), 4, 8},
+				{apollo("New"), 0, 0.5},
+			},
+			cooler: []delta{
+				{apollo("Select"), 4, 1},
+				{apollo("Gone"), 1, 0},
+			},
+			baseTotal: 9,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := DiffProfiles(base, candidate, tt.opts)
+			if err != nil {
+				t.Fatalf("diff: %v", err)
+			}
+			if diff.SampleType != SampleTypeCPU || diff.PerOp != (tt.opts.BaseOps > 0) {
+				t.Errorf("diff of %s, per op %v", diff.SampleType, diff.PerOp)
+			}
+			if !approx(diff.BaseTotal, tt.baseTotal) {
+				t.Errorf("base total = %v, want %v", diff.BaseTotal, tt.baseTotal)
+			}
+			check := func(kind string, got []HotspotDelta, want []delta) {
+				if len(got) != len(want) {
+					t.Fatalf("%s = %+v, want %+v", kind, got, want)
+				}
+				for i, w := range want {
+					if got[i].Function != w.function || !approx(got[i].BaseFlat, w.base) || !approx(got[i].CandidateFlat, w.cand) {
+						t.Errorf("%s %d = %+v, want %+v", kind, i, got[i], w)
+					}
+				}
+			}
+			check("hotter", diff.Hotter, tt.hotter)
+			check("cooler", diff.Cooler, tt.cooler)
+		})
+	}
+
+	// Complete went from 40% to 160 of 240, +26.67 percentage points.
+	diff, err := DiffProfiles(base, candidate, ProfileDiffOptions{Top: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Hotter[0]; !approx(d.FlatShareDelta, 160.0/240*100-40) || !approx(d.FlatDeltaPct(), 300) {
+		t.Errorf("share delta %v, flat delta %v%%, want %v, 300%%", d.FlatShareDelta, d.FlatDeltaPct(), 160.0/240*100-40)
+	}
+
+	if _, err := DiffProfiles(base, candidate, ProfileDiffOptions{SampleType: SampleTypeAlloc}); err == nil {
+		t.Errorf("diffing missing sample type succeeded")
+	}
+}
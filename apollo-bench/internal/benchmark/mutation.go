@@ -0,0 +1,196 @@
+package benchmark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/cbor/v2"
+)
+
+// Mutation phases reported in MutationResult.Phase.
+const (
+	MutationDuring = "during"
+	MutationAfter  = "after"
+)
+
+// canonicalCBOR sorts map keys, so that equal states always hash the same.
+var canonicalCBOR, _ = cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+
+// MutationResult describes shared build input whose deep CBOR encoding
+// changed during a run.
+type MutationResult struct {
+	Target string `json:"target"`
+	// Phase is MutationDuring when a periodic check saw the change and
+	// MutationAfter when only the final check did.
+	Phase string `json:"phase"`
+	// DetectedAfter is the time from the start of the run to the check
+	// that saw the change.
+	DetectedAfter time.Duration `json:"detected_after"`
+	Before        string        `json:"before"`
+	After         string        `json:"after"`
+}
+
+// mutationTarget is shared build input the detector watches.
+type mutationTarget struct {
+	name  string
+	value any
+}
+
+// mutationDetector hashes the deep CBOR encoding of its targets before a
+// run, periodically during it and once after it.
+//
+// The periodic checks read the targets while builds run. If a build writes
+// to a map of a target at the same time, the Go runtime aborts with a
+// concurrent map access error, which is itself a sign of mutation.
+type mutationDetector struct {
+	targets  []mutationTarget
+	baseline map[string]string
+	start    time.Time
+
+	mu     sync.Mutex
+	found  map[string]*MutationResult
+	checks int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newMutationDetector records the baseline hashes of targets.
+func newMutationDetector(targets ...mutationTarget) (*mutationDetector, error) {
+	d := &mutationDetector{
+		targets:  targets,
+		baseline: make(map[string]string, len(targets)),
+		found:    make(map[string]*MutationResult),
+		start:    time.Now(),
+	}
+	for _, t := range targets {
+		hash, err := stateHash(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("hash %s: %w", t.name, err)
+		}
+		d.baseline[t.name] = hash
+	}
+	return d, nil
+}
+
+// watch checks the targets every interval until finish is called.
+func (d *mutationDetector) watch(interval time.Duration) {
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.check(MutationDuring)
+			}
+		}
+	}()
+}
+
+// finish stops watching, checks the targets a last time and returns the
+// mutations seen, in target order, and the number of checks made.
+func (d *mutationDetector) finish() ([]MutationResult, int) {
+	if d.stop != nil {
+		close(d.stop)
+		<-d.done
+	}
+	d.check(MutationAfter)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var mutations []MutationResult
+	for _, t := range d.targets {
+		if m, ok := d.found[t.name]; ok {
+			mutations = append(mutations, *m)
+		}
+	}
+	return mutations, d.checks
+}
+
+func (d *mutationDetector) check(phase string) {
+	elapsed := time.Since(d.start)
+	for _, t := range d.targets {
+		hash, err := stateHash(t.value)
+		if err != nil {
+			slog.Warn("Mutation check failed", "target", t.name, "error", err)
+			continue
+		}
+
+		d.mu.Lock()
+		if m, ok := d.found[t.name]; ok {
+			// Keep when the change was first seen, but report the final
+			// state.
+			m.After = hash
+		} else if hash != d.baseline[t.name] {
+			d.found[t.name] = &MutationResult{
+				Target:        t.name,
+				Phase:         phase,
+				DetectedAfter: elapsed,
+				Before:        d.baseline[t.name],
+				After:         hash,
+			}
+			slog.Warn("Shared build input mutated", "target", t.name, "phase", phase, "after", elapsed)
+		}
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	d.checks++
+	d.mu.Unlock()
+}
+
+// stateHash returns the hex SHA-256 of the canonical CBOR encoding of v.
+func stateHash(v any) (string, error) {
+	enc, err := canonicalCBOR.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(enc)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ErrDeepClone is returned when the UTxOs of a build cannot be deep cloned.
+// Sharing them instead would hide the mutations deep cloning is meant to
+// rule out, so it fails the run.
+var ErrDeepClone = errors.New("deep clone of UTxOs failed")
+
+// cloneInputs returns the UTxOs a build may use. Builds get their own slice
+// of the shared UTxOs, and with deep set also their own copy of everything
+// the UTxOs reference.
+func cloneInputs(utxos []UTxO.UTxO, deep bool) ([]UTxO.UTxO, error) {
+	if deep {
+		clone, err := deepCloneUtxos(utxos)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDeepClone, err)
+		}
+		return clone, nil
+	}
+	clonedUTxOs := make([]UTxO.UTxO, len(utxos))
+	copy(clonedUTxOs, utxos)
+	return clonedUTxOs, nil
+}
+
+// deepCloneUtxos copies utxos through a CBOR round trip, which shares no
+// maps or byte slices with the original.
+func deepCloneUtxos(utxos []UTxO.UTxO) ([]UTxO.UTxO, error) {
+	enc, err := cbor.Marshal(utxos)
+	if err != nil {
+		return nil, fmt.Errorf("encode utxos: %w", err)
+	}
+	var clone []UTxO.UTxO
+	if err := cbor.Unmarshal(enc, &clone); err != nil {
+		return nil, fmt.Errorf("decode utxos: %w", err)
+	}
+	return clone, nil
+}
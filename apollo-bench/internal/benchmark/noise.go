@@ -0,0 +1,80 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/shirou/gopsutil/load"
+)
+
+// NoiseThresholds decide when CheckNoise considers the machine too busy.
+type NoiseThresholds struct {
+	// MaxLoadPerCore is the highest acceptable 1-minute load average divided
+	// by the number of logical cores.
+	MaxLoadPerCore float64
+	// MinFreqRatio is the lowest acceptable ratio between the sampled and the
+	// maximum CPU frequency. Lower ratios point at throttling or power saving.
+	MinFreqRatio float64
+}
+
+// NoiseReport summarizes the load and CPU frequency sampled before a run.
+// LoadAvg1 is the highest 1-minute load average seen across samples.
+type NoiseReport struct {
+	Samples     int      `json:"samples"`
+	LoadAvg1    float64  `json:"load_avg_1"`
+	LoadPerCore float64  `json:"load_per_core"`
+	MinCPUMhz   float64  `json:"min_cpu_mhz"`
+	MaxCPUMhz   float64  `json:"max_cpu_mhz"`
+	CPUMaxMhz   float64  `json:"cpu_max_mhz"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// CheckNoise samples load average and CPU frequency samples times, interval
+// apart, and returns warnings for anything outside the thresholds.
+func CheckNoise(ctx context.Context, samples int, interval time.Duration, th NoiseThresholds) (NoiseReport, error) {
+	report := NoiseReport{}
+	if khz, err := strconv.ParseFloat(readSysFile("/sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq"), 64); err == nil {
+		report.CPUMaxMhz = khz / 1000
+	}
+
+	for i := range samples {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+
+		if avg, err := load.Avg(); err == nil {
+			report.LoadAvg1 = max(report.LoadAvg1, avg.Load1)
+		}
+		if mhz, ok := readCPUScalingMhz(); ok {
+			if report.MinCPUMhz == 0 || mhz < report.MinCPUMhz {
+				report.MinCPUMhz = mhz
+			}
+			report.MaxCPUMhz = max(report.MaxCPUMhz, mhz)
+		}
+		report.Samples++
+	}
+
+	report.LoadPerCore = report.LoadAvg1 / float64(runtime.NumCPU())
+	if th.MaxLoadPerCore > 0 && report.LoadPerCore > th.MaxLoadPerCore {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"load average %.2f is %.2f per core, above the %.2f threshold", report.LoadAvg1, report.LoadPerCore, th.MaxLoadPerCore))
+	}
+	if th.MinFreqRatio > 0 && report.CPUMaxMhz > 0 && report.MinCPUMhz > 0 {
+		if ratio := report.MinCPUMhz / report.CPUMaxMhz; ratio < th.MinFreqRatio {
+			report.Warnings = append(report.Warnings, fmt.Sprintf(
+				"CPU frequency dropped to %.0f MHz, %.0f%% of the %.0f MHz maximum", report.MinCPUMhz, ratio*100, report.CPUMaxMhz))
+		}
+	}
+	if governor := readSysFile("/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor"); governor != "" && governor != "performance" {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"CPU frequency governor is %q, use \"performance\" for stable results", governor))
+	}
+	return report, nil
+}
@@ -0,0 +1,153 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Arrival processes of open-loop runs.
+const (
+	// ArrivalsPoisson spaces arrivals by exponentially distributed gaps, like
+	// independent clients.
+	ArrivalsPoisson = "poisson"
+	// ArrivalsUniform spaces arrivals evenly.
+	ArrivalsUniform = "uniform"
+)
+
+// ArrivalProcesses returns the names accepted as arrival processes.
+func ArrivalProcesses() []string {
+	return []string{ArrivalsPoisson, ArrivalsUniform}
+}
+
+// openLoop generates builds at a fixed arrival rate regardless of how fast
+// they complete, so queueing shows up in the latency the way it does for a
+// service under load. Latency is measured from the scheduled arrival, not
+// from when a worker picked the build up, which avoids coordinated omission.
+type openLoop struct {
+	rate        float64
+	parallelism int
+	// maxQueue bounds the arrivals waiting for a worker, arrivals finding
+	// the queue full are dropped.
+	maxQueue int
+	arrivals string
+	rng      *rand.Rand
+	// drop, if set, is called for every dropped arrival.
+	drop func()
+}
+
+type arrival struct {
+	iter int
+	at   time.Time
+}
+
+// gap returns the time to the next arrival.
+func (o openLoop) gap() time.Duration {
+	mean := float64(time.Second) / o.rate
+	if o.arrivals == ArrivalsPoisson {
+		return time.Duration(o.rng.ExpFloat64() * mean)
+	}
+	return time.Duration(mean)
+}
+
+// run schedules arrivals for duration, starting at iteration first, and
+// waits for the accepted ones to finish. record is called concurrently by
+// the workers with every build's result and its latency since arrival. It
+// returns the number of arrivals and how many of them were dropped.
+func (o openLoop) run(ctx context.Context, first int, duration time.Duration, fn func(iter int) Result, record func(res Result, latency time.Duration)) (arrived, dropped int) {
+	queue := make(chan arrival, o.maxQueue)
+	var wg sync.WaitGroup
+	for w := 0; w < o.parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range queue {
+				res := callIteration(fn, a.iter)
+				record(res, time.Since(a.at))
+			}
+		}()
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	start := time.Now()
+	next := start
+	for ctx.Err() == nil && next.Sub(start) < duration {
+		if wait := time.Until(next); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				continue
+			case <-timer.C:
+			}
+		}
+		// Arrivals that fell behind schedule keep their scheduled time, so
+		// a late scheduler counts against latency instead of hiding it.
+		select {
+		case queue <- arrival{iter: first + arrived, at: next}:
+		default:
+			dropped++
+			if o.drop != nil {
+				o.drop()
+			}
+		}
+		arrived++
+		next = next.Add(o.gap())
+	}
+	close(queue)
+	wg.Wait()
+	return arrived, dropped
+}
+
+// callIteration runs fn, reporting a panic as a failed result like runBatch.
+func callIteration(fn func(iter int) Result, iter int) (res Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = Result{Iteration: iter, Error: fmt.Errorf("panic: %v", r), Panic: true, Stack: debug.Stack()}
+			slog.Error("Panic during iteration", "iteration", iter, "panic", r)
+		}
+	}()
+	res = fn(iter)
+	if res.Error != nil {
+		slog.Warn("Transaction build failed", "iteration", iter, "error", res.Error)
+	}
+	return res
+}
+
+// Percentile returns the p-th percentile (0 to 100) of sorted using the
+// nearest-rank method.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// LatencyPercentiles are latency percentiles of a set of builds.
+type LatencyPercentiles struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// percentiles sorts latencies and returns their percentiles.
+func percentiles(latencies []time.Duration) LatencyPercentiles {
+	sort.Slice(latencies, func(a, b int) bool { return latencies[a] < latencies[b] })
+	return LatencyPercentiles{
+		P50: Percentile(latencies, 50),
+		P90: Percentile(latencies, 90),
+		P99: Percentile(latencies, 99),
+		Max: Percentile(latencies, 100),
+	}
+}
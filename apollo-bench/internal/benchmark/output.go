@@ -3,8 +3,8 @@ package benchmark
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"runtime"
 	"strconv"
 	"time"
 
@@ -13,46 +13,88 @@ import (
 )
 
 type BenchmarkResult struct {
-	WallClockTPS  float64       `json:"wall_clock_tps"`
-	LatencyTPS    float64       `json:"latency_tps"`
-	AvgLatency    time.Duration `json:"avg_latency"`
-	Failures      int           `json:"failures"`
-	Iterations    int           `json:"iterations"`
-	Parallelism   int           `json:"parallelism"`
-	UTXOInput     int           `json:"utxo_input"`
-	UTXOOutput    int           `json:"utxo_output"`
-	SystemInfo    SystemInfo    `json:"system_info"`
-	BenchDuration time.Duration `json:"bench_duration"`
+	Scenario         string        `json:"scenario"`
+	Network          string        `json:"network"`
+	Sender           string        `json:"sender"`
+	SenderType       string        `json:"sender_type"`
+	Receiver         string        `json:"receiver"`
+	ReceiverType     string        `json:"receiver_type"`
+	WallClockTPS     float64       `json:"wall_clock_tps"`
+	LatencyTPS       float64       `json:"latency_tps"`
+	AvgLatency       time.Duration `json:"avg_latency"`
+	LatencyCI95      time.Duration `json:"latency_ci95"`
+	LatencyCI95Rel   float64       `json:"latency_ci95_rel"`
+	TargetCI         float64       `json:"target_ci,omitempty"`
+	Failures         int           `json:"failures"`
+	Iterations       int           `json:"iterations"`
+	Parallelism      int           `json:"parallelism"`
+	UTXOInput        int           `json:"utxo_input"`
+	UTXOOutput       int           `json:"utxo_output"`
+	WarmupIterations int           `json:"warmup_iterations"`
+	// Backend* describe the injected chain context latency, if any.
+	BackendLatency    string        `json:"backend_latency,omitempty"`
+	BackendCallsPerTx float64       `json:"backend_calls_per_tx,omitempty"`
+	BackendDelayPerTx time.Duration `json:"backend_delay_per_tx,omitempty"`
+	BackendTimeShare  float64       `json:"backend_time_share,omitempty"`
+	BackendErrors     int64         `json:"backend_errors,omitempty"`
+	// BackendRequestsPerTx counts HTTP or RPC requests for scenarios that
+	// talk to a mock backend server.
+	BackendRequestsPerTx float64 `json:"backend_requests_per_tx,omitempty"`
+	// OutputShape is the native token shape of the requested outputs and
+	// OutputAssets the number of assets they carry in total.
+	OutputShape  string `json:"output_shape,omitempty"`
+	OutputAssets int    `json:"output_assets,omitempty"`
+	// Feature describes the builder feature of a feature scenario and TxSize
+	// the size of the transaction it builds.
+	Feature string `json:"feature,omitempty"`
+	TxSize  int    `json:"tx_size,omitempty"`
+	// ExpectedError is the error category of an expected-failure scenario.
+	// Its iterations failing with another error or succeeding are counted
+	// in Failures and split into WrongErrors and UnexpectedSuccesses.
+	ExpectedError       string `json:"expected_error,omitempty"`
+	UnexpectedSuccesses int    `json:"unexpected_successes,omitempty"`
+	WrongErrors         int    `json:"wrong_errors,omitempty"`
+	// MutationChecks counts the hashes of the shared build inputs taken
+	// by --detect-mutation, Mutations lists the inputs that changed.
+	MutationChecks int              `json:"mutation_checks,omitempty"`
+	Mutations      []MutationResult `json:"mutations,omitempty"`
+	DeepClone      bool             `json:"deep_clone,omitempty"`
+	// MintSteps is the mint map growth probe of the mint scenario.
+	MintSteps []MintStepResult `json:"mint_steps,omitempty"`
+	// Addresses and AddressMix describe the wallet the UTxOs were spread
+	// over, AddressTypes the per-type probe of a mixed wallet.
+	Addresses    int                 `json:"addresses,omitempty"`
+	AddressMix   string              `json:"address_mix,omitempty"`
+	AddressTypes []AddressTypeResult `json:"address_types,omitempty"`
+	// CPUHotspots and AllocHotspots list the top functions of the CPU and
+	// alloc profiles of the measured iterations.
+	CPUHotspots   *ProfileSummary `json:"cpu_hotspots,omitempty"`
+	AllocHotspots *ProfileSummary `json:"alloc_hotspots,omitempty"`
+	SystemInfo    SystemInfo      `json:"system_info"`
+	BenchDuration time.Duration   `json:"bench_duration"`
+	// Trial is the 1-based number of the trial of a run with several
+	// trials.
+	Trial int `json:"trial,omitempty"`
 }
 
-func PrintResults(wallClockTPS, latencyTPS float64, avgLatency time.Duration,
-	failures, iterations, parallelism, utxoInput, utxoOutput int, benchDuration time.Duration,
-	format string) {
-
-	result := BenchmarkResult{
-		WallClockTPS:  wallClockTPS,
-		LatencyTPS:    latencyTPS,
-		AvgLatency:    avgLatency,
-		Failures:      failures,
-		Iterations:    iterations,
-		Parallelism:   parallelism,
-		UTXOInput:     utxoInput,
-		UTXOOutput:    utxoOutput,
-		SystemInfo:    GetSystemInfo(),
-		BenchDuration: benchDuration,
-	}
-
+func PrintResults(result BenchmarkResult, format string) error {
 	switch format {
 	case "json":
-		encoder := json.NewEncoder(os.Stdout)
-		encoder.SetIndent("", "  ")
-		if err := encoder.Encode(result); err != nil {
-			color.Red("Failed to encode JSON: %v", err)
-			os.Exit(1)
-		}
+		return WriteJSON(os.Stdout, result)
 	default:
 		printColorfulTable(result)
 	}
+	return nil
+}
+
+// WriteJSON writes result to w as indented JSON.
+func WriteJSON(w io.Writer, result BenchmarkResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("encode JSON: %w", err)
+	}
+	return nil
 }
 
 func printColorfulTable(result BenchmarkResult) {
@@ -76,8 +118,24 @@ func printColorfulTable(result BenchmarkResult) {
 		"Actual transactions processed per second")
 	addRow(table, "Latency-based Tx/s", fmt.Sprintf("%.2f", result.LatencyTPS),
 		"Theoretical maximum based on average latency")
-	addRow(table, "Avg Latency/Transaction", result.AvgLatency.Round(time.Microsecond).String(),
-		"Mean time to build and validate one transaction")
+	latencyDescription := "Mean time to build and validate one transaction"
+	if result.ExpectedError != "" {
+		latencyDescription = "Mean time until a build failed as expected"
+	}
+	addRow(table, "Avg Latency/Transaction", result.AvgLatency.Round(time.Microsecond).String(), latencyDescription)
+	precision := fmt.Sprintf("±%s (±%.2f%%)", result.LatencyCI95.Round(time.Nanosecond), result.LatencyCI95Rel*100)
+	if result.TargetCI > 0 {
+		target := fmt.Sprintf("target width %.2f%% (±%.2f%%)", result.TargetCI*100, result.TargetCI*50)
+		if 2*result.LatencyCI95Rel > result.TargetCI {
+			precision = color.HiRedString(precision)
+			target += ", not reached"
+		} else {
+			precision = color.HiGreenString(precision)
+		}
+		addRow(table, "Latency 95% CI", precision, "Precision of the mean latency, "+target)
+	} else {
+		addRow(table, "Latency 95% CI", precision, "Precision of the mean latency")
+	}
 
 	// Failure Analysis Section
 	addSectionHeader("FAILURE ANALYSIS")
@@ -87,24 +145,153 @@ func printColorfulTable(result BenchmarkResult) {
 	} else {
 		failureStatus = color.HiGreenString(failureStatus)
 	}
-	addRow(table, "Failed Transactions", failureStatus,
-		"Total failed transaction constructions")
+	if result.ExpectedError != "" {
+		addRow(table, "Failed Transactions", failureStatus,
+			fmt.Sprintf("Builds that did not fail with %s", result.ExpectedError))
+		addRow(table, "Unexpected Successes", strconv.Itoa(result.UnexpectedSuccesses), "Builds that returned a transaction")
+		addRow(table, "Wrong Errors", strconv.Itoa(result.WrongErrors), "Builds that failed with another error")
+	} else {
+		addRow(table, "Failed Transactions", failureStatus,
+			"Total failed transaction constructions")
+	}
 
 	// Configuration Section
 	addSectionHeader("BENCHMARK CONFIGURATION")
+	addRow(table, "Scenario", result.Scenario, ScenarioDescription(result.Scenario))
+	addRow(table, "Network", result.Network, "")
+	addRow(table, "Sender", result.SenderType, result.Sender)
+	addRow(table, "Receiver", result.ReceiverType, result.Receiver)
 	addRow(table, "Iterations", strconv.Itoa(result.Iterations), "")
+	addRow(table, "Warm-up Iterations", strconv.Itoa(result.WarmupIterations), "Discarded builds run before measuring")
 	addRow(table, "Parallel Workers", strconv.Itoa(result.Parallelism), "")
 	addRow(table, "Inputs per TX", strconv.Itoa(result.UTXOInput), "")
 	addRow(table, "Outputs per TX", strconv.Itoa(result.UTXOOutput), "")
+	if result.OutputShape != "" {
+		addRow(table, "Output Shape", fmt.Sprintf("%s (%d assets)", result.OutputShape, result.OutputAssets),
+			"Outputs carry "+outputShapes[result.OutputShape])
+	}
+	if result.Feature != "" {
+		addRow(table, "Builder Feature", result.Feature, "")
+	}
+	if result.TxSize > 0 {
+		addRow(table, "Transaction Size", fmt.Sprintf("%d bytes", result.TxSize), "Size of the built transaction")
+	}
+	if result.Addresses > 0 {
+		addRow(table, "Wallet Addresses", fmt.Sprintf("%d (%s)", result.Addresses, result.AddressMix),
+			"Addresses the input UTxOs are spread over")
+	}
 	addRow(table, "Total Duration", result.BenchDuration.Round(time.Millisecond).String(), "")
 
+	if result.BackendLatency != "" {
+		addSectionHeader("BACKEND LATENCY")
+		addRow(table, "Latency Profile", result.BackendLatency, "Injected per-method chain context latency")
+		addRow(table, "Backend Calls/Transaction", fmt.Sprintf("%.2f", result.BackendCallsPerTx), "")
+		addRow(table, "Backend Time/Transaction", result.BackendDelayPerTx.Round(time.Microsecond).String(),
+			"Injected delay spent per build")
+		addRow(table, "Backend Share of Latency", fmt.Sprintf("%.1f%%", result.BackendTimeShare*100),
+			"Fraction of build time spent waiting on the backend")
+		backendErrors := strconv.FormatInt(result.BackendErrors, 10)
+		if result.BackendErrors > 0 {
+			backendErrors = color.HiRedString(backendErrors)
+		}
+		addRow(table, "Injected Errors", backendErrors, "")
+	}
+
+	if result.BackendRequestsPerTx > 0 {
+		addSectionHeader("MOCK BACKEND")
+		addRow(table, "Requests/Transaction", fmt.Sprintf("%.2f", result.BackendRequestsPerTx),
+			"Requests the chain context sent per build")
+	}
+
+	if result.MutationChecks > 0 {
+		addSectionHeader("MUTATION DETECTION")
+		inputs := "Builds shared the UTxOs' maps and byte slices"
+		if result.DeepClone {
+			inputs = "Builds got deep copies of the UTxOs"
+		}
+		if len(result.Mutations) == 0 {
+			addRow(table, "Shared Inputs", color.HiGreenString("unchanged"),
+				fmt.Sprintf("%d checks of the UTxOs and outputs. %s", result.MutationChecks, inputs))
+		}
+		for _, m := range result.Mutations {
+			addRow(table, m.Target, color.HiRedString("mutated "+m.Phase+" the run"),
+				fmt.Sprintf("First seen after %s, hash %.12s -> %.12s", m.DetectedAfter.Round(time.Millisecond), m.Before, m.After))
+		}
+	}
+
+	if len(result.MintSteps) > 0 {
+		addSectionHeader("MINT MAP GROWTH")
+		for _, step := range result.MintSteps {
+			value := fmt.Sprintf("%s, %d bytes", step.AvgLatency.Round(time.Microsecond), step.TxSize)
+			description := fmt.Sprintf("%d/%d failed", step.Failures, step.Iterations)
+			if step.FirstError != "" {
+				value = color.HiRedString(value)
+				description += ": " + step.FirstError
+			}
+			addRow(table, fmt.Sprintf("%d asset(s), %d policies", step.Assets, step.Policies), value, description)
+		}
+	}
+
+	if len(result.AddressTypes) > 0 {
+		addSectionHeader("ADDRESS TYPES")
+		for _, at := range result.AddressTypes {
+			value := fmt.Sprintf("%s (x%.2f)", at.AvgLatency.Round(time.Microsecond), at.Slowdown)
+			description := fmt.Sprintf("%d/%d failed over %d address(es)", at.Failures, at.Iterations, at.Addresses)
+			if at.FirstError != "" {
+				description += ": " + at.FirstError
+			}
+			if at.Degraded {
+				value = color.HiRedString(value)
+			} else {
+				value = color.HiGreenString(value)
+			}
+			addRow(table, at.Type, value, description)
+		}
+	}
+
+	addHotspots := func(title string, summary *ProfileSummary) {
+		if summary == nil {
+			return
+		}
+		addSectionHeader(title)
+		addRow(table, "Profile", summary.File,
+			fmt.Sprintf("%s total, top %d functions by flat value", formatProfileValue(float64(summary.Total), summary.Unit), len(summary.TopFlat)))
+		for _, h := range summary.TopFlat {
+			addRow(table, h.Function,
+				fmt.Sprintf("%.2f%% flat, %.2f%% cum", h.FlatShare*100, h.CumShare*100),
+				fmt.Sprintf("%s flat, %s cum", formatProfileValue(float64(h.Flat), summary.Unit), formatProfileValue(float64(h.Cum), summary.Unit)))
+		}
+	}
+	addHotspots("CPU HOTSPOTS", result.CPUHotspots)
+	addHotspots("ALLOCATION HOTSPOTS", result.AllocHotspots)
+
 	// System Info Section
 	addSectionHeader("SYSTEM INFORMATION")
 	addRow(table, "CPU Model", result.SystemInfo.CPUModel, "")
 	addRow(table, "Total Memory", fmt.Sprintf("%d GB", result.SystemInfo.TotalMemory/1e9), "")
 	addRow(table, "Available Memory", fmt.Sprintf("%d GB", result.SystemInfo.AvailableMem/1e9), "")
+	addRow(table, "CPU Frequency", fmt.Sprintf("%.0f MHz", result.SystemInfo.CPUMhz), result.SystemInfo.CPUGovernor)
+	addRow(table, "Cores (logical/physical)",
+		fmt.Sprintf("%d/%d", result.SystemInfo.LogicalCores, result.SystemInfo.PhysicalCores), "")
+	addRow(table, "GOMAXPROCS", strconv.Itoa(result.SystemInfo.GOMAXPROCS), "")
+	addRow(table, "Cgroup CPU Limit", formatCgroupCPU(result.SystemInfo.CgroupCPULimit), "")
+	addRow(table, "Cgroup Memory Limit", formatCgroupMemory(result.SystemInfo.CgroupMemoryLimit), "")
+	addRow(table, "Load Average", fmt.Sprintf("%.2f %.2f %.2f",
+		result.SystemInfo.LoadAvg1, result.SystemInfo.LoadAvg5, result.SystemInfo.LoadAvg15),
+		"1, 5 and 15 minute load at the end of the run")
 	addRow(table, "Go Version", result.SystemInfo.GoVersion, "")
-	addRow(table, "OS/Arch", fmt.Sprintf("%s/%s", result.SystemInfo.OS, runtime.GOARCH), "")
+	addRow(table, "OS/Arch", fmt.Sprintf("%s/%s", result.SystemInfo.OS, result.SystemInfo.Arch), "")
+
+	// Build Info Section
+	addSectionHeader("BUILD INFORMATION")
+	addRow(table, "Apollo Version", result.SystemInfo.ApolloVersion, result.SystemInfo.ApolloReplace)
+	suiteRevision := result.SystemInfo.SuiteRevision
+	if suiteRevision == "" {
+		suiteRevision = "unknown"
+	} else if result.SystemInfo.SuiteModified {
+		suiteRevision += " (modified)"
+	}
+	addRow(table, "Suite Revision", suiteRevision, result.SystemInfo.SuiteVCSTime)
 
 	// Efficiency Section
 	addSectionHeader("EFFICIENCY ANALYSIS")
@@ -116,6 +303,20 @@ func printColorfulTable(result BenchmarkResult) {
 	table.Render()
 }
 
+func formatCgroupCPU(limit float64) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.2f cores", limit)
+}
+
+func formatCgroupMemory(limit uint64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.2f GB", float64(limit)/1e9)
+}
+
 func addRow(table *tablewriter.Table, metric, value, description string) {
 	table.Append([]string{metric, value, description})
 }
@@ -0,0 +1,289 @@
+package benchmark
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sort"
+
+	"github.com/Salvionied/apollo"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+)
+
+// Output shapes accepted by Config.OutputShape.
+const (
+	// OutputShapeLovelace pays ADA only.
+	OutputShapeLovelace = "lovelace"
+	// OutputShapeRandomAssets adds a random subset of the wallet's assets
+	// to every output.
+	OutputShapeRandomAssets = "random-assets"
+	// OutputShapeMultiPolicy adds one asset of each of several policies to
+	// every output.
+	OutputShapeMultiPolicy = "multi-policy"
+	// OutputShapeNFTBundle adds single units of assets no other output
+	// carries, like a bundle of NFTs.
+	OutputShapeNFTBundle = "nft-bundle"
+)
+
+// outputShapeSeed seeds the asset selection, so every run of a shape
+// requests the same outputs.
+const outputShapeSeed = 0x61706f6c6c6f
+
+var outputShapes = map[string]string{
+	OutputShapeLovelace:     "ADA only",
+	OutputShapeRandomAssets: "a random subset of the wallet's assets",
+	OutputShapeMultiPolicy:  "one asset of each of several policies",
+	OutputShapeNFTBundle:    "single units of assets no other output carries",
+}
+
+// OutputShapes returns the names of all output shapes, sorted.
+func OutputShapes() []string {
+	names := make([]string, 0, len(outputShapes))
+	for name := range outputShapes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupOutputShape(name string) error {
+	if _, ok := outputShapes[name]; !ok {
+		return fmt.Errorf("unknown output shape %q (available: %v)", name, OutputShapes())
+	}
+	return nil
+}
+
+// walletAsset is one asset held by the wallet.
+type walletAsset struct {
+	policy string
+	name   string
+	// holders are the indices of the UTxOs holding the asset and spendable
+	// the smallest quantity any of them holds.
+	holders   map[int]bool
+	spendable int64
+	// outputs counts the outputs the asset was added to.
+	outputs int64
+}
+
+// walletAssets returns the assets held by utxos, sorted by policy and name.
+func walletAssets(utxos []UTxO.UTxO) []*walletAsset {
+	byUnit := make(map[string]*walletAsset)
+	for i, u := range utxos {
+		for policy, assets := range u.Output.GetValue().GetAssets() {
+			for name, quantity := range assets {
+				if quantity <= 0 {
+					continue
+				}
+				key := policy.Value + "." + name.HexString()
+				a, ok := byUnit[key]
+				if !ok {
+					a = &walletAsset{policy: policy.Value, name: name.String(), holders: make(map[int]bool), spendable: quantity}
+					byUnit[key] = a
+				}
+				a.holders[i] = true
+				a.spendable = min(a.spendable, quantity)
+			}
+		}
+	}
+	inventory := make([]*walletAsset, 0, len(byUnit))
+	for _, a := range byUnit {
+		inventory = append(inventory, a)
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].policy != inventory[j].policy {
+			return inventory[i].policy < inventory[j].policy
+		}
+		return inventory[i].name < inventory[j].name
+	})
+	return inventory
+}
+
+// sharesHolder reports whether a UTxO holds both a and b.
+func (a *walletAsset) sharesHolder(b *walletAsset) bool {
+	small, large := a.holders, b.holders
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	for i := range small {
+		if large[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// fundableAssets returns the candidates, in order, that the outputs can
+// request together and Apollo can still fund.
+//
+// Apollo selects the inputs of every requested asset in turn, in map order,
+// taking the first unselected UTxOs holding it without counting the inputs
+// already selected for other assets. Requesting at most the spendable
+// quantity, an asset takes exactly one UTxO, so whatever the order an asset
+// can be funded when it has more holders than there are other requested
+// assets sharing a holder with it. Candidates breaking that for themselves
+// or an asset already chosen are skipped.
+func fundableAssets(candidates []*walletAsset) []*walletAsset {
+	var (
+		chosen []*walletAsset
+		// sharing counts the chosen assets sharing a holder with each.
+		sharing []int
+	)
+	for _, c := range candidates {
+		var shared []int
+		fits := true
+		for i, a := range chosen {
+			if !a.sharesHolder(c) {
+				continue
+			}
+			if len(a.holders) <= sharing[i]+1 {
+				fits = false
+				break
+			}
+			shared = append(shared, i)
+		}
+		if !fits || len(c.holders) <= len(shared) {
+			continue
+		}
+		for _, i := range shared {
+			sharing[i]++
+		}
+		chosen = append(chosen, c)
+		sharing = append(sharing, len(shared))
+	}
+	return chosen
+}
+
+// add adds a to the assets of an output, unless every spendable unit is
+// already taken.
+func (a *walletAsset) add(assets *[]*walletAsset) bool {
+	if a.outputs == a.spendable {
+		return false
+	}
+	a.outputs++
+	*assets = append(*assets, a)
+	return true
+}
+
+// ShapeOutputs returns a copy of outputs with up to perOutput native tokens
+// of the given shape added to each, drawn from the assets held by utxos.
+// Only assets Apollo can fund together are requested, see fundableAssets,
+// and every output gets an equal share of an asset's spendable quantity, so
+// the outputs can always be funded from utxos. Outputs get fewer tokens when
+// the wallet holds too few such assets.
+func ShapeOutputs(outputs []Output, shape string, perOutput int, utxos []UTxO.UTxO) ([]Output, error) {
+	if err := lookupOutputShape(shape); err != nil {
+		return nil, err
+	}
+	shaped := make([]Output, len(outputs))
+	copy(shaped, outputs)
+	if shape == OutputShapeLovelace {
+		return shaped, nil
+	}
+
+	inventory := walletAssets(utxos)
+	if len(inventory) == 0 {
+		return nil, fmt.Errorf("output shape %s needs native assets, but the wallet holds none", shape)
+	}
+
+	var (
+		added []*walletAsset
+		// picks holds the assets added to every output.
+		picks = make([][]*walletAsset, len(shaped))
+	)
+	switch shape {
+	case OutputShapeRandomAssets:
+		rng := rand.New(rand.NewPCG(outputShapeSeed, 0))
+		candidates := make([]*walletAsset, len(inventory))
+		for i, idx := range rng.Perm(len(inventory)) {
+			candidates[i] = inventory[idx]
+		}
+		added = fundableAssets(candidates)
+		for i := range shaped {
+			n := 0
+			for _, idx := range rng.Perm(len(added)) {
+				if n == perOutput {
+					break
+				}
+				if added[idx].add(&picks[i]) {
+					n++
+				}
+			}
+		}
+
+	case OutputShapeMultiPolicy:
+		// Prefer the first asset of every policy over the second of any, so
+		// the chosen assets span as many policies as possible.
+		var byPolicy [][]*walletAsset
+		for i, a := range inventory {
+			if i == 0 || a.policy != inventory[i-1].policy {
+				byPolicy = append(byPolicy, nil)
+			}
+			byPolicy[len(byPolicy)-1] = append(byPolicy[len(byPolicy)-1], a)
+		}
+		var candidates []*walletAsset
+		for rank := 0; len(candidates) < len(inventory); rank++ {
+			for _, assets := range byPolicy {
+				if rank < len(assets) {
+					candidates = append(candidates, assets[rank])
+				}
+			}
+		}
+		added = fundableAssets(candidates)
+
+		var policies [][]*walletAsset
+		for _, a := range added {
+			p := slices.IndexFunc(policies, func(assets []*walletAsset) bool { return assets[0].policy == a.policy })
+			if p < 0 {
+				policies = append(policies, nil)
+				p = len(policies) - 1
+			}
+			policies[p] = append(policies[p], a)
+		}
+		next := make([]int, len(policies))
+		for i := range shaped {
+			// Rotate the policies so every one of them is used.
+			for m := range min(perOutput, len(policies)) {
+				p := (i + m) % len(policies)
+				assets := policies[p]
+				for range assets {
+					a := assets[next[p]%len(assets)]
+					next[p]++
+					if a.add(&picks[i]) {
+						break
+					}
+				}
+			}
+		}
+
+	case OutputShapeNFTBundle:
+		added = fundableAssets(inventory)
+		next := 0
+		for i := range shaped {
+			for range perOutput {
+				if next == len(added) {
+					break
+				}
+				added[next].add(&picks[i])
+				next++
+			}
+		}
+	}
+
+	requested := 0
+	for i, assets := range picks {
+		for _, a := range assets {
+			quantity := a.spendable / a.outputs
+			if shape == OutputShapeNFTBundle {
+				quantity = 1
+			}
+			shaped[i].Units = append(shaped[i].Units, apollo.NewUnit(a.policy, a.name, int(quantity)))
+		}
+		requested += len(assets)
+	}
+	if want := len(shaped) * perOutput; requested < want {
+		slog.Warn("Wallet holds too few assets Apollo can fund together for the output shape",
+			"shape", shape, "fundableAssets", len(added), "requested", requested, "wanted", want)
+	}
+	return shaped, nil
+}
@@ -0,0 +1,53 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+)
+
+// TestShapeOutputsBuild builds every output shape at every UTxO level with
+// the default inputs. The congested wallet holds 2 ADA per UTxO, too little
+// for the default 10 outputs of 2 ADA of any shape, so it pays 5.
+func TestShapeOutputsBuild(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	tests := []struct {
+		level, outputs int
+	}{
+		{1, 10},
+		{2, 10},
+		{3, 5},
+	}
+	for _, tt := range tests {
+		for _, shape := range OutputShapes() {
+			t.Run(fmt.Sprintf("level%d/%s", tt.level, shape), func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.UTxOLevel = tt.level
+				cfg.UTxOOutput = tt.outputs
+				cfg.OutputShape = shape
+
+				env, _, _, err := newScenarioEnv(cfg, FixedChainContext.InitFixedChainContext())
+				if err != nil {
+					t.Fatalf("shape outputs: %v", err)
+				}
+				units := 0
+				for _, out := range env.outputs {
+					units += len(out.Units)
+				}
+				if shape != OutputShapeLovelace && units == 0 {
+					t.Fatalf("no assets requested")
+				}
+				// Apollo funds assets in map order, build a few times.
+				for range 5 {
+					if _, err := buildTransaction(env.utxos, &env.sender, env.chainCtx, env.outputs); err != nil {
+						t.Fatalf("build %d asset(s): %v", units, err)
+					}
+				}
+			})
+		}
+	}
+}
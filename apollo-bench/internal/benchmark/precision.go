@@ -0,0 +1,70 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrecisionConfig makes a run keep adding batches of iterations until the
+// mean latency is known precisely enough.
+type PrecisionConfig struct {
+	// TargetCI is the target full width of the 95% confidence interval of
+	// the mean latency, relative to the mean (0.01 = 1%, that is ±0.5%).
+	// Zero disables it.
+	TargetCI float64
+	// MaxDuration bounds the time spent measuring, including the first batch.
+	// It is required with TargetCI.
+	MaxDuration time.Duration
+}
+
+// ParseRelative parses a relative width given as a percentage ("1%") or a
+// fraction ("0.01").
+func ParseRelative(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	percent := strings.HasSuffix(value, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid relative width %q", value)
+	}
+	if percent {
+		f /= 100
+	}
+	return f, nil
+}
+
+// runUntilPrecise runs further batches of batchSize iterations until the
+// confidence interval target or the time limit is reached.
+func runUntilPrecise(ctx context.Context, results []Result, batchSize, parallelism int, start time.Time, cfg PrecisionConfig, fn func(iter int) Result) []Result {
+	for ctx.Err() == nil {
+		// latencyPrecision reports the half-width, the target is the width.
+		ci, rel, ok := latencyPrecision(results)
+		width := 2 * rel
+		if ok && width <= cfg.TargetCI {
+			slog.Info("Target confidence interval reached",
+				"iterations", len(results),
+				"latencyCI95", ci,
+				"latencyCI95Width", width,
+				"targetCI", cfg.TargetCI)
+			return results
+		}
+		if time.Since(start) >= cfg.MaxDuration {
+			slog.Warn("Time limit reached before target confidence interval",
+				"iterations", len(results),
+				"latencyCI95Width", width,
+				"targetCI", cfg.TargetCI,
+				"maxDuration", cfg.MaxDuration)
+			return results
+		}
+
+		slog.Debug("Running another batch", "iterations", len(results), "latencyCI95Width", width, "targetCI", cfg.TargetCI)
+		results = append(results, runBatch(ctx, len(results), batchSize, parallelism, fn)...)
+	}
+	return results
+}
@@ -0,0 +1,332 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Salvionied/apollo"
+	"github.com/Salvionied/apollo/constants"
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
+	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+	"github.com/Salvionied/cbor/v2"
+)
+
+const (
+	reproducerFile = "reproducer.json"
+	utxosFile      = "utxos.cbor"
+)
+
+// ErrNotReproduced is wrapped by the error of a replay whose build succeeded
+// or failed differently than recorded.
+var ErrNotReproduced = errors.New("failure did not reproduce")
+
+// Output is a single payment requested from the builder.
+type Output struct {
+	Address  Address.Address
+	Lovelace int
+	// Units are the native tokens paid next to the lovelace, see
+	// ShapeOutputs.
+	Units []apollo.Unit
+}
+
+// ReproducerOutput is the serialized form of an Output.
+type ReproducerOutput struct {
+	Address  string           `json:"address"`
+	Lovelace int              `json:"lovelace"`
+	Units    []ReproducerUnit `json:"units,omitempty"`
+}
+
+// ReproducerUnit is the serialized form of a native token of an Output.
+type ReproducerUnit struct {
+	PolicyId string `json:"policy_id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// Reproducer holds everything needed to re-execute a failing build. The UTxO
+// set lives next to it in utxos.cbor.
+type Reproducer struct {
+	ApolloVersion string    `json:"apollo_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Iteration     int       `json:"iteration"`
+	Occurrences   int       `json:"occurrences"`
+	Error         string    `json:"error"`
+	Panic         bool      `json:"panic"`
+	Stack         string    `json:"stack,omitempty"`
+	// Scenario is the scenario that built the transaction, Mint and
+	// Features its parameters. Bundles without one replay a payment.
+	Scenario  string         `json:"scenario,omitempty"`
+	Mint      *MintConfig    `json:"mint,omitempty"`
+	Features  *FeatureConfig `json:"features,omitempty"`
+	UTXOLevel int            `json:"utxo_level"`
+	// ChangeAddress is the sender wallet the builds spend and pay change to,
+	// and the scenario derives policies and stake credentials from.
+	ChangeAddress  string                  `json:"change_address"`
+	Outputs        []ReproducerOutput      `json:"outputs"`
+	ProtocolParams Base.ProtocolParameters `json:"protocol_params"`
+	GenesisParams  Base.GenesisParameters  `json:"genesis_params"`
+}
+
+// ReproducerWriter writes one bundle per distinct failure class seen during a
+// run.
+type ReproducerWriter struct {
+	dir       string
+	utxosCbor []byte
+	base      Reproducer
+	bundles   map[string]*reproducerBundle
+	order     []string
+}
+
+type reproducerBundle struct {
+	dir   string
+	repro Reproducer
+}
+
+// NewReproducerWriter returns a writer of bundles to dir for failed builds of
+// cfg.Scenario, which spend utxos of sender paying outputs against ctx.
+func NewReproducerWriter(dir string, cfg Config, sender Address.Address, utxos []UTxO.UTxO, outputs []Output, ctx FixedChainContext.FixedChainContext) (*ReproducerWriter, error) {
+	utxosCbor, err := cbor.Marshal(utxos)
+	if err != nil {
+		return nil, fmt.Errorf("encode utxos: %w", err)
+	}
+
+	reproOutputs := make([]ReproducerOutput, len(outputs))
+	for i, out := range outputs {
+		reproOutputs[i] = ReproducerOutput{Address: out.Address.String(), Lovelace: out.Lovelace}
+		for _, unit := range out.Units {
+			reproOutputs[i].Units = append(reproOutputs[i].Units, ReproducerUnit{
+				PolicyId: unit.PolicyId,
+				Name:     unit.Name,
+				Quantity: unit.Quantity,
+			})
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create reproducer dir: %w", err)
+	}
+
+	return &ReproducerWriter{
+		dir:       dir,
+		utxosCbor: utxosCbor,
+		base: Reproducer{
+			ApolloVersion:  ApolloVersion(),
+			Scenario:       cfg.Scenario,
+			Mint:           &cfg.Mint,
+			Features:       &cfg.Features,
+			UTXOLevel:      cfg.UTxOLevel,
+			ChangeAddress:  sender.String(),
+			Outputs:        reproOutputs,
+			ProtocolParams: ctx.ProtocolParams,
+			GenesisParams:  ctx.GenesisParams,
+		},
+		bundles: make(map[string]*reproducerBundle),
+	}, nil
+}
+
+// Record writes a bundle for the failure class of res the first time that
+// class is seen and counts later occurrences of it. Call Flush once the run
+// is over to persist the final counts.
+func (w *ReproducerWriter) Record(res Result) error {
+	class := failureClass(res)
+	if bundle, seen := w.bundles[class]; seen {
+		bundle.repro.Occurrences++
+		return nil
+	}
+
+	bundle := &reproducerBundle{
+		dir:   filepath.Join(w.dir, fmt.Sprintf("failure-%03d-iter%d", len(w.order)+1, res.Iteration)),
+		repro: w.base,
+	}
+	bundle.repro.CreatedAt = time.Now().UTC()
+	bundle.repro.Iteration = res.Iteration
+	bundle.repro.Occurrences = 1
+	bundle.repro.Error = res.Error.Error()
+	bundle.repro.Panic = res.Panic
+	bundle.repro.Stack = string(res.Stack)
+	w.bundles[class] = bundle
+	w.order = append(w.order, class)
+
+	if err := os.MkdirAll(bundle.dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(bundle.dir, utxosFile), w.utxosCbor, 0o644); err != nil {
+		return err
+	}
+	slog.Info("Writing reproducer bundle", "dir", bundle.dir, "iteration", res.Iteration)
+	return writeReproducer(bundle.dir, &bundle.repro)
+}
+
+// Flush rewrites every bundle's metadata with its final occurrence count.
+func (w *ReproducerWriter) Flush() error {
+	for _, class := range w.order {
+		bundle := w.bundles[class]
+		if err := writeReproducer(bundle.dir, &bundle.repro); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bundles returns the bundle directories written so far, in the order their
+// failure classes were first seen.
+func (w *ReproducerWriter) Bundles() []string {
+	dirs := make([]string, len(w.order))
+	for i, class := range w.order {
+		dirs[i] = w.bundles[class].dir
+	}
+	return dirs
+}
+
+// LoadReproducer reads a bundle written by ReproducerWriter.
+func LoadReproducer(bundleDir string) (*Reproducer, []UTxO.UTxO, error) {
+	repro, err := readReproducer(bundleDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := os.ReadFile(filepath.Join(bundleDir, utxosFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	var utxos []UTxO.UTxO
+	if err := cbor.Unmarshal(raw, &utxos); err != nil {
+		return nil, nil, fmt.Errorf("decode %s: %w", utxosFile, err)
+	}
+
+	return repro, utxos, nil
+}
+
+// Replay re-executes the build described by a reproducer bundle once and
+// returns its outcome.
+func Replay(repro *Reproducer, utxos []UTxO.UTxO) (res Result, err error) {
+	changeAddr, err := Address.DecodeAddress(repro.ChangeAddress)
+	if err != nil {
+		return res, fmt.Errorf("decode change address: %w", err)
+	}
+
+	outputs := make([]Output, len(repro.Outputs))
+	for i, out := range repro.Outputs {
+		addr, err := Address.DecodeAddress(out.Address)
+		if err != nil {
+			return res, fmt.Errorf("decode output %d address: %w", i, err)
+		}
+		outputs[i] = Output{Address: addr, Lovelace: out.Lovelace}
+		for _, unit := range out.Units {
+			outputs[i].Units = append(outputs[i].Units, apollo.NewUnit(unit.PolicyId, unit.Name, unit.Quantity))
+		}
+	}
+
+	ctx := FixedChainContext.InitFixedChainContext()
+	ctx.ProtocolParams = repro.ProtocolParams
+	ctx.GenesisParams = repro.GenesisParams
+
+	run, err := replayRun(repro, utxos, changeAddr, outputs, ctx)
+	if err != nil {
+		return res, err
+	}
+	if run.close != nil {
+		defer run.close()
+	}
+	inputs, err := run.inputs(false)
+	if err != nil {
+		return res, err
+	}
+
+	res.Iteration = repro.Iteration
+	defer func() {
+		if r := recover(); r != nil {
+			res.Error = fmt.Errorf("panic: %v", r)
+			res.Panic = true
+			res.Stack = debug.Stack()
+		}
+	}()
+
+	start := time.Now()
+	_, res.Error = run.build(inputs)
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+// replayRun prepares the scenario recorded in repro against the recorded
+// inputs.
+func replayRun(repro *Reproducer, utxos []UTxO.UTxO, changeAddr Address.Address, outputs []Output, ctx FixedChainContext.FixedChainContext) (*scenarioRun, error) {
+	cfg := DefaultConfig()
+	if repro.Scenario != "" {
+		cfg.Scenario = repro.Scenario
+	}
+	if repro.Mint != nil {
+		cfg.Mint = *repro.Mint
+	}
+	if repro.Features != nil {
+		cfg.Features = *repro.Features
+	}
+	scn, err := lookupScenario(cfg.Scenario)
+	if err != nil {
+		return nil, err
+	}
+	if !scn.fixedContext {
+		return nil, fmt.Errorf("the %s scenario cannot be replayed", cfg.Scenario)
+	}
+
+	// The recorded outputs already pay the receiver.
+	env := &scenarioEnv{
+		cfg:      cfg,
+		utxos:    utxos,
+		sender:   changeAddr,
+		network:  constants.Network(changeAddr.Network),
+		outputs:  outputs,
+		chainCtx: ctx,
+	}
+	run, err := scn.prepare(env)
+	if err != nil {
+		return nil, fmt.Errorf("prepare %s scenario: %w", cfg.Scenario, err)
+	}
+	return run, nil
+}
+
+func failureClass(res Result) string {
+	msg := res.Error.Error()
+	if res.Panic {
+		return "panic:" + msg
+	}
+	return "error:" + msg
+}
+
+func readReproducer(bundleDir string) (*Reproducer, error) {
+	raw, err := os.ReadFile(filepath.Join(bundleDir, reproducerFile))
+	if err != nil {
+		return nil, err
+	}
+	var repro Reproducer
+	if err := json.Unmarshal(raw, &repro); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", reproducerFile, err)
+	}
+	return &repro, nil
+}
+
+func writeReproducer(bundleDir string, repro *Reproducer) error {
+	raw, err := json.MarshalIndent(repro, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(bundleDir, reproducerFile), append(raw, '\n'), 0o644)
+}
+
+// SameFailure reports whether a replayed result failed the same way as the
+// recorded one.
+func (r *Reproducer) SameFailure(res Result) bool {
+	if res.Error == nil {
+		return false
+	}
+	return res.Panic == r.Panic && strings.TrimSpace(res.Error.Error()) == strings.TrimSpace(r.Error)
+}
@@ -1,10 +1,14 @@
 package benchmark
 
 import (
+	"apollo-bench/internal/backend"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"runtime"
+	"runtime/debug"
 	"runtime/pprof"
 	"sync"
 	"time"
@@ -12,152 +16,248 @@ import (
 	"github.com/Salvionied/apollo"
 	"github.com/Salvionied/apollo/serialization"
 	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Transaction"
 	"github.com/Salvionied/apollo/serialization/UTxO"
 	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
 	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+	"github.com/google/pprof/profile"
 )
 
+// ErrAllIterationsFailed is returned when no iteration of a run built a
+// transaction.
+var ErrAllIterationsFailed = errors.New("all iterations failed, check logs for errors")
+
 type Result struct {
-	Duration time.Duration
-	Error    error
+	Iteration int
+	Duration  time.Duration
+	Error     error
+	Panic     bool
+	Stack     []byte
 }
 
-func Run(utxoInput, utxoOutput, iterations, parallelism int, outputFormat string, cpuProfile string, utxoLevel int) {
+// Execute runs the benchmark described by cfg and returns its result.
+// Cancelling ctx stops scheduling new iterations and returns ctx's error once
+// the in-flight ones have finished.
+func Execute(ctx context.Context, cfg Config) (*BenchmarkResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 
 	slog.Info("Starting benchmark run",
-		"utxoInput", utxoInput,
-		"utxoOutput", utxoOutput,
-		"iterations", iterations,
-		"parallelism", parallelism,
-		"outputFormat", outputFormat,
-		"cpuProfile", cpuProfile,
-		"utxoLevel", utxoLevel)
-
-	ctx := FixedChainContext.InitFixedChainContext()
+		"scenario", cfg.Scenario,
+		"network", cfg.Network,
+		"utxoInput", cfg.UTxOInput,
+		"utxoOutput", cfg.UTxOOutput,
+		"iterations", cfg.Iterations,
+		"parallelism", cfg.Parallelism,
+		"cpuProfile", cfg.CPUProfile,
+		"memProfile", cfg.MemProfile,
+		"utxoLevel", cfg.UTxOLevel,
+		"reproDir", cfg.ReproDir,
+		"warmupIterations", cfg.Warmup.Iterations,
+		"warmupAdaptive", cfg.Warmup.Adaptive,
+		"targetCI", cfg.Precision.TargetCI,
+		"maxDuration", cfg.Precision.MaxDuration,
+		"backendLatency", cfg.BackendLatency,
+		"addresses", cfg.Addresses,
+		"addressMix", cfg.AddressMix)
+
+	chainCtx := FixedChainContext.InitFixedChainContext()
+
+	// Builds go through buildCtx, which adds the injected backend latency
+	// when one is configured. Reproducers still record the plain context.
+	var (
+		buildCtx   Base.ChainContext = chainCtx
+		latencyCtx *backend.LatencyContext
+	)
+	if cfg.BackendLatency != "" {
+		profile, err := backend.ParseProfile(cfg.BackendLatency)
+		if err != nil {
+			return nil, err
+		}
+		latencyCtx = backend.NewLatencyContext(chainCtx, profile)
+		buildCtx = latencyCtx
+		slog.Info("Injecting backend latency", "profile", profile.String())
+	}
 
-	senderWalletAddress, err := Address.DecodeAddress(TEST_WALLET_ADDRESS_1)
+	scn, err := lookupScenario(cfg.Scenario)
 	if err != nil {
-		slog.Error("Error decoding wallet address", "error", err)
-		os.Exit(1)
+		return nil, err
 	}
-	slog.Debug("Sender wallet address decoded", "address", senderWalletAddress.String())
 
-	receiverWalletAddress, err := Address.DecodeAddress(TEST_WALLET_ADDRESS_2)
+	env, wallet, mix, err := newScenarioEnv(cfg, buildCtx)
 	if err != nil {
-		slog.Error("Error decoding wallet address", "error", err)
-		os.Exit(1)
+		return nil, err
 	}
-	slog.Debug("Receiver wallet address decoded", "address", receiverWalletAddress.String())
+	userUtxos, outputs := env.utxos, env.outputs
+	senderWalletAddress, receiverWalletAddress := env.sender, env.receiver
 
-	var userUtxos []UTxO.UTxO
+	outputAssets := 0
+	for _, out := range outputs {
+		outputAssets += len(out.Units)
+	}
+	if cfg.OutputShape != OutputShapeLovelace {
+		slog.Info("Shaped requested outputs", "shape", cfg.OutputShape, "assets", outputAssets)
+	}
+
+	// Snapshot the inputs up front so reproducers record what the builder was
+	// given, not whatever state the UTxOs are in once the run has finished.
+	var repro *ReproducerWriter
+	if cfg.ReproDir != "" {
+		repro, err = NewReproducerWriter(cfg.ReproDir, cfg, senderWalletAddress, userUtxos, outputs, chainCtx)
+		if err != nil {
+			return nil, fmt.Errorf("prepare reproducer writer: %w", err)
+		}
+	}
+
+	// Baseline the shared inputs before the scenario sees them, preparing
+	// may already build.
+	var detector *mutationDetector
+	if cfg.DetectMutation {
+		detector, err = newMutationDetector(
+			mutationTarget{name: "utxos", value: userUtxos},
+			mutationTarget{name: "outputs", value: outputs},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("start mutation detector: %w", err)
+		}
+		slog.Info("Detecting mutations of shared build inputs", "interval", cfg.MutationInterval, "deepClone", cfg.DeepClone)
+	}
 
-	switch utxoLevel {
-	case 1: // Simple
-		userUtxos = InitUtxos(utxoInput)
-	case 2: // Differentiated
-		userUtxos = InitUtxosDifferentiated(utxoInput)
-	case 3: // Congested
-		userUtxos = InitUtxosCongested(utxoInput)
-	default:
-		slog.Error("Invalid UTXO level", "level", utxoLevel)
-		os.Exit(1)
+	run, err := scn.prepare(env)
+	if err != nil {
+		return nil, fmt.Errorf("prepare %s scenario: %w", cfg.Scenario, err)
+	}
+	if run.close != nil {
+		defer run.close()
 	}
 
-	slog.Info("Fetched user UTXOs", "count", len(userUtxos))
+	iterate := iterateRun(run, cfg.DeepClone)
+
+	if detector != nil {
+		detector.watch(cfg.MutationInterval)
+	}
 
 	// Warm-up phase before any measurements
+	warmupIterations, err := runWarmup(ctx, cfg.Warmup, cfg.Parallelism, iterate)
+	if err != nil {
+		return nil, err
+	}
 	runtime.GC()
-	time.Sleep(2 * time.Second)
-	slog.Info("Warm-up phase completed")
+	slog.Info("Warm-up phase completed", "iterations", warmupIterations)
+	if latencyCtx != nil {
+		latencyCtx.ResetStats()
+	}
+	if run.resetStats != nil {
+		run.resetStats()
+	}
 
-	if cpuProfile != "" {
-		f, err := os.Create(cpuProfile)
+	if cfg.CPUProfile != "" {
+		f, err := os.Create(cfg.CPUProfile)
 		if err != nil {
-			slog.Error("Failed to create cpu profile file", "error", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("create cpu profile file: %w", err)
 		}
 		defer f.Close()
 		if err := pprof.StartCPUProfile(f); err != nil {
-			slog.Error("Could not start CPU profile", "error", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("start cpu profile: %w", err)
 		}
 		defer pprof.StopCPUProfile()
-		slog.Info("CPU profiling started", "file", cpuProfile)
+		slog.Info("CPU profiling started", "file", cfg.CPUProfile)
+	}
+	var allocBase *profile.Profile
+	if cfg.MemProfile != "" {
+		if allocBase, err = allocProfile(); err != nil {
+			return nil, err
+		}
+		slog.Info("Alloc profiling started", "file", cfg.MemProfile)
 	}
-
-	var (
-		wg           sync.WaitGroup
-		results      = make(chan Result, iterations)
-		totalLatency time.Duration
-		mu           sync.Mutex
-	)
-
-	sem := make(chan struct{}, parallelism)
 
 	// Actual benchmark start time
 	benchStart := time.Now()
-	slog.Info("Benchmark iterations starting", "iterations", iterations, "parallelism", parallelism)
-
-	for i := range iterations {
-		wg.Add(1)
-		sem <- struct{}{}
-
-		go func(iter int) {
-			defer func() {
-				<-sem
-				wg.Done()
-				if r := recover(); r != nil {
-					mu.Lock()
-					results <- Result{
-						Error: fmt.Errorf("panic in iteration %d: %v", iter, r),
-					}
-					mu.Unlock()
-					slog.Error("Panic during iteration", "iteration", iter, "panic", r)
-				}
-			}()
-
-			// For thread safety
-			clonedUTxOs := make([]UTxO.UTxO, len(userUtxos))
-			copy(clonedUTxOs, userUtxos)
+	slog.Info("Benchmark iterations starting", "iterations", cfg.Iterations, "parallelism", cfg.Parallelism)
 
-			start := time.Now()
-			err := buildTransaction(clonedUTxOs, &receiverWalletAddress, ctx, utxoOutput)
-			elapsed := time.Since(start)
-
-			mu.Lock()
-			defer mu.Unlock()
-			if err != nil {
-				results <- Result{Error: fmt.Errorf("iteration %d: %w", iter, err)}
-				slog.Warn("Transaction build failed", "iteration", iter, "error", err)
-			} else {
-				results <- Result{Duration: elapsed}
-				totalLatency += elapsed
-				slog.Debug("Transaction built successfully", "iteration", iter, "duration", elapsed)
-			}
-		}(i)
+	results := runBatch(ctx, 0, cfg.Iterations, cfg.Parallelism, iterate)
+	if cfg.Precision.TargetCI > 0 && ctx.Err() == nil {
+		results = runUntilPrecise(ctx, results, cfg.Iterations, cfg.Parallelism, benchStart, cfg.Precision, iterate)
+	}
+	if err := ctx.Err(); err != nil {
+		slog.Warn("Benchmark cancelled", "completedIterations", len(results))
+		return nil, err
+	}
+	slog.Info("All benchmark iterations completed", "iterations", len(results))
+	for _, res := range results {
+		if errors.Is(res.Error, ErrDeepClone) {
+			return nil, res.Error
+		}
+	}
+	// Stop profiling before the address type probe, the profiles cover the
+	// measured iterations only.
+	if cfg.CPUProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if allocBase != nil {
+		if err := writeAllocDelta(allocBase, cfg.MemProfile); err != nil {
+			return nil, err
+		}
 	}
 
-	wg.Wait()
-	close(results)
-	slog.Info("All benchmark iterations completed")
+	var (
+		mutations      []MutationResult
+		mutationChecks int
+	)
+	if detector != nil {
+		mutations, mutationChecks = detector.finish()
+		slog.Info("Mutation detection finished", "checks", mutationChecks, "mutated", len(mutations))
+	}
 
 	// Calculate metrics
 	benchDuration := time.Since(benchStart)
-	var failures int
-	successes := 0
+	var (
+		failures     int
+		successes    int
+		totalLatency time.Duration
+		totalBuild   time.Duration
+	)
 
-	for res := range results {
+	for _, res := range results {
+		totalBuild += res.Duration
 		if res.Error != nil {
-			slog.Error("Error during iteration", "error", res.Error)
+			slog.Error("Error during iteration", "iteration", res.Iteration, "error", res.Error)
 			failures++
+			// Injected backend errors are not builder failures, replaying
+			// them against the plain context would not reproduce anything.
+			if repro != nil && !errors.Is(res.Error, backend.ErrInjected) {
+				if err := repro.Record(res); err != nil {
+					slog.Error("Failed to write reproducer bundle", "iteration", res.Iteration, "error", err)
+				}
+			}
 		} else {
 			successes++
+			totalLatency += res.Duration
+		}
+	}
+
+	if repro != nil && len(repro.Bundles()) > 0 {
+		if err := repro.Flush(); err != nil {
+			slog.Error("Failed to finalize reproducer bundles", "error", err)
 		}
+		slog.Info("Reproducer bundles written", "dir", cfg.ReproDir, "classes", len(repro.Bundles()))
 	}
 
 	if successes == 0 {
-		slog.Error("All iterations failed! Check logs for errors.")
-		os.Exit(1)
+		// Expected-failure scenarios fail every iteration when the builder
+		// accepts what it should reject, say so rather than leave it to the
+		// logs.
+		unexpected := 0
+		for _, res := range results {
+			if errors.Is(res.Error, ErrUnexpectedSuccess) {
+				unexpected++
+			}
+		}
+		if unexpected > 0 {
+			return nil, fmt.Errorf("%w: %d of %d builds succeeded unexpectedly", ErrAllIterationsFailed, unexpected, len(results))
+		}
+		return nil, ErrAllIterationsFailed
 	}
 
 	// Calculate accurate Tx/s metrics
@@ -166,51 +266,198 @@ func Run(utxoInput, utxoOutput, iterations, parallelism int, outputFormat string
 
 	// For comparison: latency-based Tx/s
 	latencyTxPerSec := float64(time.Second) / float64(latencyPerTx)
+
+	latencyCI, latencyCIRel, _ := latencyPrecision(results)
 	slog.Info("Benchmark results",
 		"actualTxPerSec", actualTxPerSec,
 		"latencyTxPerSec", latencyTxPerSec,
 		"latencyPerTx", latencyPerTx,
+		"latencyCI95", latencyCI,
+		"latencyCI95Rel", latencyCIRel,
 		"failures", failures,
-		"iterations", iterations,
-		"parallelism", parallelism,
-		"utxoInput", utxoInput,
-		"utxoOutput", utxoOutput,
-		"benchDuration", benchDuration,
-		"outputFormat", outputFormat)
-
-	PrintResults(
-		actualTxPerSec,
-		latencyTxPerSec,
-		latencyPerTx,
-		failures,
-		iterations,
-		parallelism,
-		utxoInput,
-		utxoOutput,
-		benchDuration,
-		outputFormat,
+		"iterations", len(results),
+		"parallelism", cfg.Parallelism,
+		"utxoInput", cfg.UTxOInput,
+		"utxoOutput", cfg.UTxOOutput,
+		"benchDuration", benchDuration)
+
+	result := &BenchmarkResult{
+		Scenario:         cfg.Scenario,
+		Network:          cfg.Network,
+		Sender:           senderWalletAddress.String(),
+		SenderType:       AddressTypeName(senderWalletAddress),
+		Receiver:         receiverWalletAddress.String(),
+		ReceiverType:     AddressTypeName(receiverWalletAddress),
+		WallClockTPS:     actualTxPerSec,
+		LatencyTPS:       latencyTxPerSec,
+		AvgLatency:       latencyPerTx,
+		LatencyCI95:      latencyCI,
+		LatencyCI95Rel:   latencyCIRel,
+		TargetCI:         cfg.Precision.TargetCI,
+		Failures:         failures,
+		Iterations:       len(results),
+		Parallelism:      cfg.Parallelism,
+		UTXOInput:        cfg.UTxOInput,
+		UTXOOutput:       cfg.UTxOOutput,
+		WarmupIterations: warmupIterations,
+		SystemInfo:       GetSystemInfo(),
+		BenchDuration:    benchDuration,
+	}
+	if latencyCtx != nil {
+		stats := latencyCtx.Stats()
+		result.BackendLatency = cfg.BackendLatency
+		result.BackendCallsPerTx = float64(stats.Calls) / float64(len(results))
+		result.BackendDelayPerTx = stats.Delay / time.Duration(len(results))
+		if totalBuild > 0 {
+			result.BackendTimeShare = float64(stats.Delay) / float64(totalBuild)
+		}
+		result.BackendErrors = stats.Errors
+		slog.Info("Backend latency summary",
+			"callsPerTx", result.BackendCallsPerTx,
+			"delayPerTx", result.BackendDelayPerTx,
+			"timeShare", result.BackendTimeShare,
+			"injectedErrors", stats.Errors)
+	}
+	if run.report != nil {
+		run.report(result, len(results))
+	}
+	if cfg.Hotspots > 0 && cfg.CPUProfile != "" {
+		if result.CPUHotspots, err = summarizeProfileFile(cfg.CPUProfile, SampleTypeCPU, cfg.Hotspots); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Hotspots > 0 && cfg.MemProfile != "" {
+		if result.AllocHotspots, err = summarizeProfileFile(cfg.MemProfile, SampleTypeAlloc, cfg.Hotspots); err != nil {
+			return nil, err
+		}
+	}
+	if detector != nil {
+		result.MutationChecks = mutationChecks
+		result.Mutations = mutations
+		result.DeepClone = cfg.DeepClone
+	}
+	if cfg.OutputShape != OutputShapeLovelace {
+		result.OutputShape = cfg.OutputShape
+		result.OutputAssets = outputAssets
+	}
+	if len(wallet) > 1 {
+		result.Addresses = len(wallet)
+		result.AddressMix = mix.String()
+	}
+	// Probe each address type on its own so failures and slowdowns in the
+	// mixed run can be attributed.
+	if len(mix.Types()) > 1 || mix[AddressBase] == 0 {
+		slog.Info("Probing address types", "types", mix.Types(), "iterations", addressProbeIterations)
+		// The probe builds against the plain context, injected latency
+		// would hide the differences between the types.
+		probeEnv := *env
+		probeEnv.chainCtx = chainCtx
+		if result.AddressTypes, err = probeAddressTypes(scn, &probeEnv, mix); err != nil {
+			return nil, fmt.Errorf("probe address types: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// runBatch runs iterations [first, first+n) of fn on up to parallelism
+// goroutines and returns their results in completion order. A panicking
+// iteration is reported as a failed result carrying its stack trace. Once ctx
+// is cancelled no further iterations are started.
+func runBatch(ctx context.Context, first, n, parallelism int, fn func(iter int) Result) []Result {
+	var (
+		wg      sync.WaitGroup
+		results = make(chan Result, n)
 	)
+
+	sem := make(chan struct{}, parallelism)
+
+	for i := first; i < first+n; i++ {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+
+		go func(iter int) {
+			defer func() {
+				// Recover before releasing the WaitGroup so the result is
+				// queued before the channel can be closed.
+				if r := recover(); r != nil {
+					results <- Result{
+						Iteration: iter,
+						Error:     fmt.Errorf("panic: %v", r),
+						Panic:     true,
+						Stack:     debug.Stack(),
+					}
+					slog.Error("Panic during iteration", "iteration", iter, "panic", r)
+				}
+				<-sem
+				wg.Done()
+			}()
+
+			res := fn(iter)
+			if res.Error != nil {
+				slog.Warn("Transaction build failed", "iteration", iter, "error", res.Error)
+			} else {
+				slog.Debug("Transaction built successfully", "iteration", iter, "duration", res.Duration)
+			}
+			results <- res
+		}(i)
+	}
+
+	wg.Wait()
+	close(results)
+
+	collected := make([]Result, 0, n)
+	for res := range results {
+		collected = append(collected, res)
+	}
+	return collected
 }
 
-func buildTransaction(utxos []UTxO.UTxO, addr *Address.Address, ctx Base.ChainContext, utxoOutput int) error {
-	slog.Debug("Building transaction", "address", addr.String(), "utxoOutput", utxoOutput)
+// RequestedOutputs returns the payments every benchmark iteration asks the
+// builder for.
+func RequestedOutputs(addr Address.Address, utxoOutput int) []Output {
+	outputs := make([]Output, utxoOutput)
+	for i := range outputs {
+		outputs[i] = Output{Address: addr, Lovelace: 2_000_000}
+	}
+	return outputs
+}
+
+// buildTransaction balances a transaction paying outputs from the utxos of
+// wallet, which also receives the change and signs, and returns it.
+func buildTransaction(utxos []UTxO.UTxO, wallet *Address.Address, ctx Base.ChainContext, outputs []Output) (*Transaction.Transaction, error) {
+	return buildTransactionWith(utxos, wallet, ctx, outputs, nil)
+}
+
+// buildTransactionWith is buildTransaction with extra builder features: when
+// set, features is applied to the builder after the outputs are added and
+// before the transaction is completed.
+func buildTransactionWith(utxos []UTxO.UTxO, wallet *Address.Address, ctx Base.ChainContext, outputs []Output, features func(*apollo.Apollo) *apollo.Apollo) (*Transaction.Transaction, error) {
+	slog.Debug("Building transaction", "wallet", wallet.String(), "utxoOutput", len(outputs))
 
 	apolloBE := apollo.New(ctx).
-		SetWalletFromBech32(addr.String()).
+		SetWalletFromBech32(wallet.String()).
 		AddLoadedUTxOs(utxos...).
-		SetChangeAddress(*addr).
-		AddRequiredSigner(serialization.PubKeyHash(addr.PaymentPart))
+		SetChangeAddress(*wallet).
+		AddRequiredSigner(serialization.PubKeyHash(wallet.PaymentPart))
 
 	// Add multiple outputs
-	for i := 0; i < utxoOutput; i++ {
-		apolloBE = apolloBE.PayToAddress(*addr, 2_000_000)
+	for _, out := range outputs {
+		apolloBE = apolloBE.PayToAddress(out.Address, out.Lovelace, out.Units...)
+	}
+	if features != nil {
+		apolloBE = features(apolloBE)
 	}
-	_, err := apolloBE.Complete()
+	apolloBE, err := apolloBE.Complete()
 	if err != nil {
-		slog.Error("Transaction completion failed", "error", err)
-	} else {
-		slog.Debug("Transaction completed successfully")
+		return nil, err
 	}
+	slog.Debug("Transaction completed successfully")
 
-	return err
+	return apolloBE.GetTx(), nil
 }
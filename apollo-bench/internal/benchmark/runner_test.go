@@ -0,0 +1,143 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+)
+
+var benchLevels = []struct {
+	name  string
+	level int
+}{
+	{"simple", 1},
+	{"differentiated", 2},
+	{"congested", 3},
+}
+
+var benchSizes = []struct{ in, out int }{
+	{5, 1},
+	{10, 1},
+	{10, 10},
+	{50, 10},
+	{50, 50},
+}
+
+// BenchmarkBuildTransaction measures one transaction build per iteration for
+// every UTxO level and input/output size the CLI supports, so results can be
+// compared across Apollo versions with benchstat:
+//
+//	go test -run '^$' -bench BuildTransaction -count 10 ./internal/benchmark
+//
+// Besides time and allocations it reports the size of the built transaction
+// (tx-bytes) and its fee (fee-lovelace). Sizes the level cannot fund are
+// skipped.
+func BenchmarkBuildTransaction(b *testing.B) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	chainCtx := FixedChainContext.InitFixedChainContext()
+	sender, err := Address.DecodeAddress(TEST_WALLET_ADDRESS_1)
+	if err != nil {
+		b.Fatalf("decode sender address: %v", err)
+	}
+	receiver, err := Address.DecodeAddress(TEST_WALLET_ADDRESS_2)
+	if err != nil {
+		b.Fatalf("decode receiver address: %v", err)
+	}
+
+	for _, lvl := range benchLevels {
+		for _, size := range benchSizes {
+			name := fmt.Sprintf("level=%s/in=%d/out=%d", lvl.name, size.in, size.out)
+			b.Run(name, func(b *testing.B) {
+				utxos := InitUtxosForLevel(lvl.level, size.in)
+				outputs := RequestedOutputs(receiver, size.out)
+
+				tx, err := buildTransaction(utxos, &sender, chainCtx, outputs)
+				if err != nil {
+					b.Skipf("scenario cannot be built: %v", err)
+				}
+				txBytes, err := tx.Bytes()
+				if err != nil {
+					b.Fatalf("encode transaction: %v", err)
+				}
+
+				b.ReportAllocs()
+				for b.Loop() {
+					// Same per-iteration copy as the CLI runner.
+					cloned := make([]UTxO.UTxO, len(utxos))
+					copy(cloned, utxos)
+					if _, err := buildTransaction(cloned, &sender, chainCtx, outputs); err != nil {
+						b.Fatalf("build transaction: %v", err)
+					}
+				}
+				b.ReportMetric(float64(len(txBytes)), "tx-bytes")
+				b.ReportMetric(float64(tx.TransactionBody.Fee), "fee-lovelace")
+			})
+		}
+	}
+}
+
+// BenchmarkScenario measures one build per iteration of every registered
+// scenario with the default configuration, the way the CLI runs it:
+//
+//	go test -run '^$' -bench Scenario -count 10 ./internal/benchmark
+//
+// Expected-failure scenarios measure the time to the expected error and
+// report no transaction metrics. Scenarios the default configuration cannot
+// prepare or build are skipped.
+func BenchmarkScenario(b *testing.B) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, name := range Scenarios() {
+		b.Run(name, func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.Scenario = name
+			if err := cfg.Validate(); err != nil {
+				b.Skipf("default configuration is invalid: %v", err)
+			}
+			scn, err := lookupScenario(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			env, _, _, err := newScenarioEnv(cfg, FixedChainContext.InitFixedChainContext())
+			if err != nil {
+				b.Fatalf("set up scenario: %v", err)
+			}
+			run, err := scn.prepare(env)
+			if err != nil {
+				b.Skipf("scenario cannot be prepared: %v", err)
+			}
+			if run.close != nil {
+				defer run.close()
+			}
+			tx, err := run.buildOnce(false)
+			if err != nil {
+				b.Skipf("scenario cannot be built: %v", err)
+			}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				utxos, err := run.inputs(false)
+				if err != nil {
+					b.Fatalf("clone inputs: %v", err)
+				}
+				if _, err := run.build(utxos); err != nil {
+					b.Fatalf("build transaction: %v", err)
+				}
+			}
+			if tx != nil {
+				txBytes, err := tx.Bytes()
+				if err != nil {
+					b.Fatalf("encode transaction: %v", err)
+				}
+				b.ReportMetric(float64(len(txBytes)), "tx-bytes")
+				b.ReportMetric(float64(tx.TransactionBody.Fee), "fee-lovelace")
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package benchmark
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/Salvionied/apollo/constants"
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/txBuilding/Backend/Base"
+)
+
+// Scenario names accepted by Config.Scenario.
+const (
+	ScenarioPayment        = "payment"
+	ScenarioBlockfrostMock = "blockfrost-mock"
+)
+
+// scenarioEnv is the input every scenario builds its transactions from.
+type scenarioEnv struct {
+	cfg      Config
+	utxos    []UTxO.UTxO
+	sender   Address.Address
+	receiver Address.Address
+	network  constants.Network
+	outputs  []Output
+	chainCtx Base.ChainContext
+}
+
+// newScenarioEnv generates the wallet UTxOs and requested outputs described
+// by cfg for builds against chainCtx. It also returns the wallet addresses
+// the UTxOs were spread over and their mix.
+func newScenarioEnv(cfg Config, chainCtx Base.ChainContext) (*scenarioEnv, []Address.Address, AddressMix, error) {
+	sender, receiver, network, err := cfg.wallet()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	slog.Debug("Wallet addresses decoded",
+		"network", cfg.Network,
+		"sender", sender.String(),
+		"senderType", AddressTypeName(sender),
+		"receiver", receiver.String(),
+		"receiverType", AddressTypeName(receiver))
+
+	mix, err := ParseAddressMix(cfg.AddressMix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	wallet, err := WalletAddresses(sender, cfg.Addresses, mix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The generators place every UTxO at TEST_WALLET_ADDRESS_1, move them
+	// to the configured wallet.
+	utxos := SpreadUtxos(InitUtxosForLevel(cfg.UTxOLevel, cfg.UTxOInput), wallet)
+	if len(wallet) > 1 {
+		slog.Info("Spread UTXOs over wallet addresses", "addresses", len(wallet), "mix", mix.String())
+	}
+	slog.Info("Fetched user UTXOs", "count", len(utxos))
+
+	outputs, err := ShapeOutputs(RequestedOutputs(receiver, cfg.UTxOOutput), cfg.OutputShape, cfg.AssetsPerOutput, utxos)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &scenarioEnv{
+		cfg:      cfg,
+		utxos:    utxos,
+		sender:   sender,
+		receiver: receiver,
+		network:  network,
+		outputs:  outputs,
+		chainCtx: chainCtx,
+	}, wallet, mix, nil
+}
+
+// scenarioRun is a prepared scenario. build is executed once per iteration
+// with the inputs of that iteration, see inputs, and must be safe for
+// concurrent use.
+type scenarioRun struct {
+	// utxos are the shared UTxOs the builds spend, nil for scenarios that
+	// fetch their own.
+	utxos []UTxO.UTxO
+	build func(utxos []UTxO.UTxO) (*Transaction.Transaction, error)
+	// resetStats, if set, is called when the measured iterations start.
+	resetStats func()
+	// report, if set, adds scenario specific metrics for the measured
+	// iterations to result.
+	report func(result *BenchmarkResult, iterations int)
+	// close, if set, releases the scenario's resources after the run.
+	close func()
+}
+
+type scenario struct {
+	description string
+	prepare     func(env *scenarioEnv) (*scenarioRun, error)
+	// fixedContext is set for scenarios that build against env.chainCtx, so
+	// they support backend latency, address mixes and reproducer bundles.
+	fixedContext bool
+	// deterministic is set for scenarios whose builds return a transaction
+	// that only depends on the configuration, so determinism checks cover
+	// them.
+	deterministic bool
+	// validate, when set, checks the settings only this scenario uses, such
+	// as its MintConfig or FeatureConfig field.
+	validate func(c Config) error
+}
+
+var scenarios = map[string]scenario{
+	ScenarioPayment: {
+		description:   "Pay the requested outputs from the generated UTxOs against a fixed chain context",
+		prepare:       preparePayment,
+		fixedContext:  true,
+		deterministic: true,
+	},
+	ScenarioBlockfrostMock: {
+		description: "Fetch UTxOs, build, sign, evaluate and submit through BlockFrostChainContext against an in-process mock Blockfrost",
+		prepare:     prepareBlockfrostMock,
+	},
+	ScenarioMint: {
+		description:   "Mint and burn --mint-assets and --burn-assets under native-script and Plutus policies in the payment",
+		prepare:       prepareMint,
+		validate:      validateMint,
+		fixedContext:  true,
+		deterministic: true,
+	},
+	ScenarioFailInsufficientFunds: {
+		description:  "Expect the payment to fail with insufficient funds when an output exceeds the wallet balance",
+		prepare:      prepareFailInsufficientFunds,
+		fixedContext: true,
+	},
+	ScenarioFailMissingToken: {
+		description:  "Expect the payment to fail with a missing token when an output carries an asset the wallet lacks",
+		prepare:      prepareFailMissingToken,
+		fixedContext: true,
+	},
+	ScenarioFailOversize: {
+		description:  "Expect the payment to fail as too large when it carries metadata beyond the maximum transaction size",
+		prepare:      prepareFailOversize,
+		fixedContext: true,
+	},
+	ScenarioFailBelowMinADA: {
+		description:  "Expect the payment to fail as below min ADA when it leaves too little ADA for the token change",
+		prepare:      prepareFailBelowMinADA,
+		fixedContext: true,
+	},
+	ScenarioMetadata: {
+		description:   "Attach a CIP-20 message of --metadata-bytes to the payment",
+		prepare:       prepareMetadata,
+		validate:      validateMetadata,
+		fixedContext:  true,
+		deterministic: true,
+	},
+	ScenarioValidity: {
+		description:   "Set a validity start and a TTL --validity-window slots later on the payment",
+		prepare:       prepareValidity,
+		validate:      validateValidity,
+		fixedContext:  true,
+		deterministic: true,
+	},
+	ScenarioWithdrawals: {
+		description:   "Withdraw rewards from --withdrawals stake addresses in the payment",
+		prepare:       prepareWithdrawals,
+		validate:      validateWithdrawals,
+		fixedContext:  true,
+		deterministic: true,
+	},
+}
+
+// Scenarios returns the names of all scenarios, sorted.
+func Scenarios() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScenarioDescription returns the one-line description of a scenario.
+func ScenarioDescription(name string) string {
+	return scenarios[name].description
+}
+
+func lookupScenario(name string) (scenario, error) {
+	s, ok := scenarios[name]
+	if !ok {
+		return scenario{}, fmt.Errorf("unknown scenario %q (available: %v)", name, Scenarios())
+	}
+	return s, nil
+}
+
+// inputs returns the UTxOs of one build: its own slice of r.utxos, and with
+// deep set also its own copy of everything they reference. It is called
+// before the build is timed, so cloning does not count as builder latency.
+func (r *scenarioRun) inputs(deep bool) ([]UTxO.UTxO, error) {
+	if r.utxos == nil {
+		return nil, nil
+	}
+	return cloneInputs(r.utxos, deep)
+}
+
+// buildOnce builds one transaction outside of any timed iteration.
+func (r *scenarioRun) buildOnce(deep bool) (*Transaction.Transaction, error) {
+	utxos, err := r.inputs(deep)
+	if err != nil {
+		return nil, err
+	}
+	return r.build(utxos)
+}
+
+// iterateRun returns the function running iteration iter of run, timing
+// the build only.
+func iterateRun(run *scenarioRun, deep bool) func(iter int) Result {
+	return func(iter int) Result {
+		utxos, err := run.inputs(deep)
+		if err != nil {
+			return Result{Iteration: iter, Error: err}
+		}
+		start := time.Now()
+		_, err = run.build(utxos)
+		return Result{Iteration: iter, Duration: time.Since(start), Error: err}
+	}
+}
+
+func preparePayment(env *scenarioEnv) (*scenarioRun, error) {
+	return &scenarioRun{
+		utxos: env.utxos,
+		build: func(utxos []UTxO.UTxO) (*Transaction.Transaction, error) {
+			return buildTransaction(utxos, &env.sender, env.chainCtx, env.outputs)
+		},
+	}, nil
+}
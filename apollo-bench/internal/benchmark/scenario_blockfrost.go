@@ -0,0 +1,101 @@
+package benchmark
+
+import (
+	"apollo-bench/internal/backend"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/Salvionied/apollo"
+	"github.com/Salvionied/apollo/serialization/Key"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/txBuilding/Backend/BlockFrostChainContext"
+	"github.com/Salvionied/apollo/txBuilding/Backend/FixedChainContext"
+)
+
+// mockProjectID is sent to the mock Blockfrost, which only checks that one
+// is present.
+const mockProjectID = "previewapollobench"
+
+// prepareBlockfrostMock serves the generated UTxOs at the sender address from
+// a mock Blockfrost and measures the whole request path of
+// plutus-v3-sc-tx-builder: every iteration creates a BlockFrostChainContext,
+// fetches the sender's UTxOs and the tip, builds, signs, evaluates and submits.
+func prepareBlockfrostMock(env *scenarioEnv) (*scenarioRun, error) {
+	// Apollo caches chain parameters in ./tmp when that directory exists,
+	// which would hide those round-trips from the measurement.
+	if info, err := os.Stat("tmp"); err == nil && info.IsDir() {
+		slog.Warn("Apollo will serve chain parameters from ./tmp instead of the mock backend, run from another directory to measure them")
+	}
+
+	fixed := FixedChainContext.InitFixedChainContext()
+	ledger := backend.NewLedger(fixed.ProtocolParams, fixed.GenesisParams)
+	ledger.AddUTxOs(env.utxos...)
+	server := backend.NewMockBlockfrost(ledger)
+	slog.Info("Mock Blockfrost started", "url", server.URL, "utxos", len(env.utxos))
+
+	// The mock does not check witnesses, any key will do.
+	seed := sha256.Sum256([]byte("apollo-bench mock wallet"))
+	sk := ed25519.NewKeyFromSeed(seed[:])
+	skey := Key.SigningKey{Payload: sk}
+	vkey := Key.VerificationKey{Payload: sk.Public().(ed25519.PublicKey)}
+
+	build := func(_ []UTxO.UTxO) (*Transaction.Transaction, error) {
+		bfc, err := BlockFrostChainContext.NewBlockfrostChainContext(server.URL, int(env.network), mockProjectID)
+		if err != nil {
+			return nil, fmt.Errorf("create chain context: %w", err)
+		}
+		utxos, err := bfc.Utxos(env.sender)
+		if err != nil {
+			return nil, fmt.Errorf("fetch utxos: %w", err)
+		}
+		lastSlot, err := bfc.LastBlockSlot()
+		if err != nil {
+			return nil, fmt.Errorf("fetch last block slot: %w", err)
+		}
+
+		apolloBE := apollo.New(&bfc).
+			SetWalletFromBech32(env.sender.String()).
+			AddLoadedUTxOs(utxos...).
+			SetChangeAddress(env.sender)
+		for _, out := range env.outputs {
+			apolloBE = apolloBE.PayToAddress(out.Address, out.Lovelace, out.Units...)
+		}
+		apolloBE, err = apolloBE.SetTtl(int64(lastSlot) + 300).Complete()
+		if err != nil {
+			return nil, err
+		}
+		apolloBE, err = apolloBE.SignWithSkey(vkey, skey)
+		if err != nil {
+			return nil, fmt.Errorf("sign: %w", err)
+		}
+
+		tx := apolloBE.GetTx()
+		txBytes, err := tx.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("encode transaction: %w", err)
+		}
+		if _, err := bfc.EvaluateTx(txBytes); err != nil {
+			return nil, fmt.Errorf("evaluate: %w", err)
+		}
+		if _, err := bfc.SubmitTx(*tx); err != nil {
+			return nil, fmt.Errorf("submit: %w", err)
+		}
+		return tx, nil
+	}
+
+	return &scenarioRun{
+		build:      build,
+		resetStats: server.ResetStats,
+		report: func(result *BenchmarkResult, iterations int) {
+			result.BackendRequestsPerTx = float64(server.TotalRequests()) / float64(iterations)
+			slog.Info("Mock Blockfrost requests",
+				"requests", server.Requests(),
+				"submitted", server.Submitted())
+		},
+		close: server.Close,
+	}, nil
+}
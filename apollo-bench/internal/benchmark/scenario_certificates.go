@@ -0,0 +1,55 @@
+//go:build apollo_certificates
+
+package benchmark
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Salvionied/apollo"
+	"github.com/Salvionied/apollo/serialization/Certificate"
+)
+
+// ScenarioCertificates registers stake credentials in the payment. It needs
+// Apollo v1.3.0 or later and is only built with the apollo_certificates
+// tag, which the versions command sets for such versions.
+//
+// Apollo's certificates carry a code and a stake credential only, so there
+// is no delegation scenario: a delegation certificate also names a pool.
+const ScenarioCertificates = "certificates"
+
+const (
+	// certStakeRegistration is the certificate code of a stake credential
+	// registration, certKeyHash the kind of a key hash stake credential.
+	certStakeRegistration = 0
+	certKeyHash           = 0
+)
+
+func init() {
+	scenarios[ScenarioCertificates] = scenario{
+		description:   "Register --certificates stake credentials in the payment, paying their deposits",
+		prepare:       prepareCertificates,
+		validate:      validateCertificates,
+		fixedContext:  true,
+		deterministic: true,
+	}
+}
+
+func validateCertificates(c Config) error {
+	if c.Features.Certificates <= 0 {
+		return errors.New("certificates must be > 0")
+	}
+	return nil
+}
+
+func prepareCertificates(env *scenarioEnv) (*scenarioRun, error) {
+	certs := make(Certificate.Certificates, env.cfg.Features.Certificates)
+	for i := range certs {
+		cert := Certificate.NewCertificateFromAddress(rewardAddress(env.sender, i).StakingPart, certStakeRegistration, certKeyHash)
+		certs[i] = &cert
+	}
+	return prepareFeature(env, fmt.Sprintf("%d stake registration certificate(s)", len(certs)),
+		func(b *apollo.Apollo) *apollo.Apollo {
+			return b.SetCertificates(&certs)
+		})
+}
@@ -0,0 +1,168 @@
+package benchmark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/Salvionied/apollo"
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Asset"
+	"github.com/Salvionied/apollo/serialization/AssetName"
+	"github.com/Salvionied/apollo/serialization/Metadata"
+	"github.com/Salvionied/apollo/serialization/MultiAsset"
+	"github.com/Salvionied/apollo/serialization/Policy"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/TransactionInput"
+	"github.com/Salvionied/apollo/serialization/TransactionOutput"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/serialization/Value"
+)
+
+// Expected-failure scenario names accepted by Config.Scenario. Their builds
+// must fail with the scenario's error category: those iterations pass and
+// their latency is the time to failure, any other outcome is a failure.
+const (
+	ScenarioFailInsufficientFunds = "fail-insufficient-funds"
+	ScenarioFailMissingToken      = "fail-missing-token"
+	ScenarioFailOversize          = "fail-oversize"
+	ScenarioFailBelowMinADA       = "fail-below-min-ada"
+)
+
+const (
+	// belowMinADAPolicies is the number of single-token policies of the dust
+	// UTxO the below-min-ADA scenario adds to the wallet. Its tokens alone
+	// need about 10 ADA in the change output.
+	belowMinADAPolicies = 50
+	// belowMinADADustLovelace is held next to the dust tokens.
+	belowMinADADustLovelace = 2_000_000
+	// belowMinADAChange is the ADA the payment leaves for the fee and the
+	// change, enough for coin selection but not for the change's min ADA.
+	belowMinADAChange = 3_000_000
+)
+
+// ErrUnexpectedSuccess is wrapped by the error of an expected-failure
+// iteration whose build succeeded.
+var ErrUnexpectedSuccess = errors.New("build succeeded unexpectedly")
+
+// failureCategory is an error category expected-failure scenarios assert.
+// Apollo returns plain string errors, so categories match their text.
+type failureCategory struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var (
+	categoryInsufficientFunds = failureCategory{"insufficient funds", regexp.MustCompile(`(?i)not enough funds`)}
+	categoryMissingToken      = failureCategory{"missing token", regexp.MustCompile(`(?i)missing required assets`)}
+	categoryOversize          = failureCategory{"transaction too large", regexp.MustCompile(`(?i)transaction too large`)}
+	categoryBelowMinADA       = failureCategory{"below min ADA", regexp.MustCompile(`(?i)no remaining utxos`)}
+)
+
+func prepareFailInsufficientFunds(env *scenarioEnv) (*scenarioRun, error) {
+	var balance int
+	for _, u := range env.utxos {
+		balance += int(u.Output.Lovelace())
+	}
+	outputs := append([]Output(nil), env.outputs...)
+	outputs[0].Lovelace = balance + 1
+	return prepareExpectedFailure(env, categoryInsufficientFunds, outputs, nil)
+}
+
+func prepareFailMissingToken(env *scenarioEnv) (*scenarioRun, error) {
+	outputs := append([]Output(nil), env.outputs...)
+	outputs[0].Units = append(append([]apollo.Unit(nil), outputs[0].Units...),
+		apollo.NewUnit("ffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "missing", 1))
+	return prepareExpectedFailure(env, categoryMissingToken, outputs, nil)
+}
+
+func prepareFailOversize(env *scenarioEnv) (*scenarioRun, error) {
+	metadata := Metadata.ShelleyMaryMetadata{
+		Metadata: Metadata.Metadata{
+			cip20Label: map[string]any{"msg": cip20Message(MaxMetadataBytes)},
+		},
+	}
+	return prepareExpectedFailure(env, categoryOversize, env.outputs, func(b *apollo.Apollo) *apollo.Apollo {
+		return b.SetShelleyMetadata(metadata)
+	})
+}
+
+// prepareFailBelowMinADA adds a UTxO of many dust tokens to the wallet and
+// raises the first output until the payment spends all but
+// belowMinADAChange of it. Apollo pays every payment's min ADA itself, but
+// the change then carries all tokens with too little ADA, and with no UTxO
+// left to add Complete fails with "No Remaining UTxOs".
+func prepareFailBelowMinADA(env *scenarioEnv) (*scenarioRun, error) {
+	utxos := append(append([]UTxO.UTxO(nil), env.utxos...), dustUtxo(env.sender))
+	var balance int
+	for _, u := range utxos {
+		balance += int(u.Output.Lovelace())
+	}
+	outputs := append([]Output(nil), env.outputs...)
+	paid := 0
+	for _, out := range outputs {
+		// What Complete will pay, see apollo.Payment.EnsureMinUTXO.
+		payment := apollo.Payment{Receiver: out.Address, Lovelace: out.Lovelace, Units: out.Units}
+		payment.EnsureMinUTXO(env.chainCtx)
+		paid += payment.Lovelace
+	}
+	raise := balance - belowMinADAChange - paid
+	if raise < 0 {
+		return nil, fmt.Errorf("outputs pay %d lovelace, more than the %d the wallet can spend below min ADA change", paid, balance-belowMinADAChange)
+	}
+	outputs[0].Lovelace += raise
+
+	dustEnv := *env
+	dustEnv.utxos = utxos
+	return prepareExpectedFailure(&dustEnv, categoryBelowMinADA, outputs, nil)
+}
+
+// dustUtxo returns a UTxO of owner holding one token of each of
+// belowMinADAPolicies policies.
+func dustUtxo(owner Address.Address) UTxO.UTxO {
+	assets := MultiAsset.MultiAsset[int64]{}
+	for i := range belowMinADAPolicies {
+		hash := sha256.Sum256(fmt.Appendf(nil, "apollo-bench dust %d", i))
+		id := hex.EncodeToString(hash[:28])
+		assets[Policy.PolicyId{Value: id}] = Asset.Asset[int64]{AssetName.NewAssetNameFromString("dust"): 1}
+	}
+	hash := sha256.Sum256([]byte("apollo-bench dust"))
+	return UTxO.UTxO{
+		Input: TransactionInput.TransactionInput{TransactionId: hash[:], Index: 0},
+		Output: TransactionOutput.SimpleTransactionOutput(
+			owner, Value.SimpleValue(belowMinADADustLovelace, assets)),
+	}
+}
+
+// prepareExpectedFailure prepares builds of outputs with features that pass
+// when they fail with an error of category.
+func prepareExpectedFailure(env *scenarioEnv, category failureCategory, outputs []Output, features func(*apollo.Apollo) *apollo.Apollo) (*scenarioRun, error) {
+	var unexpectedSuccesses, wrongErrors atomic.Int64
+	return &scenarioRun{
+		utxos: env.utxos,
+		build: func(utxos []UTxO.UTxO) (*Transaction.Transaction, error) {
+			_, err := buildTransactionWith(utxos, &env.sender, env.chainCtx, outputs, features)
+			switch {
+			case err == nil:
+				unexpectedSuccesses.Add(1)
+				return nil, fmt.Errorf("%w, expected %s", ErrUnexpectedSuccess, category.name)
+			case !category.pattern.MatchString(err.Error()):
+				wrongErrors.Add(1)
+				return nil, fmt.Errorf("expected %s, got: %w", category.name, err)
+			}
+			return nil, nil
+		},
+		resetStats: func() {
+			unexpectedSuccesses.Store(0)
+			wrongErrors.Store(0)
+		},
+		report: func(result *BenchmarkResult, _ int) {
+			result.ExpectedError = category.name
+			result.UnexpectedSuccesses = int(unexpectedSuccesses.Load())
+			result.WrongErrors = int(wrongErrors.Load())
+		},
+	}, nil
+}
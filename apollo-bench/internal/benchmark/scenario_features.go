@@ -0,0 +1,170 @@
+package benchmark
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Salvionied/apollo"
+	"github.com/Salvionied/apollo/serialization"
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Metadata"
+	"github.com/Salvionied/apollo/serialization/PlutusData"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+)
+
+// Feature scenario names accepted by Config.Scenario. Each builds the
+// payment scenario's transaction with one more builder feature.
+// The certificates scenario needs a newer Apollo, see ScenarioCertificates.
+const (
+	ScenarioMetadata    = "metadata"
+	ScenarioValidity    = "validity"
+	ScenarioWithdrawals = "withdrawals"
+)
+
+const (
+	// cip20Label is the metadata label of CIP-20 transaction messages.
+	cip20Label = 674
+	// cip20LineBytes is the longest string a metadata value may hold, CIP-20
+	// splits longer messages into lines of at most this size.
+	cip20LineBytes = 64
+	// MaxMetadataBytes bounds FeatureConfig.MetadataBytes to the maximum
+	// transaction size of the fixed chain context. Messages close to it
+	// leave no room for inputs and are expected to fail.
+	MaxMetadataBytes = 16384
+	// withdrawalLovelace is the reward withdrawn from every stake address.
+	withdrawalLovelace = 1_000_000
+)
+
+// FeatureConfig sizes the builder feature of the feature scenarios.
+type FeatureConfig struct {
+	// MetadataBytes is the length of the CIP-20 message of the metadata
+	// scenario.
+	MetadataBytes int `json:"metadata_bytes"`
+	// ValidityWindow is the number of slots between the validity start and
+	// the TTL of the validity scenario.
+	ValidityWindow int `json:"validity_window"`
+	// Withdrawals is the number of stake addresses the withdrawals scenario
+	// withdraws rewards from.
+	Withdrawals int `json:"withdrawals"`
+	// Certificates is the number of stake credentials the certificates
+	// scenario registers.
+	Certificates int `json:"certificates"`
+}
+
+func validateMetadata(c Config) error {
+	if c.Features.MetadataBytes <= 0 || c.Features.MetadataBytes > MaxMetadataBytes {
+		return fmt.Errorf("metadata bytes must be between 1 and %d", MaxMetadataBytes)
+	}
+	return nil
+}
+
+func validateValidity(c Config) error {
+	if c.Features.ValidityWindow <= 0 {
+		return errors.New("validity window must be > 0")
+	}
+	return nil
+}
+
+func validateWithdrawals(c Config) error {
+	if c.Features.Withdrawals <= 0 {
+		return errors.New("withdrawals must be > 0")
+	}
+	return nil
+}
+
+func prepareMetadata(env *scenarioEnv) (*scenarioRun, error) {
+	metadata := Metadata.ShelleyMaryMetadata{
+		Metadata: Metadata.Metadata{
+			cip20Label: map[string]any{"msg": cip20Message(env.cfg.Features.MetadataBytes)},
+		},
+	}
+	return prepareFeature(env, fmt.Sprintf("CIP-20 message of %d bytes", env.cfg.Features.MetadataBytes),
+		func(b *apollo.Apollo) *apollo.Apollo {
+			return b.SetShelleyMetadata(metadata)
+		})
+}
+
+func prepareValidity(env *scenarioEnv) (*scenarioRun, error) {
+	start, err := env.chainCtx.LastBlockSlot()
+	if err != nil {
+		return nil, fmt.Errorf("fetch tip slot: %w", err)
+	}
+	ttl := start + env.cfg.Features.ValidityWindow
+	return prepareFeature(env, fmt.Sprintf("valid from slot %d to %d", start, ttl),
+		func(b *apollo.Apollo) *apollo.Apollo {
+			return b.SetValidityStart(int64(start)).SetTtl(int64(ttl))
+		})
+}
+
+func prepareWithdrawals(env *scenarioEnv) (*scenarioRun, error) {
+	rewards := make([]Address.Address, env.cfg.Features.Withdrawals)
+	for i := range rewards {
+		rewards[i] = rewardAddress(env.sender, i)
+	}
+	return prepareFeature(env, fmt.Sprintf("%d withdrawal(s) of %d lovelace", len(rewards), withdrawalLovelace),
+		func(b *apollo.Apollo) *apollo.Apollo {
+			for _, addr := range rewards {
+				b = b.AddWithdrawal(addr, withdrawalLovelace, PlutusData.PlutusData{})
+			}
+			return b
+		})
+}
+
+// prepareFeature prepares a payment scenario whose builds also apply
+// features. One transaction is built up front so that the result reports
+// the transaction size the feature leads to.
+func prepareFeature(env *scenarioEnv, feature string, features func(*apollo.Apollo) *apollo.Apollo) (*scenarioRun, error) {
+	run := &scenarioRun{
+		utxos: env.utxos,
+		build: func(utxos []UTxO.UTxO) (*Transaction.Transaction, error) {
+			return buildTransactionWith(utxos, &env.sender, env.chainCtx, env.outputs, features)
+		},
+	}
+
+	// The size is only informative, features too large to fit are expected
+	// to fail and are reported as failed iterations.
+	var txSize int
+	if tx, err := run.buildOnce(env.cfg.DeepClone); err == nil {
+		if cbor, err := tx.Bytes(); err == nil {
+			txSize = len(cbor)
+		}
+	}
+
+	run.report = func(result *BenchmarkResult, _ int) {
+		result.Feature = feature
+		result.TxSize = txSize
+	}
+	return run, nil
+}
+
+// cip20Message returns a CIP-20 message of n bytes split into lines.
+func cip20Message(n int) []string {
+	const text = "apollo-bench transaction message. "
+	body := strings.Repeat(text, n/len(text)+1)[:n]
+	lines := make([]string, 0, n/cip20LineBytes+1)
+	for len(body) > cip20LineBytes {
+		lines = append(lines, body[:cip20LineBytes])
+		body = body[cip20LineBytes:]
+	}
+	return append(lines, body)
+}
+
+// rewardAddress derives the index-th reward address of the wallet of
+// sender. The first one is the sender's own stake credential.
+func rewardAddress(sender Address.Address, index int) Address.Address {
+	staking := sender.StakingPart
+	if index > 0 || len(staking) != serialization.VERIFICATION_KEY_HASH_SIZE {
+		seed := sha256.Sum256(fmt.Appendf(nil, "%x/reward/%d", sender.PaymentPart, index))
+		staking = seed[:serialization.VERIFICATION_KEY_HASH_SIZE]
+	}
+	return Address.Address{
+		StakingPart: staking,
+		Network:     sender.Network,
+		AddressType: Address.NONE_KEY,
+		HeaderByte:  Address.NONE_KEY<<4 | sender.Network,
+		Hrp:         Address.ComputeHrp(Address.NONE_KEY, sender.Network),
+	}
+}
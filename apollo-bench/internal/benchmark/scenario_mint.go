@@ -0,0 +1,318 @@
+package benchmark
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/Salvionied/apollo"
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Asset"
+	"github.com/Salvionied/apollo/serialization/AssetName"
+	"github.com/Salvionied/apollo/serialization/MultiAsset"
+	"github.com/Salvionied/apollo/serialization/NativeScript"
+	"github.com/Salvionied/apollo/serialization/PlutusData"
+	"github.com/Salvionied/apollo/serialization/Policy"
+	"github.com/Salvionied/apollo/serialization/Redeemer"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/TransactionInput"
+	"github.com/Salvionied/apollo/serialization/TransactionOutput"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/serialization/Value"
+)
+
+// ScenarioMint is the scenario name of minting and burning assets.
+const ScenarioMint = "mint"
+
+const (
+	// mintProbeIterations and mintProbeWarmup size the builds of every
+	// step of the mint map growth probe.
+	mintProbeIterations = 50
+	mintProbeWarmup     = 5
+	// mintLockSlot is the slot the native-script policies stop minting
+	// after, each policy adds its index to it to get a distinct hash.
+	mintLockSlot = 100_000_000
+	// burnUtxoLovelace is held next to the assets the scenario burns.
+	burnUtxoLovelace = 2_000_000
+)
+
+// mintRedeemerExUnits are the execution units declared for every Plutus
+// policy. The fixed chain context does not evaluate scripts, so they are
+// never replaced by an evaluation.
+var mintRedeemerExUnits = Redeemer.ExecutionUnits{Mem: 500_000, Steps: 200_000_000}
+
+// alwaysSucceedsV2 is the CBOR of a Plutus V2 minting policy that accepts
+// any redeemer. The scenario appends the policy index to it to get distinct
+// policy IDs; the fixed chain context never executes the scripts.
+var alwaysSucceedsV2, _ = hex.DecodeString("4e4d01000033222220051200120011")
+
+// MintConfig sizes the mint map of the mint scenario.
+type MintConfig struct {
+	// Assets is the number of assets minted and Burns the number of assets
+	// burned by every transaction.
+	Assets int `json:"assets"`
+	Burns  int `json:"burns"`
+	// NativePolicies and PlutusPolicies are the number of native-script and
+	// Plutus policies the assets are spread over, round-robin.
+	NativePolicies int `json:"native_policies"`
+	PlutusPolicies int `json:"plutus_policies"`
+}
+
+// MintStepResult is one step of the mint map growth probe.
+type MintStepResult struct {
+	Assets     int           `json:"assets"`
+	Policies   int           `json:"policies"`
+	AvgLatency time.Duration `json:"avg_latency"`
+	TxSize     int           `json:"tx_size"`
+	Failures   int           `json:"failures"`
+	Iterations int           `json:"iterations"`
+	FirstError string        `json:"first_error,omitempty"`
+}
+
+// mintPolicy is a policy of the mint scenario. Plutus policies carry their
+// script, native-script ones cannot be attached with the pinned Apollo
+// builder and are only referenced by their hash.
+type mintPolicy struct {
+	id     string
+	plutus PlutusData.PlutusV2Script
+}
+
+// mintPolicies returns the policies of cfg, native-script ones first.
+func mintPolicies(cfg MintConfig, owner Address.Address) ([]mintPolicy, error) {
+	policies := make([]mintPolicy, 0, cfg.NativePolicies+cfg.PlutusPolicies)
+	for i := range cfg.NativePolicies {
+		script := NativeScript.NewScriptAll([]NativeScript.NativeScript{
+			NativeScript.NewScriptPubKey(owner.PaymentPart),
+			NativeScript.NewInvalidHereafter(int64(mintLockSlot + i)),
+		})
+		hash, err := script.Hash()
+		if err != nil {
+			return nil, fmt.Errorf("hash native script %d: %w", i, err)
+		}
+		policies = append(policies, mintPolicy{id: hex.EncodeToString(hash.Bytes())})
+	}
+	for i := range cfg.PlutusPolicies {
+		script := PlutusData.PlutusV2Script(binary.BigEndian.AppendUint32(append([]byte(nil), alwaysSucceedsV2...), uint32(i)))
+		hash, err := script.Hash()
+		if err != nil {
+			return nil, fmt.Errorf("hash Plutus script %d: %w", i, err)
+		}
+		policies = append(policies, mintPolicy{id: hex.EncodeToString(hash.Bytes()), plutus: script})
+	}
+	return policies, nil
+}
+
+// mintPlan is the mint map of one transaction.
+type mintPlan struct {
+	units    []apollo.Unit
+	scripts  []PlutusData.PlutusV2Script
+	redeemer map[string]Redeemer.Redeemer
+	policies int
+}
+
+// newMintPlan spreads assets minted and burns burned assets over policies,
+// round-robin. Burned assets are named apart from minted ones.
+func newMintPlan(policies []mintPolicy, assets, burns int) mintPlan {
+	plan := mintPlan{redeemer: make(map[string]Redeemer.Redeemer)}
+	used := make(map[string]mintPolicy)
+	for i := range assets + burns {
+		p := policies[i%len(policies)]
+		used[p.id] = p
+		unit := apollo.NewUnit(p.id, fmt.Sprintf("mint%d", i), 1)
+		if i >= assets {
+			unit = apollo.NewUnit(p.id, fmt.Sprintf("burn%d", i-assets), -1)
+		}
+		plan.units = append(plan.units, unit)
+	}
+
+	// Mint redeemers point at their policy in the sorted policy IDs of the
+	// mint field, which Apollo leaves to the caller.
+	ids := make([]string, 0, len(used))
+	for id := range used {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for index, id := range ids {
+		p := used[id]
+		if p.plutus == nil {
+			continue
+		}
+		plan.scripts = append(plan.scripts, p.plutus)
+		plan.redeemer[id] = Redeemer.Redeemer{
+			Tag:   Redeemer.MINT,
+			Index: index,
+			Data: PlutusData.PlutusData{
+				PlutusDataType: PlutusData.PlutusArray,
+				TagNr:          121,
+				Value:          PlutusData.PlutusIndefArray{},
+			},
+			ExUnits: mintRedeemerExUnits,
+		}
+	}
+	plan.policies = len(ids)
+	return plan
+}
+
+// apply adds the plan's mint map, scripts and redeemers to b.
+func (p mintPlan) apply(b *apollo.Apollo) *apollo.Apollo {
+	for _, script := range p.scripts {
+		b = b.AttachV2Script(script)
+	}
+	for _, unit := range p.units {
+		if redeemer, ok := p.redeemer[unit.PolicyId]; ok {
+			b = b.MintAssetsWithRedeemer(unit, redeemer)
+		} else {
+			b = b.MintAssets(unit)
+		}
+	}
+	return b
+}
+
+// burnUtxos returns one UTxO per policy at owner holding the assets plan
+// burns, as if they had been minted by an earlier transaction.
+func burnUtxos(plan mintPlan, owner Address.Address) []UTxO.UTxO {
+	held := make(map[string]Asset.Asset[int64])
+	var ids []string
+	for _, unit := range plan.units {
+		if unit.Quantity >= 0 {
+			continue
+		}
+		if _, ok := held[unit.PolicyId]; !ok {
+			held[unit.PolicyId] = Asset.Asset[int64]{}
+			ids = append(ids, unit.PolicyId)
+		}
+		held[unit.PolicyId][AssetName.NewAssetNameFromString(unit.Name)] = int64(-unit.Quantity)
+	}
+	sort.Strings(ids)
+
+	utxos := make([]UTxO.UTxO, 0, len(ids))
+	for i, id := range ids {
+		hash := sha256.Sum256(fmt.Appendf(nil, "apollo-bench burn %s", id))
+		assets := MultiAsset.MultiAsset[int64]{Policy.PolicyId{Value: id}: held[id]}
+		utxos = append(utxos, UTxO.UTxO{
+			Input: TransactionInput.TransactionInput{TransactionId: hash[:], Index: i},
+			Output: TransactionOutput.SimpleTransactionOutput(
+				owner, Value.SimpleValue(burnUtxoLovelace, assets)),
+		})
+	}
+	return utxos
+}
+
+func validateMint(c Config) error {
+	switch {
+	case c.Mint.Assets < 0 || c.Mint.Burns < 0:
+		return errors.New("minted and burned assets must be >= 0")
+	case c.Mint.Assets+c.Mint.Burns == 0:
+		return errors.New("mint scenario needs assets to mint or burn")
+	case c.Mint.NativePolicies < 0 || c.Mint.PlutusPolicies < 0:
+		return errors.New("mint policies must be >= 0")
+	case c.Mint.NativePolicies+c.Mint.PlutusPolicies == 0:
+		return errors.New("mint scenario needs at least one policy")
+	}
+	return nil
+}
+
+func prepareMint(env *scenarioEnv) (*scenarioRun, error) {
+	cfg := env.cfg.Mint
+	policies, err := mintPolicies(cfg, env.sender)
+	if err != nil {
+		return nil, err
+	}
+	plan := newMintPlan(policies, cfg.Assets, cfg.Burns)
+
+	// The assets to burn are held by the sender, whose wallet the builds
+	// spend.
+	utxos := append(append([]UTxO.UTxO(nil), env.utxos...), burnUtxos(plan, env.sender)...)
+	run := mintRun(env, utxos, plan)
+
+	var txSize int
+	if tx, err := run.buildOnce(env.cfg.DeepClone); err == nil {
+		if cbor, err := tx.Bytes(); err == nil {
+			txSize = len(cbor)
+		}
+	}
+
+	run.report = func(result *BenchmarkResult, _ int) {
+		result.Feature = fmt.Sprintf("mint %d, burn %d asset(s) under %d native-script and %d Plutus policies",
+			cfg.Assets, cfg.Burns, cfg.NativePolicies, cfg.PlutusPolicies)
+		result.TxSize = txSize
+		slog.Info("Probing mint map growth", "assets", cfg.Assets, "iterations", mintProbeIterations)
+		result.MintSteps = probeMintGrowth(env, policies, cfg.Assets)
+	}
+	return run, nil
+}
+
+// mintRun returns the run building the payment of env from utxos with the
+// mints and burns of plan.
+func mintRun(env *scenarioEnv, utxos []UTxO.UTxO, plan mintPlan) *scenarioRun {
+	return &scenarioRun{
+		utxos: utxos,
+		build: func(utxos []UTxO.UTxO) (*Transaction.Transaction, error) {
+			return buildTransactionWith(utxos, &env.sender, env.chainCtx, env.outputs, plan.apply)
+		},
+	}
+}
+
+// mintGrowthSteps returns the mint map sizes of the growth probe: powers of
+// two up to assets, and assets itself.
+func mintGrowthSteps(assets int) []int {
+	var steps []int
+	for n := 1; n < assets; n *= 2 {
+		steps = append(steps, n)
+	}
+	return append(steps, assets)
+}
+
+// probeMintGrowth builds transactions minting a growing number of assets
+// over the same policies and reports the latency and size of each step.
+func probeMintGrowth(env *scenarioEnv, policies []mintPolicy, assets int) []MintStepResult {
+	if assets == 0 {
+		return nil
+	}
+	steps := make([]MintStepResult, 0)
+	for _, n := range mintGrowthSteps(assets) {
+		plan := newMintPlan(policies, n, 0)
+		run := mintRun(env, env.utxos, plan)
+		step := MintStepResult{Assets: n, Policies: plan.policies, Iterations: mintProbeIterations}
+
+		for range mintProbeWarmup {
+			run.buildOnce(env.cfg.DeepClone)
+		}
+		var total time.Duration
+		for range mintProbeIterations {
+			utxos, err := run.inputs(env.cfg.DeepClone)
+			var (
+				tx      *Transaction.Transaction
+				elapsed time.Duration
+			)
+			if err == nil {
+				start := time.Now()
+				tx, err = run.build(utxos)
+				elapsed = time.Since(start)
+			}
+			if err != nil {
+				step.Failures++
+				if step.FirstError == "" {
+					step.FirstError = err.Error()
+				}
+				continue
+			}
+			total += elapsed
+			if step.TxSize == 0 {
+				if cbor, err := tx.Bytes(); err == nil {
+					step.TxSize = len(cbor)
+				}
+			}
+		}
+		if ok := mintProbeIterations - step.Failures; ok > 0 {
+			step.AvgLatency = total / time.Duration(ok)
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
@@ -0,0 +1,513 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/shirou/gopsutil/process"
+)
+
+// ErrSoakTrend is returned when a soak run flags heap, RSS or goroutine
+// growth or latency drift.
+var ErrSoakTrend = errors.New("soak run shows resource growth or latency drift")
+
+// minTrendSamples is the number of samples below which trends are fitted
+// but never flagged.
+const minTrendSamples = 5
+
+// mannKendall95 is the Mann-Kendall z-score of a monotonic trend at the 5%
+// significance level.
+const mannKendall95 = 1.96
+
+// SoakConfig controls a soak run. The builds themselves are described by
+// the benchmark Config, whose Parallelism is the number of workers.
+type SoakConfig struct {
+	// Duration is how long arrivals are generated at Rate, in tx/s.
+	Duration time.Duration
+	Rate     float64
+	// Interval is the time between samples.
+	Interval time.Duration
+	// MaxQueue bounds the arrivals waiting for a worker, more are dropped.
+	MaxQueue int
+	// Arrivals is one of ArrivalProcesses, Seed seeds the Poisson gaps.
+	Arrivals string
+	Seed     int64
+	// MaxGrowth is the relative growth of heap, RSS and goroutines over the
+	// run, and MaxLatencyDrift that of the p50 and p99 latency, above which
+	// a monotonic increase is flagged.
+	MaxGrowth       float64
+	MaxLatencyDrift float64
+	// OnSample, if set, is called with every sample as it is taken, e.g. to
+	// stream the time series to a file.
+	OnSample func(SoakSample)
+}
+
+// DefaultSoakConfig returns the settings the soak command uses when no
+// flags are given.
+func DefaultSoakConfig() SoakConfig {
+	return SoakConfig{
+		Duration:        time.Hour,
+		Rate:            100,
+		Interval:        time.Minute,
+		MaxQueue:        10000,
+		Arrivals:        ArrivalsPoisson,
+		MaxGrowth:       0.1,
+		MaxLatencyDrift: 0.1,
+	}
+}
+
+// Validate reports the first invalid setting in c.
+func (c SoakConfig) Validate() error {
+	switch {
+	case c.Duration <= 0:
+		return errors.New("soak duration must be > 0")
+	case c.Rate <= 0:
+		return errors.New("rate must be > 0")
+	case c.Interval <= 0:
+		return errors.New("sample interval must be > 0")
+	case c.Interval > c.Duration:
+		return errors.New("sample interval must not exceed the soak duration")
+	case c.MaxQueue <= 0:
+		return errors.New("max queue must be > 0")
+	case c.Arrivals != ArrivalsPoisson && c.Arrivals != ArrivalsUniform:
+		return fmt.Errorf("unknown arrival process %q (%s, %s)", c.Arrivals, ArrivalsPoisson, ArrivalsUniform)
+	case c.MaxGrowth <= 0 || c.MaxLatencyDrift <= 0:
+		return errors.New("growth and drift thresholds must be > 0")
+	}
+	return nil
+}
+
+// SoakSample holds the builds finished during one interval of a soak run
+// and the process state at its end.
+type SoakSample struct {
+	Elapsed time.Duration `json:"elapsed"`
+	Time    time.Time     `json:"time"`
+	// Builds counts the builds finished in the interval, including
+	// Failures. Dropped counts arrivals finding the queue full.
+	Builds     int     `json:"builds"`
+	Failures   int     `json:"failures"`
+	Dropped    int     `json:"dropped"`
+	Throughput float64 `json:"throughput"`
+	LatencyPercentiles
+	// HeapInuse is the heap in use at the sample, HeapLive the heap marked
+	// live by the last garbage collection, which leaks show up in without
+	// the noise of garbage not yet collected.
+	HeapInuse  uint64 `json:"heap_inuse"`
+	HeapLive   uint64 `json:"heap_live"`
+	RSS        uint64 `json:"rss"`
+	Goroutines int    `json:"goroutines"`
+	GCCycles   uint32 `json:"gc_cycles"`
+}
+
+// Trend is a line fitted through one metric of the samples of a soak run.
+type Trend struct {
+	Metric string `json:"metric"`
+	Name   string `json:"name"`
+	Unit   string `json:"unit"`
+	// Start and End are the fitted values at the first and last sample,
+	// Change their relative difference and SlopePerHour the fitted change
+	// per hour.
+	Start        float64 `json:"start"`
+	End          float64 `json:"end"`
+	Change       float64 `json:"change"`
+	SlopePerHour float64 `json:"slope_per_hour"`
+	R2           float64 `json:"r2"`
+	// MannKendallZ tests for a monotonic trend, see MannKendallZ.
+	MannKendallZ float64 `json:"mann_kendall_z"`
+	// Threshold is the Change above which a monotonic increase is flagged,
+	// zero for metrics reported only.
+	Threshold float64 `json:"threshold,omitempty"`
+	Flagged   bool    `json:"flagged"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// SoakResult is the time series and trends of a soak run.
+type SoakResult struct {
+	Scenario    string        `json:"scenario"`
+	Rate        float64       `json:"rate"`
+	Parallelism int           `json:"parallelism"`
+	Arrivals    string        `json:"arrivals"`
+	Interval    time.Duration `json:"interval"`
+	Duration    time.Duration `json:"duration"`
+	// Elapsed is how long the run took, Interrupted is set when it was
+	// cancelled before Duration.
+	Elapsed     time.Duration `json:"elapsed"`
+	Interrupted bool          `json:"interrupted,omitempty"`
+	UTXOInput   int           `json:"utxo_input"`
+	UTXOOutput  int           `json:"utxo_output"`
+	UTxOLevel   int           `json:"utxo_level"`
+	Builds      int           `json:"builds"`
+	Failures    int           `json:"failures"`
+	Dropped     int           `json:"dropped"`
+	Samples     []SoakSample  `json:"samples"`
+	Trends      []Trend       `json:"trends"`
+	SystemInfo  SystemInfo    `json:"system_info"`
+}
+
+// Flagged reports whether any trend of the run was flagged.
+func (r SoakResult) Flagged() bool {
+	for _, t := range r.Trends {
+		if t.Flagged {
+			return true
+		}
+	}
+	return false
+}
+
+// Soak metric classes, which select the threshold a metric's trend is
+// flagged by.
+const (
+	soakReport = iota
+	soakGrowth
+	soakLatency
+)
+
+// soakMetrics are the sample metrics trends are fitted for.
+var soakMetrics = []struct {
+	metric, name, unit string
+	class              int
+	value              func(SoakSample) float64
+}{
+	{"heap_inuse", "Heap In Use", "MiB", soakGrowth, func(s SoakSample) float64 { return float64(s.HeapInuse) / (1 << 20) }},
+	{"heap_live", "Live Heap", "MiB", soakGrowth, func(s SoakSample) float64 { return float64(s.HeapLive) / (1 << 20) }},
+	{"rss", "RSS", "MiB", soakGrowth, func(s SoakSample) float64 { return float64(s.RSS) / (1 << 20) }},
+	{"goroutines", "Goroutines", "", soakGrowth, func(s SoakSample) float64 { return float64(s.Goroutines) }},
+	{"p50", "p50 Latency", "ms", soakLatency, func(s SoakSample) float64 { return durationMs(s.P50) }},
+	{"p99", "p99 Latency", "ms", soakLatency, func(s SoakSample) float64 { return durationMs(s.P99) }},
+	{"throughput", "Throughput", "tx/s", soakReport, func(s SoakSample) float64 { return s.Throughput }},
+}
+
+// soakSampler accumulates the builds of the current interval and samples
+// the process state.
+type soakSampler struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	spare     []time.Duration
+	failures  int
+	dropped   int
+
+	proc *process.Process
+	last time.Time
+}
+
+func (s *soakSampler) record(res Result, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies = append(s.latencies, latency)
+	if res.Error != nil {
+		s.failures++
+	}
+}
+
+func (s *soakSampler) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+}
+
+// take closes the current interval and returns its sample.
+func (s *soakSampler) take(start time.Time) SoakSample {
+	s.mu.Lock()
+	// Swap buffers so the workers keep recording while the finished
+	// interval is sorted, without growing a new slice every interval.
+	latencies := s.latencies
+	s.latencies, s.spare = s.spare[:0], latencies
+	sample := SoakSample{Builds: len(latencies), Failures: s.failures, Dropped: s.dropped}
+	s.failures, s.dropped = 0, 0
+	s.mu.Unlock()
+
+	now := time.Now()
+	sample.Time = now
+	sample.Elapsed = now.Sub(start)
+	if seconds := now.Sub(s.last).Seconds(); seconds > 0 {
+		sample.Throughput = float64(sample.Builds-sample.Failures) / seconds
+	}
+	s.last = now
+	sample.LatencyPercentiles = percentiles(latencies)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	sample.HeapInuse = ms.HeapInuse
+	sample.GCCycles = ms.NumGC
+	live := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(live)
+	if live[0].Value.Kind() == metrics.KindUint64 {
+		sample.HeapLive = live[0].Value.Uint64()
+	}
+	sample.Goroutines = runtime.NumGoroutine()
+	if s.proc != nil {
+		if mem, err := s.proc.MemoryInfo(); err == nil {
+			sample.RSS = mem.RSS
+		}
+	}
+	return sample
+}
+
+// ExecuteSoak builds cfg.Scenario at a steady open-loop rate for
+// soakCfg.Duration, samples latency percentiles and process state every
+// soakCfg.Interval and fits trends through the samples. Cancelling ctx ends
+// the run early; the samples taken so far are still returned, marked
+// Interrupted.
+func ExecuteSoak(ctx context.Context, cfg Config, soakCfg SoakConfig) (*SoakResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := soakCfg.Validate(); err != nil {
+		return nil, err
+	}
+	slog.Info("Starting soak run",
+		"scenario", cfg.Scenario,
+		"rate", soakCfg.Rate,
+		"parallelism", cfg.Parallelism,
+		"duration", soakCfg.Duration,
+		"interval", soakCfg.Interval,
+		"arrivals", soakCfg.Arrivals)
+
+	iterate, closeRun, err := prepareIterate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRun()
+
+	if _, err := runWarmup(ctx, cfg.Warmup, cfg.Parallelism, iterate); err != nil {
+		return nil, err
+	}
+	runtime.GC()
+
+	sampler := &soakSampler{}
+	if sampler.proc, err = process.NewProcess(int32(os.Getpid())); err != nil {
+		slog.Warn("RSS not available", "error", err)
+	}
+	loop := openLoop{
+		rate:        soakCfg.Rate,
+		parallelism: cfg.Parallelism,
+		maxQueue:    soakCfg.MaxQueue,
+		arrivals:    soakCfg.Arrivals,
+		rng:         rand.New(rand.NewSource(soakCfg.Seed)),
+		drop:        sampler.drop,
+	}
+
+	result := &SoakResult{
+		Scenario:    cfg.Scenario,
+		Rate:        soakCfg.Rate,
+		Parallelism: cfg.Parallelism,
+		Arrivals:    soakCfg.Arrivals,
+		Interval:    soakCfg.Interval,
+		Duration:    soakCfg.Duration,
+		UTXOInput:   cfg.UTxOInput,
+		UTXOOutput:  cfg.UTxOOutput,
+		UTxOLevel:   cfg.UTxOLevel,
+	}
+	addSample := func(sample SoakSample) {
+		result.Samples = append(result.Samples, sample)
+		result.Builds += sample.Builds
+		result.Failures += sample.Failures
+		result.Dropped += sample.Dropped
+		slog.Info("Soak sample",
+			"elapsed", sample.Elapsed.Round(time.Second),
+			"builds", sample.Builds,
+			"p99", sample.P99,
+			"heapInuse", sample.HeapInuse,
+			"rss", sample.RSS,
+			"goroutines", sample.Goroutines)
+		if soakCfg.OnSample != nil {
+			soakCfg.OnSample(sample)
+		}
+	}
+
+	start := time.Now()
+	sampler.last = start
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loop.run(ctx, 0, soakCfg.Duration, iterate, sampler.record)
+	}()
+
+	ticker := time.NewTicker(soakCfg.Interval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			addSample(sampler.take(start))
+		case <-done:
+			running = false
+		}
+	}
+	// The process state after the workers stopped is not that of the run,
+	// the builds since the last tick only count in the totals.
+	tail := sampler.take(start)
+	result.Builds += tail.Builds
+	result.Failures += tail.Failures
+	result.Dropped += tail.Dropped
+
+	result.Elapsed = time.Since(start)
+	if ctx.Err() != nil {
+		result.Interrupted = true
+		slog.Warn("Soak run interrupted", "elapsed", result.Elapsed.Round(time.Second), "samples", len(result.Samples))
+	}
+	result.Trends = soakTrends(result.Samples, soakCfg)
+	result.SystemInfo = GetSystemInfo()
+	return result, nil
+}
+
+// soakTrends fits a line through every soak metric and flags significant
+// monotonic increases beyond the thresholds of soakCfg.
+func soakTrends(samples []SoakSample, soakCfg SoakConfig) []Trend {
+	if len(samples) == 0 {
+		return nil
+	}
+	hours := make([]float64, len(samples))
+	for i, s := range samples {
+		hours[i] = s.Elapsed.Hours()
+	}
+	first, last := hours[0], hours[len(hours)-1]
+
+	trends := make([]Trend, 0, len(soakMetrics))
+	for _, m := range soakMetrics {
+		values := make([]float64, len(samples))
+		for i, s := range samples {
+			values[i] = m.value(s)
+		}
+		slope, intercept, r2 := LinearFit(hours, values)
+		t := Trend{
+			Metric:       m.metric,
+			Name:         m.name,
+			Unit:         m.unit,
+			Start:        intercept + slope*first,
+			End:          intercept + slope*last,
+			SlopePerHour: slope,
+			R2:           r2,
+			MannKendallZ: MannKendallZ(values),
+		}
+		if t.Start != 0 {
+			t.Change = (t.End - t.Start) / math.Abs(t.Start)
+		}
+		switch m.class {
+		case soakGrowth:
+			t.Threshold = soakCfg.MaxGrowth
+		case soakLatency:
+			t.Threshold = soakCfg.MaxLatencyDrift
+		}
+		if m.class != soakReport && len(samples) >= minTrendSamples &&
+			t.MannKendallZ > mannKendall95 && t.Change > t.Threshold {
+			t.Flagged = true
+			t.Reason = fmt.Sprintf("%s rises monotonically (Mann-Kendall z %.2f): %+.1f%% over the run, %.2f -> %.2f %s, %+.2f %s/h",
+				m.name, t.MannKendallZ, t.Change*100, t.Start, t.End, m.unit, slope, m.unit)
+			slog.Warn("Soak trend flagged", "metric", m.metric, "reason", t.Reason)
+		}
+		trends = append(trends, t)
+	}
+	return trends
+}
+
+// SoakCSVHeader returns the column names of the CSV time series, matching
+// SoakSample.CSVRecord.
+func SoakCSVHeader() []string {
+	return []string{"elapsed_s", "time", "builds", "failures", "dropped", "throughput",
+		"p50_ms", "p90_ms", "p99_ms", "max_ms", "heap_inuse", "heap_live", "rss", "goroutines", "gc_cycles"}
+}
+
+// CSVRecord returns s as a row of the CSV time series.
+func (s SoakSample) CSVRecord() []string {
+	ms := func(d time.Duration) string { return strconv.FormatFloat(durationMs(d), 'f', 3, 64) }
+	return []string{
+		strconv.FormatFloat(s.Elapsed.Seconds(), 'f', 3, 64),
+		s.Time.Format(time.RFC3339),
+		strconv.Itoa(s.Builds),
+		strconv.Itoa(s.Failures),
+		strconv.Itoa(s.Dropped),
+		strconv.FormatFloat(s.Throughput, 'f', 2, 64),
+		ms(s.P50), ms(s.P90), ms(s.P99), ms(s.Max),
+		strconv.FormatUint(s.HeapInuse, 10),
+		strconv.FormatUint(s.HeapLive, 10),
+		strconv.FormatUint(s.RSS, 10),
+		strconv.Itoa(s.Goroutines),
+		strconv.FormatUint(uint64(s.GCCycles), 10),
+	}
+}
+
+// PrintSoak writes result in the given format: the trends as a table, or
+// the result with every sample as JSON.
+func PrintSoak(result SoakResult, format string) error {
+	switch format {
+	case "json":
+		return WriteSoakJSON(os.Stdout, result)
+	default:
+		printSoakTable(result)
+	}
+	return nil
+}
+
+// WriteSoakJSON writes result to w as indented JSON.
+func WriteSoakJSON(w io.Writer, result SoakResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("encode JSON: %w", err)
+	}
+	return nil
+}
+
+func printSoakTable(result SoakResult) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Metric", "Start", "End", "Change", "Slope/h", "R²", "Mann-Kendall z", "Verdict"})
+	table.SetBorder(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+
+	elapsed := result.Elapsed.Round(time.Second).String()
+	if result.Interrupted {
+		elapsed = color.HiRedString(elapsed + " (interrupted)")
+	}
+	table.Append([]string{color.HiMagentaString("SOAK SUMMARY"), result.Scenario,
+		fmt.Sprintf("%.2f tx/s", result.Rate), fmt.Sprintf("%d worker(s)", result.Parallelism), elapsed,
+		fmt.Sprintf("%d samples", len(result.Samples)), "", ""})
+	failures := fmt.Sprintf("%d builds, %d failed, %d dropped", result.Builds, result.Failures, result.Dropped)
+	if result.Failures > 0 || result.Dropped > 0 {
+		failures = color.HiRedString(failures)
+	}
+	table.Append([]string{"Builds", failures, "", "", "", "", "", ""})
+
+	for _, t := range result.Trends {
+		format := func(v float64) string {
+			if t.Unit == "" {
+				return fmt.Sprintf("%.2f", v)
+			}
+			return fmt.Sprintf("%.2f %s", v, t.Unit)
+		}
+		verdict := "reported"
+		switch {
+		case t.Flagged:
+			verdict = color.HiRedString("flagged")
+		case t.Threshold > 0 && len(result.Samples) < minTrendSamples:
+			verdict = "too few samples"
+		case t.Threshold > 0:
+			verdict = color.HiGreenString("stable")
+		}
+		table.Append([]string{t.Name, format(t.Start), format(t.End), fmt.Sprintf("%+.2f%%", t.Change*100),
+			format(t.SlopePerHour), fmt.Sprintf("%.2f", t.R2), fmt.Sprintf("%.2f", t.MannKendallZ), verdict})
+	}
+	table.Render()
+
+	for _, t := range result.Trends {
+		if t.Flagged {
+			fmt.Fprintln(os.Stdout, color.HiRedString(t.Reason))
+		}
+	}
+}
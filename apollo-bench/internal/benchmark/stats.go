@@ -0,0 +1,288 @@
+package benchmark
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// tTable95 holds two-sided 95% critical values of Student's t distribution
+// for 1 to 30 degrees of freedom.
+var tTable95 = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tCritical95 returns the two-sided 95% critical value for df degrees of
+// freedom, falling back to the normal approximation for large samples.
+func tCritical95(df int) float64 {
+	if df < 1 {
+		return math.Inf(1)
+	}
+	if df <= len(tTable95) {
+		return tTable95[df-1]
+	}
+	return 1.96
+}
+
+// Mean returns the arithmetic mean of xs.
+func Mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// StdDev returns the sample standard deviation of xs.
+func StdDev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	mean := Mean(xs)
+	var sq float64
+	for _, x := range xs {
+		sq += (x - mean) * (x - mean)
+	}
+	return math.Sqrt(sq / float64(len(xs)-1))
+}
+
+// CI95 returns the half-width of the 95% confidence interval of the mean of
+// xs.
+func CI95(xs []float64) float64 {
+	if len(xs) < 2 {
+		return math.Inf(1)
+	}
+	return tCritical95(len(xs)-1) * StdDev(xs) / math.Sqrt(float64(len(xs)))
+}
+
+// DefaultOutlierThreshold is the modified z-score above which a value is
+// an outlier, as recommended by Iglewicz and Hoaglin.
+const DefaultOutlierThreshold = 3.5
+
+// DefaultTrimFraction is the share of values TrimmedMean drops at each end.
+const DefaultTrimFraction = 0.2
+
+// Median returns the median of xs.
+func Median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// TrimmedMean returns the mean of xs without the lowest and highest
+// fraction of its values.
+func TrimmedMean(xs []float64, fraction float64) float64 {
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+	trim := int(float64(len(sorted)) * fraction)
+	if 2*trim >= len(sorted) {
+		return Median(xs)
+	}
+	return Mean(sorted[trim : len(sorted)-trim])
+}
+
+// MAD returns the median absolute deviation of xs from their median.
+func MAD(xs []float64) float64 {
+	median := Median(xs)
+	deviations := make([]float64, len(xs))
+	for i, x := range xs {
+		deviations[i] = math.Abs(x - median)
+	}
+	return Median(deviations)
+}
+
+// Outlier is a value far from the median of the values it was measured
+// with.
+type Outlier struct {
+	// Trial is the 1-based trial number of the value, or its position when
+	// trials are not numbered.
+	Trial int     `json:"trial"`
+	Value float64 `json:"value"`
+	// Score is the modified z-score of the value.
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
+// ModifiedZScores returns the modified z-score 0.6745 * (x - median) / MAD
+// of every value in xs. When more than half the values are equal, MAD is
+// zero and the mean absolute deviation is used instead. The scores are zero
+// when all values are equal.
+func ModifiedZScores(xs []float64) []float64 {
+	scores := make([]float64, len(xs))
+	median, mad := Median(xs), MAD(xs)
+	scale := mad / 0.6745
+	if mad == 0 {
+		var sum float64
+		for _, x := range xs {
+			sum += math.Abs(x - median)
+		}
+		scale = sum / float64(len(xs)) * 1.253314
+	}
+	if scale == 0 {
+		return scores
+	}
+	for i, x := range xs {
+		scores[i] = (x - median) / scale
+	}
+	return scores
+}
+
+// DetectOutliers returns the values of xs whose modified z-score exceeds
+// threshold, describing them with metric and unit. trials numbers the
+// values, positions are used when it is nil. Fewer than three values have
+// no outliers.
+func DetectOutliers(xs []float64, trials []int, threshold float64, metric, unit string) []Outlier {
+	if len(xs) < 3 {
+		return nil
+	}
+	median := Median(xs)
+	var outliers []Outlier
+	for i, score := range ModifiedZScores(xs) {
+		if math.Abs(score) <= threshold {
+			continue
+		}
+		trial := i + 1
+		if trials != nil {
+			trial = trials[i]
+		}
+		direction := "above"
+		if score < 0 {
+			direction = "below"
+		}
+		outliers = append(outliers, Outlier{
+			Trial: trial,
+			Value: xs[i],
+			Score: score,
+			Reason: fmt.Sprintf("%s %.2f %s is %.1f robust deviations %s the median %.2f %s (threshold %.1f)",
+				metric, xs[i], unit, math.Abs(score), direction, median, unit, threshold),
+		})
+	}
+	return outliers
+}
+
+// trialOutliers returns the trials of results whose wall-clock throughput
+// is an outlier, numbering results without a Trial by position, and the
+// results to aggregate: all of them, or with opts.Exclude those that are not
+// outliers.
+func trialOutliers(results []BenchmarkResult, opts OutlierOptions) (kept []BenchmarkResult, outliers []Outlier) {
+	tps := make([]float64, len(results))
+	trials := make([]int, len(results))
+	for i, r := range results {
+		tps[i] = r.WallClockTPS
+		trials[i] = r.Trial
+		if trials[i] == 0 {
+			trials[i] = i + 1
+		}
+	}
+	outliers = DetectOutliers(tps, trials, opts.Threshold, "wall_clock_tps", "tx/s")
+	if !opts.Exclude || len(outliers) == 0 {
+		return results, outliers
+	}
+	excluded := make(map[int]bool, len(outliers))
+	for _, o := range outliers {
+		excluded[o.Trial] = true
+	}
+	kept = make([]BenchmarkResult, 0, len(results))
+	for i, r := range results {
+		if !excluded[trials[i]] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, outliers
+}
+
+// LinearFit returns the least-squares line y = intercept + slope*x through
+// the points and its coefficient of determination r2. Fewer than two
+// points, or points sharing one x, fit a flat line through the mean.
+func LinearFit(xs, ys []float64) (slope, intercept, r2 float64) {
+	meanX, meanY := Mean(xs), Mean(ys)
+	var sxx, sxy, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, meanY, 0
+	}
+	slope = sxy / sxx
+	intercept = meanY - slope*meanX
+	if syy > 0 {
+		r2 = sxy * sxy / (sxx * syy)
+	}
+	return slope, intercept, r2
+}
+
+// MannKendallZ returns the normal score of the Mann-Kendall trend test of
+// xs in sample order, corrected for ties. Above 1.96 the series increases
+// monotonically at the 5% significance level, below -1.96 it decreases.
+func MannKendallZ(xs []float64) float64 {
+	n := len(xs)
+	var s float64
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			switch {
+			case xs[j] > xs[i]:
+				s++
+			case xs[j] < xs[i]:
+				s--
+			}
+		}
+	}
+	ties := make(map[float64]int)
+	for _, x := range xs {
+		ties[x]++
+	}
+	variance := float64(n*(n-1)*(2*n+5)) / 18
+	for _, t := range ties {
+		variance -= float64(t*(t-1)*(2*t+5)) / 18
+	}
+	switch {
+	case variance <= 0:
+		return 0
+	case s > 0:
+		return (s - 1) / math.Sqrt(variance)
+	case s < 0:
+		return (s + 1) / math.Sqrt(variance)
+	}
+	return 0
+}
+
+// successLatencies returns the latencies of all successful results, in
+// nanoseconds.
+func successLatencies(results []Result) []float64 {
+	latencies := make([]float64, 0, len(results))
+	for _, res := range results {
+		if res.Error == nil {
+			latencies = append(latencies, float64(res.Duration))
+		}
+	}
+	return latencies
+}
+
+// latencyPrecision returns the 95% confidence interval half-width of the
+// mean latency of results, absolute and relative to the mean. ok is false
+// when fewer than two builds succeeded.
+func latencyPrecision(results []Result) (ci time.Duration, rel float64, ok bool) {
+	latencies := successLatencies(results)
+	halfWidth := CI95(latencies)
+	mean := Mean(latencies)
+	if math.IsInf(halfWidth, 1) || mean == 0 {
+		return 0, 0, false
+	}
+	return time.Duration(halfWidth), halfWidth / mean, true
+}
@@ -0,0 +1,194 @@
+package benchmark
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// approx reports whether got is within 1e-3 of want, or both are the same
+// infinity.
+func approx(got, want float64) bool {
+	if math.IsInf(want, 0) {
+		return got == want
+	}
+	return math.Abs(got-want) < 1e-3
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name string
+		xs   []float64
+		want float64
+	}{
+		{"empty", nil, 0},
+		{"single", []float64{5}, 5},
+		{"odd", []float64{3, 1, 2}, 2},
+		{"even", []float64{4, 1, 3, 2}, 2.5},
+		{"outlier", []float64{1, 2, 3, 4, 100}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Median(tt.xs); !approx(got, tt.want) {
+				t.Errorf("Median(%v) = %v, want %v", tt.xs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	tests := []struct {
+		name     string
+		xs       []float64
+		fraction float64
+		want     float64
+	}{
+		{"empty", nil, DefaultTrimFraction, 0},
+		{"single", []float64{5}, DefaultTrimFraction, 5},
+		{"odd", []float64{1, 2, 3, 4, 100}, DefaultTrimFraction, 3},
+		{"even", []float64{100, 1, 2, 3, 4, 5, 6, 7, 8, 9}, DefaultTrimFraction, 5.5},
+		{"no trim", []float64{1, 2, 3, 4, 100}, 0, 22},
+		{"trims all", []float64{1, 2, 3, 4}, 0.5, 2.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimmedMean(tt.xs, tt.fraction); !approx(got, tt.want) {
+				t.Errorf("TrimmedMean(%v, %v) = %v, want %v", tt.xs, tt.fraction, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectOutliers(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs     []float64
+		trials []int
+		want   []int
+	}{
+		{"empty", nil, nil, nil},
+		{"single", []float64{5}, nil, nil},
+		{"two", []float64{1, 100}, nil, nil},
+		{"all equal", []float64{10, 10, 10, 10}, nil, nil},
+		{"one above", []float64{10, 11, 9, 10, 12, 10, 100}, nil, []int{7}},
+		{"one below", []float64{100, 101, 99, 100, 1}, nil, []int{5}},
+		{"numbered trials", []float64{10, 11, 9, 10, 12, 10, 100}, []int{2, 3, 4, 5, 6, 7, 8}, []int{8}},
+		// MAD is zero, the mean absolute deviation scales the scores.
+		{"zero MAD", []float64{10, 10, 10, 10, 100}, nil, []int{5}},
+		// Every value is as far from the median as the others.
+		{"all outliers", []float64{1, 1, 1, 100, 100, 100}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outliers := DetectOutliers(tt.xs, tt.trials, DefaultOutlierThreshold, "latency", "ms")
+			var got []int
+			for _, o := range outliers {
+				got = append(got, o.Trial)
+				if math.Abs(o.Score) <= DefaultOutlierThreshold {
+					t.Errorf("trial %d has score %v within the threshold", o.Trial, o.Score)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("outlier trials = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("outlier trials = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCI95(t *testing.T) {
+	tests := []struct {
+		name string
+		xs   []float64
+		want float64
+	}{
+		{"empty", nil, math.Inf(1)},
+		{"single", []float64{5}, math.Inf(1)},
+		{"odd", []float64{1, 2, 3}, 2.4843},
+		{"even", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 1.7878},
+		{"all equal", []float64{3, 3, 3, 3}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CI95(tt.xs); !approx(got, tt.want) {
+				t.Errorf("CI95(%v) = %v, want %v", tt.xs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyPrecision(t *testing.T) {
+	failed := Result{Duration: time.Second, Error: errors.New("build failed")}
+	tests := []struct {
+		name    string
+		results []Result
+		ci      time.Duration
+		rel     float64
+		ok      bool
+	}{
+		{"empty", nil, 0, 0, false},
+		{"single", []Result{{Duration: 100}}, 0, 0, false},
+		{"failures only", []Result{failed, failed}, 0, 0, false},
+		{"skips failures", []Result{{Duration: 100}, failed, {Duration: 200}, {Duration: 300}}, 248, 1.2422, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ci, rel, ok := latencyPrecision(tt.results)
+			if ci != tt.ci || !approx(rel, tt.rel) || ok != tt.ok {
+				t.Errorf("latencyPrecision = %v, %v, %v, want %v, %v, %v", ci, rel, ok, tt.ci, tt.rel, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLinearFit(t *testing.T) {
+	tests := []struct {
+		name                 string
+		xs, ys               []float64
+		slope, intercept, r2 float64
+	}{
+		{"empty", nil, nil, 0, 0, 0},
+		{"single", []float64{1}, []float64{5}, 0, 5, 0},
+		{"same x", []float64{2, 2, 2}, []float64{1, 2, 3}, 0, 2, 0},
+		{"flat", []float64{0, 1, 2}, []float64{4, 4, 4}, 0, 4, 0},
+		{"exact", []float64{0, 1, 2, 3}, []float64{1, 3, 5, 7}, 2, 1, 1},
+		{"noisy", []float64{0, 1, 2, 3}, []float64{1, 3, 2, 5}, 1.1, 1.1, 0.6914},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slope, intercept, r2 := LinearFit(tt.xs, tt.ys)
+			if !approx(slope, tt.slope) || !approx(intercept, tt.intercept) || !approx(r2, tt.r2) {
+				t.Errorf("LinearFit = %v, %v, %v, want %v, %v, %v",
+					slope, intercept, r2, tt.slope, tt.intercept, tt.r2)
+			}
+		})
+	}
+}
+
+func TestMannKendallZ(t *testing.T) {
+	tests := []struct {
+		name string
+		xs   []float64
+		want float64
+	}{
+		{"empty", nil, 0},
+		{"single", []float64{5}, 0},
+		{"all equal", []float64{3, 3, 3, 3}, 0},
+		{"increasing", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 3.9355},
+		{"decreasing", []float64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, -3.9355},
+		{"ties", []float64{1, 2, 2, 3}, 1.4446},
+		{"no trend", []float64{1, 3, 2, 4, 3, 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MannKendallZ(tt.xs); !approx(got, tt.want) {
+				t.Errorf("MannKendallZ(%v) = %v, want %v", tt.xs, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,24 +2,53 @@ package benchmark
 
 import (
 	"log"
+	"os"
 	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
 
 	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/mem"
 )
 
 type SystemInfo struct {
 	GoVersion    string
 	OS           string
+	Arch         string
 	CPUModel     string
 	TotalMemory  uint64
 	AvailableMem uint64
+
+	LogicalCores  int
+	PhysicalCores int
+	GOMAXPROCS    int
+	CPUMhz        float64
+	CPUGovernor   string
+
+	// Cgroup limits are zero when the process is not constrained or the
+	// limits could not be read. CgroupCPULimit is expressed in cores.
+	CgroupCPULimit    float64
+	CgroupMemoryLimit uint64
+
+	LoadAvg1  float64
+	LoadAvg5  float64
+	LoadAvg15 float64
+
+	ApolloVersion string
+	ApolloReplace string
+	SuiteRevision string
+	SuiteVCSTime  string
+	SuiteModified bool
 }
 
 func GetSystemInfo() SystemInfo {
 	info := SystemInfo{
-		GoVersion: runtime.Version(),
-		OS:        runtime.GOOS,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
 	}
 
 	// Handle memory metrics
@@ -37,7 +66,146 @@ func GetSystemInfo() SystemInfo {
 		log.Printf("Failed to get CPU info: %v", err)
 	} else {
 		info.CPUModel = cpuInfo[0].ModelName
+		info.CPUMhz = cpuInfo[0].Mhz
+	}
+
+	if n, err := cpu.Counts(true); err != nil {
+		log.Printf("Failed to get logical core count: %v", err)
+	} else {
+		info.LogicalCores = n
+	}
+	if n, err := cpu.Counts(false); err != nil {
+		log.Printf("Failed to get physical core count: %v", err)
+	} else {
+		info.PhysicalCores = n
+	}
+
+	// Scaling frequency is more telling than the model's nominal clock when
+	// a governor is throttling the machine.
+	if mhz, ok := readCPUScalingMhz(); ok {
+		info.CPUMhz = mhz
+	}
+	info.CPUGovernor = readSysFile("/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor")
+
+	// Handle load metrics
+	loadAvg, err := load.Avg()
+	if err != nil {
+		log.Printf("Failed to get load average: %v", err)
+	} else {
+		info.LoadAvg1 = loadAvg.Load1
+		info.LoadAvg5 = loadAvg.Load5
+		info.LoadAvg15 = loadAvg.Load15
+	}
+
+	info.CgroupCPULimit = readCgroupCPULimit()
+	info.CgroupMemoryLimit = readCgroupMemoryLimit()
+
+	// Handle build metrics
+	info.ApolloVersion, info.ApolloReplace = apolloModule()
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.SuiteRevision = setting.Value
+			case "vcs.time":
+				info.SuiteVCSTime = setting.Value
+			case "vcs.modified":
+				info.SuiteModified = setting.Value == "true"
+			}
+		}
 	}
 
 	return info
 }
+
+// ApolloVersion returns the version of github.com/Salvionied/apollo linked
+// into the running binary, following any replace directive.
+func ApolloVersion() string {
+	version, _ := apolloModule()
+	return version
+}
+
+// apolloModule returns the resolved Apollo version and, when go.mod replaces
+// the module, the replacement as path@version.
+func apolloModule() (version, replace string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown", ""
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != apolloModulePath {
+			continue
+		}
+		if dep.Replace == nil {
+			return dep.Version, ""
+		}
+		replace = dep.Replace.Path
+		if dep.Replace.Version != "" {
+			replace += "@" + dep.Replace.Version
+			return dep.Replace.Version, replace
+		}
+		// Local directory replacement, there is no version to report.
+		return dep.Replace.Path, replace
+	}
+	return "unknown", ""
+}
+
+func readCPUScalingMhz() (float64, bool) {
+	raw := readSysFile("/sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq")
+	khz, err := strconv.ParseFloat(raw, 64)
+	if err != nil || khz <= 0 {
+		return 0, false
+	}
+	return khz / 1000, true
+}
+
+func readCgroupCPULimit() float64 {
+	// cgroup v2: "<quota> <period>" or "max <period>"
+	if fields := strings.Fields(readSysFile("/sys/fs/cgroup/cpu.max")); len(fields) == 2 {
+		quota, errQ := strconv.ParseFloat(fields[0], 64)
+		period, errP := strconv.ParseFloat(fields[1], 64)
+		if errQ == nil && errP == nil && period > 0 {
+			return quota / period
+		}
+		return 0
+	}
+
+	// cgroup v1
+	quota, errQ := strconv.ParseFloat(readSysFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us"), 64)
+	period, errP := strconv.ParseFloat(readSysFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us"), 64)
+	if errQ == nil && errP == nil && quota > 0 && period > 0 {
+		return quota / period
+	}
+	return 0
+}
+
+func readCgroupMemoryLimit() uint64 {
+	for _, path := range []string{
+		"/sys/fs/cgroup/memory.max",                   // cgroup v2
+		"/sys/fs/cgroup/memory/memory.limit_in_bytes", // cgroup v1
+	} {
+		raw := readSysFile(path)
+		if raw == "" {
+			continue
+		}
+		limit, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			// "max" means unlimited
+			return 0
+		}
+		// cgroup v1 reports an unlimited group as a huge page-aligned value.
+		if limit >= 1<<62 {
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
+
+func readSysFile(path string) string {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(raw))
+}
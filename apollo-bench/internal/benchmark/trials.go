@@ -0,0 +1,223 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// TrialMetric aggregates one metric over the successful trials of a run.
+type TrialMetric struct {
+	// Metric is the JSON name of the metric in BenchmarkResult, Name its
+	// name in the table output.
+	Metric string  `json:"metric"`
+	Name   string  `json:"name"`
+	Unit   string  `json:"unit"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	// Median, TrimmedMean and MAD are robust against outlier trials.
+	Median      float64 `json:"median"`
+	TrimmedMean float64 `json:"trimmed_mean"`
+	MAD         float64 `json:"mad"`
+	// CV is the coefficient of variation, StdDev relative to Mean.
+	CV float64 `json:"cv"`
+}
+
+// TrialSummary aggregates the trials of a run.
+type TrialSummary struct {
+	Trials       int    `json:"trials"`
+	FailedTrials int    `json:"failed_trials,omitempty"`
+	FreshProcess bool   `json:"fresh_process,omitempty"`
+	Scenario     string `json:"scenario"`
+	// Errors holds the error of every failed trial.
+	Errors []string `json:"errors,omitempty"`
+	// Outliers are the trials whose wall-clock throughput is far from the
+	// median. With OutliersExcluded they are left out of Metrics.
+	Outliers         []Outlier     `json:"outliers,omitempty"`
+	OutliersExcluded bool          `json:"outliers_excluded,omitempty"`
+	Metrics          []TrialMetric `json:"metrics"`
+}
+
+// TrialsResult is the result of a run with several trials: the summary and
+// the result of every successful trial.
+type TrialsResult struct {
+	Summary TrialSummary      `json:"summary"`
+	Trials  []BenchmarkResult `json:"trials"`
+}
+
+// trialMetrics are the metrics aggregated over trials.
+var trialMetrics = []struct {
+	metric, name, unit string
+	value              func(BenchmarkResult) float64
+}{
+	{"wall_clock_tps", "Wall-clock Tx/s", "tx/s", func(r BenchmarkResult) float64 { return r.WallClockTPS }},
+	{"latency_tps", "Latency-based Tx/s", "tx/s", func(r BenchmarkResult) float64 { return r.LatencyTPS }},
+	{"avg_latency", "Avg Latency/Transaction", "ms", func(r BenchmarkResult) float64 { return durationMs(r.AvgLatency) }},
+	{"latency_ci95_rel", "Latency 95% CI", "%", func(r BenchmarkResult) float64 { return r.LatencyCI95Rel * 100 }},
+	{"failures", "Failures", "", func(r BenchmarkResult) float64 { return float64(r.Failures) }},
+	{"bench_duration", "Bench Duration", "s", func(r BenchmarkResult) float64 { return r.BenchDuration.Seconds() }},
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ExecuteTrials calls run for trials 1 to n one after another and
+// aggregates the results, handling outlier trials as outliers says. Failed
+// trials are logged and counted; the run only fails when every trial did, or
+// when ctx is cancelled.
+func ExecuteTrials(ctx context.Context, n int, outliers OutlierOptions, run func(ctx context.Context, trial int) (*BenchmarkResult, error)) (*TrialsResult, error) {
+	result := &TrialsResult{Summary: TrialSummary{Trials: n}}
+	for trial := 1; trial <= n; trial++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		slog.Info("Starting trial", "trial", trial, "trials", n)
+		res, err := run(ctx, trial)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Error("Trial failed", "trial", trial, "error", err)
+			result.Summary.FailedTrials++
+			result.Summary.Errors = append(result.Summary.Errors, fmt.Sprintf("trial %d: %v", trial, err))
+			continue
+		}
+		res.Trial = trial
+		slog.Info("Trial finished", "trial", trial, "wallClockTPS", res.WallClockTPS, "avgLatency", res.AvgLatency)
+		result.Trials = append(result.Trials, *res)
+	}
+	if len(result.Trials) == 0 {
+		return nil, fmt.Errorf("all %d trials failed, first error: %s", n, result.Summary.Errors[0])
+	}
+	result.Summary.Scenario = result.Trials[0].Scenario
+	result.Summary.Metrics, result.Summary.Outliers = AggregateTrials(result.Trials, outliers)
+	result.Summary.OutliersExcluded = outliers.Exclude && len(result.Summary.Outliers) > 0
+	for _, o := range result.Summary.Outliers {
+		slog.Warn("Outlier trial", "trial", o.Trial, "excluded", outliers.Exclude, "reason", o.Reason)
+	}
+	return result, nil
+}
+
+// AggregateTrials returns the mean, standard deviation, range, coefficient
+// of variation and robust statistics of every trial metric over results,
+// and the trials whose wall-clock throughput is an outlier. With
+// opts.Exclude the outliers are left out of the metrics.
+func AggregateTrials(results []BenchmarkResult, opts OutlierOptions) ([]TrialMetric, []Outlier) {
+	results, outliers := trialOutliers(results, opts)
+
+	metrics := make([]TrialMetric, 0, len(trialMetrics))
+	for _, m := range trialMetrics {
+		values := make([]float64, len(results))
+		for i, r := range results {
+			values[i] = m.value(r)
+		}
+		tm := TrialMetric{
+			Metric: m.metric,
+			Name:   m.name,
+			Unit:   m.unit,
+			Mean:   Mean(values),
+			StdDev: StdDev(values),
+			Min:    math.Inf(1),
+			Max:    math.Inf(-1),
+
+			Median:      Median(values),
+			TrimmedMean: TrimmedMean(values, DefaultTrimFraction),
+			MAD:         MAD(values),
+		}
+		for _, v := range values {
+			tm.Min = math.Min(tm.Min, v)
+			tm.Max = math.Max(tm.Max, v)
+		}
+		if tm.Mean != 0 {
+			tm.CV = tm.StdDev / math.Abs(tm.Mean)
+		}
+		metrics = append(metrics, tm)
+	}
+	return metrics, outliers
+}
+
+// PrintTrials writes result in the given format: the summary as a table, or
+// the summary and every trial as JSON.
+func PrintTrials(result TrialsResult, format string) error {
+	switch format {
+	case "json":
+		return WriteTrialsJSON(os.Stdout, result)
+	default:
+		printTrialsTable(result)
+	}
+	return nil
+}
+
+// WriteTrialsJSON writes result to w as indented JSON.
+func WriteTrialsJSON(w io.Writer, result TrialsResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("encode JSON: %w", err)
+	}
+	return nil
+}
+
+func printTrialsTable(result TrialsResult) {
+	s := result.Summary
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Metric", "Mean", "StdDev", "Median", "Trimmed Mean", "MAD", "Min", "Max", "CV"})
+	table.SetBorder(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+
+	process := "in-process"
+	if s.FreshProcess {
+		process = "fresh process per trial"
+	}
+	trials := fmt.Sprintf("%d/%d successful", len(result.Trials), s.Trials)
+	if s.FailedTrials > 0 {
+		trials = color.HiRedString(trials)
+	} else {
+		trials = color.HiGreenString(trials)
+	}
+	table.Append([]string{color.HiMagentaString("TRIAL SUMMARY"), s.Scenario, trials, process, "", "", "", "", ""})
+
+	for _, m := range s.Metrics {
+		cv := fmt.Sprintf("%.2f%%", m.CV*100)
+		// More than 5% of variation between trials makes single trials
+		// unreliable for comparisons.
+		if m.CV > 0.05 {
+			cv = color.HiRedString(cv)
+		}
+		format := func(v float64) string {
+			if m.Unit == "" {
+				return fmt.Sprintf("%.2f", v)
+			}
+			return fmt.Sprintf("%.2f %s", v, m.Unit)
+		}
+		table.Append([]string{m.Name, format(m.Mean), format(m.StdDev), format(m.Median), format(m.TrimmedMean),
+			format(m.MAD), format(m.Min), format(m.Max), cv})
+	}
+	table.Render()
+
+	action := "flagged, kept in the summary"
+	if s.OutliersExcluded {
+		action = "excluded from the summary"
+	}
+	for _, o := range s.Outliers {
+		fmt.Fprintln(os.Stdout, color.HiRedString("Trial %d %s: %s", o.Trial, action, o.Reason))
+	}
+
+	for _, e := range s.Errors {
+		fmt.Fprintln(os.Stdout, color.HiRedString(e))
+	}
+}
@@ -15,6 +15,19 @@ import (
 	"github.com/Salvionied/apollo/serialization/Value"
 )
 
+// InitUtxosForLevel returns utxoCount UTxOs shaped for the given UTxO level:
+// 1 simple, 2 differentiated, 3 congested.
+func InitUtxosForLevel(level, utxoCount int) []UTxO.UTxO {
+	switch level {
+	case 2:
+		return InitUtxosDifferentiated(utxoCount)
+	case 3:
+		return InitUtxosCongested(utxoCount)
+	default:
+		return InitUtxos(utxoCount)
+	}
+}
+
 func InitUtxos(utxoCount int) []UTxO.UTxO {
 	utxos := make([]UTxO.UTxO, 0)
 	for i := range utxoCount {
@@ -0,0 +1,83 @@
+package benchmark
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// WarmupConfig controls the builds executed and discarded before measuring.
+type WarmupConfig struct {
+	// Iterations is the number of warm-up builds. In adaptive mode it is the
+	// upper bound instead.
+	Iterations int
+	// Adaptive keeps warming up until the rolling mean latency of the last
+	// Window builds is within Tolerance of the window before it.
+	Adaptive  bool
+	Window    int
+	Tolerance float64
+}
+
+// runWarmup executes warm-up builds and returns how many were run.
+func runWarmup(ctx context.Context, cfg WarmupConfig, parallelism int, fn func(iter int) Result) (int, error) {
+	if cfg.Iterations <= 0 {
+		return 0, nil
+	}
+	if !cfg.Adaptive {
+		slog.Info("Warm-up phase starting", "iterations", cfg.Iterations)
+		runBatch(ctx, 0, cfg.Iterations, parallelism, fn)
+		return cfg.Iterations, ctx.Err()
+	}
+
+	window := max(cfg.Window, 1)
+	slog.Info("Adaptive warm-up phase starting",
+		"window", window,
+		"tolerance", cfg.Tolerance,
+		"maxIterations", cfg.Iterations)
+
+	done := 0
+	prevMean := time.Duration(0)
+	for done < cfg.Iterations {
+		n := min(window, cfg.Iterations-done)
+		mean, ok := meanLatency(runBatch(ctx, done, n, parallelism, fn))
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		done += n
+		if !ok {
+			// Nothing succeeded, there is no latency to stabilize on yet.
+			continue
+		}
+
+		if prevMean > 0 {
+			drift := math.Abs(float64(mean-prevMean)) / float64(prevMean)
+			slog.Debug("Warm-up window finished", "iterations", done, "meanLatency", mean, "drift", drift)
+			if drift <= cfg.Tolerance {
+				slog.Info("Latency reached steady state", "iterations", done, "meanLatency", mean, "drift", drift)
+				return done, nil
+			}
+		}
+		prevMean = mean
+	}
+
+	slog.Warn("Latency did not stabilize during warm-up", "iterations", done, "tolerance", cfg.Tolerance)
+	return done, nil
+}
+
+func meanLatency(results []Result) (time.Duration, bool) {
+	var (
+		total     time.Duration
+		successes int
+	)
+	for _, res := range results {
+		if res.Error == nil {
+			total += res.Duration
+			successes++
+		}
+	}
+	if successes == 0 {
+		return 0, false
+	}
+	return total / time.Duration(successes), true
+}
@@ -0,0 +1,247 @@
+package versions
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const apolloModulePath = "github.com/Salvionied/apollo"
+
+// certificatesTag builds the certificates scenario, which needs an Apollo
+// version with (*Apollo).SetCertificates.
+const certificatesTag = "apollo_certificates"
+
+// skippedDirs are never copied into the temporary module, they either hold
+// results, build output or VCS state that the build does not need.
+var skippedDirs = map[string]bool{
+	".git":     true,
+	"bin":      true,
+	"scripts":  true,
+	"testdata": true,
+}
+
+// Binary is an apollo-bench executable linked against a specific Apollo
+// version.
+type Binary struct {
+	Requested string
+	Resolved  string
+	Path      string
+	Cached    bool
+}
+
+// Builder compiles apollo-bench against arbitrary Apollo versions in
+// throw-away copies of the module, so the working tree is never touched.
+type Builder struct {
+	ModuleDir string
+	CacheDir  string
+}
+
+// Build returns an apollo-bench binary linked against the requested Apollo
+// version, building it if no cached binary exists for the resolved version
+// and the current suite sources.
+func (b *Builder) Build(ctx context.Context, version string) (Binary, error) {
+	bin := Binary{Requested: version}
+
+	tmpDir, err := os.MkdirTemp("", "apollo-bench-"+sanitize(version)+"-")
+	if err != nil {
+		return bin, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sourceHash, err := copyModule(b.ModuleDir, tmpDir)
+	if err != nil {
+		return bin, fmt.Errorf("copy module: %w", err)
+	}
+
+	var apolloDir string
+	bin.Resolved, apolloDir, err = resolveVersion(ctx, tmpDir, version)
+	if err != nil {
+		return bin, err
+	}
+	slog.Debug("Resolved Apollo version", "requested", version, "resolved", bin.Resolved)
+
+	binDir := filepath.Join(b.CacheDir, sanitize(bin.Resolved)+"-"+sourceHash[:12])
+	bin.Path = filepath.Join(binDir, "apollo-bench")
+	if _, err := os.Stat(bin.Path); err == nil {
+		bin.Cached = true
+		slog.Info("Using cached binary", "version", version, "resolved", bin.Resolved, "path", bin.Path)
+		return bin, nil
+	}
+
+	build := []string{"go", "build", "-o", filepath.Join(tmpDir, "apollo-bench")}
+	certificates, err := hasCertificates(apolloDir)
+	if err != nil {
+		return bin, err
+	}
+	if certificates {
+		build = append(build, "-tags", certificatesTag)
+	}
+	slog.Info("Building binary", "version", version, "resolved", bin.Resolved, "certificates", certificates)
+	steps := [][]string{
+		{"go", "mod", "edit", "-replace", apolloModulePath + "=" + apolloModulePath + "@" + bin.Resolved},
+		{"go", "mod", "tidy"},
+		append(build, "./cmd/benchmark"),
+	}
+	for _, step := range steps {
+		if _, err := goCommand(ctx, tmpDir, step...); err != nil {
+			return bin, err
+		}
+	}
+
+	// Move the binary into the cache only once it is complete, so an
+	// interrupted build never leaves a broken cache entry behind.
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return bin, err
+	}
+	if err := copyFile(filepath.Join(tmpDir, "apollo-bench"), bin.Path+".tmp", 0o755); err != nil {
+		return bin, err
+	}
+	if err := os.Rename(bin.Path+".tmp", bin.Path); err != nil {
+		return bin, err
+	}
+	slog.Info("Binary built", "version", version, "path", bin.Path)
+	return bin, nil
+}
+
+// DefaultCacheDir returns the directory binaries are cached in when no
+// explicit cache directory is configured.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "apollo-bench", "bin")
+}
+
+// resolveVersion downloads the requested Apollo version and returns its
+// canonical version and the directory of its sources.
+func resolveVersion(ctx context.Context, moduleDir, version string) (string, string, error) {
+	out, err := goCommand(ctx, moduleDir, "go", "mod", "download", "-json", apolloModulePath+"@"+version)
+	var module struct {
+		Version string
+		Dir     string
+		Error   string
+	}
+	if jsonErr := json.Unmarshal(out, &module); jsonErr != nil {
+		if err != nil {
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("decode go mod download output: %w", jsonErr)
+	}
+	if module.Error != "" {
+		return "", "", fmt.Errorf("resolve %s@%s: %s", apolloModulePath, version, module.Error)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return module.Version, module.Dir, nil
+}
+
+// hasCertificates reports whether the Apollo sources in dir can attach
+// certificates to a transaction.
+func hasCertificates(dir string) (bool, error) {
+	src, err := os.ReadFile(filepath.Join(dir, "ApolloBuilder.go"))
+	if err != nil {
+		return false, fmt.Errorf("inspect Apollo sources: %w", err)
+	}
+	return bytes.Contains(src, []byte("func (b *Apollo) SetCertificates(")), nil
+}
+
+func goCommand(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	slog.Debug("Running command", "dir", dir, "args", args)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("%s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// copyModule copies the Go sources of the module in src to dst and returns a
+// hash of everything copied, which identifies the suite build.
+func copyModule(src, dst string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != src && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := d.Name()
+		if name == "go.mod" || name == "go.sum" || strings.HasSuffix(name, ".go") {
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no Go sources found in %s", src)
+	}
+	sort.Strings(files)
+
+	hash := sha256.New()
+	for _, rel := range files {
+		data, err := os.ReadFile(filepath.Join(src, rel))
+		if err != nil {
+			return "", err
+		}
+		target := filepath.Join(dst, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", filepath.ToSlash(rel), len(data))
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func sanitize(version string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_", "@", "_").Replace(version)
+}
@@ -0,0 +1,42 @@
+package versions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// WriteCorpora writes the golden corpus of every binary with the inputs of
+// params to resultsDir/<version>_golden. It returns the corpus directories
+// by requested version.
+func WriteCorpora(ctx context.Context, bins []Binary, params Params, resultsDir string) (map[string]string, error) {
+	dirs := make(map[string]string, len(bins))
+	for _, bin := range bins {
+		dir := filepath.Join(resultsDir, fmt.Sprintf("%s_golden", sanitize(bin.Requested)))
+		args := []string{
+			"corpus",
+			"--utxo-input", strconv.Itoa(params.UTxOInput),
+			"--utxo-output", strconv.Itoa(params.UTxOOutput),
+			"--utxo-level", strconv.Itoa(params.UTxOLevel),
+			"--dir", dir,
+			"--log-level", "error",
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, bin.Path, args...)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return dirs, ctx.Err()
+			}
+			return dirs, fmt.Errorf("golden corpus of %s: %w: %s", bin.Requested, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		dirs[bin.Requested] = dir
+		slog.Info("Golden corpus written", "version", bin.Requested, "dir", dir)
+	}
+	return dirs, nil
+}
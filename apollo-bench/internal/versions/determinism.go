@@ -0,0 +1,64 @@
+package versions
+
+import (
+	"apollo-bench/internal/benchmark"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// RunDeterminism runs the determinism check of every binary with the inputs
+// of params, builds times per scenario, and stores each report in
+// resultsDir. It returns the reports by requested version.
+func RunDeterminism(ctx context.Context, bins []Binary, params Params, builds int, resultsDir string) (map[string]*benchmark.DeterminismReport, error) {
+	reports := make(map[string]*benchmark.DeterminismReport, len(bins))
+	for _, bin := range bins {
+		file := filepath.Join(resultsDir, fmt.Sprintf("%s_determinism.json", sanitize(bin.Requested)))
+		args := []string{
+			"determinism",
+			"--utxo-input", strconv.Itoa(params.UTxOInput),
+			"--utxo-output", strconv.Itoa(params.UTxOOutput),
+			"--utxo-level", strconv.Itoa(params.UTxOLevel),
+			"--parallelism", strconv.Itoa(params.Parallelism),
+			"--builds", strconv.Itoa(builds),
+			"--save", file,
+			"--output", "json",
+			"--log-level", "error",
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, bin.Path, args...)
+		cmd.Stderr = &stderr
+		runErr := cmd.Run()
+		if ctx.Err() != nil {
+			return reports, ctx.Err()
+		}
+
+		// A nondeterministic or failing version exits with an error after
+		// saving its report, which is still worth comparing.
+		if _, err := os.Stat(file); err != nil {
+			if runErr != nil {
+				return reports, fmt.Errorf("determinism check of %s: %w: %s", bin.Requested, runErr, bytes.TrimSpace(stderr.Bytes()))
+			}
+			return reports, err
+		}
+		report, err := benchmark.LoadDeterminismReport(file)
+		if err != nil {
+			return reports, err
+		}
+		if !report.Deterministic() {
+			slog.Warn("Version builds nondeterministic transactions", "version", bin.Requested, "report", file)
+		}
+		if report.Failed() {
+			slog.Warn("Version failed determinism check builds", "version", bin.Requested, "report", file)
+		}
+		reports[bin.Requested] = report
+		slog.Info("Determinism check finished", "version", bin.Requested, "scenarios", len(report.Scenarios))
+	}
+	return reports, nil
+}
@@ -0,0 +1,58 @@
+package versions
+
+import (
+	"apollo-bench/internal/benchmark"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/pprof/profile"
+)
+
+// Profile kinds written by trials with TrialOptions.Profile.
+const (
+	ProfileCPU   = "cpu"
+	ProfileAlloc = "alloc"
+)
+
+// ProfileFile is the file a trial writes its profile of the given kind to.
+func ProfileFile(resultsDir, version string, trial int, kind string) string {
+	return filepath.Join(resultsDir, fmt.Sprintf("%s_trial%d.%s.pprof", sanitize(version), trial, kind))
+}
+
+// DiffProfiles merges the profiles of kind of the successful trials of base
+// and candidate and reports which Apollo functions got hotter or cooler per
+// transaction built, listing up to top of each.
+func DiffProfiles(resultsDir string, results map[string][]benchmark.BenchmarkResult, base, candidate, kind string, top int) (*benchmark.ProfileDiff, error) {
+	sampleType := map[string]string{ProfileCPU: benchmark.SampleTypeCPU, ProfileAlloc: benchmark.SampleTypeAlloc}[kind]
+	merge := func(version string) (*profile.Profile, int, error) {
+		var (
+			files        []string
+			transactions int
+		)
+		for _, r := range results[version] {
+			files = append(files, ProfileFile(resultsDir, version, r.Trial, kind))
+			transactions += r.Iterations
+		}
+		if len(files) == 0 {
+			return nil, 0, fmt.Errorf("no successful trials of %s to profile", version)
+		}
+		p, err := benchmark.MergeProfiles(files)
+		return p, transactions, err
+	}
+
+	baseProfile, baseTxs, err := merge(base)
+	if err != nil {
+		return nil, err
+	}
+	candProfile, candTxs, err := merge(candidate)
+	if err != nil {
+		return nil, err
+	}
+	return benchmark.DiffProfiles(baseProfile, candProfile, benchmark.ProfileDiffOptions{
+		SampleType:   sampleType,
+		Focus:        benchmark.ApolloPackage,
+		BaseOps:      baseTxs,
+		CandidateOps: candTxs,
+		Top:          top,
+	})
+}
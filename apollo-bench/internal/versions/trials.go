@@ -0,0 +1,175 @@
+package versions
+
+import (
+	"apollo-bench/internal/benchmark"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Params are the benchmark flags passed to every trial.
+type Params struct {
+	UTxOInput   int
+	UTxOOutput  int
+	UTxOLevel   int
+	Iterations  int
+	Parallelism int
+}
+
+// Args returns params as apollo-bench command-line flags.
+func (p Params) Args() []string {
+	return []string{
+		"--utxo-input", strconv.Itoa(p.UTxOInput),
+		"--utxo-output", strconv.Itoa(p.UTxOOutput),
+		"--utxo-level", strconv.Itoa(p.UTxOLevel),
+		"--iterations", strconv.Itoa(p.Iterations),
+		"--parallelism", strconv.Itoa(p.Parallelism),
+		"--output", "json",
+		"--log-level", "error",
+	}
+}
+
+// Schedule decides the order in which trials of different versions run.
+type Schedule string
+
+const (
+	// ScheduleSequential runs all trials of one version before the next
+	// (AAA BBB).
+	ScheduleSequential Schedule = "sequential"
+	// ScheduleInterleaved alternates versions trial by trial (AB AB AB), so
+	// thermal drift and background load hit every version alike.
+	ScheduleInterleaved Schedule = "interleaved"
+	// ScheduleRandom runs all trials in a seeded random order.
+	ScheduleRandom Schedule = "random"
+)
+
+// ParseSchedule validates a schedule name.
+func ParseSchedule(name string) (Schedule, error) {
+	switch s := Schedule(name); s {
+	case ScheduleSequential, ScheduleInterleaved, ScheduleRandom:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown schedule %q (sequential, interleaved, random)", name)
+}
+
+// TrialOptions control how trials are scheduled and isolated from each other.
+type TrialOptions struct {
+	Trials   int
+	Schedule Schedule
+	Seed     int64
+	// Cooldown is slept between consecutive trials.
+	Cooldown time.Duration
+	// CPUAffinity pins every trial process to a CPU list, e.g. "2-3".
+	CPUAffinity string
+	// Profile makes every trial write its CPU and alloc profiles to the
+	// results directory, see ProfileFile.
+	Profile bool
+}
+
+type trialSlot struct {
+	bin   Binary
+	trial int
+}
+
+// plan returns every trial to run, in execution order.
+func plan(bins []Binary, opts TrialOptions) []trialSlot {
+	slots := make([]trialSlot, 0, len(bins)*opts.Trials)
+	switch opts.Schedule {
+	case ScheduleSequential:
+		for _, bin := range bins {
+			for i := 1; i <= opts.Trials; i++ {
+				slots = append(slots, trialSlot{bin: bin, trial: i})
+			}
+		}
+	default:
+		for i := 1; i <= opts.Trials; i++ {
+			for _, bin := range bins {
+				slots = append(slots, trialSlot{bin: bin, trial: i})
+			}
+		}
+		if opts.Schedule == ScheduleRandom {
+			rng := rand.New(rand.NewSource(opts.Seed))
+			rng.Shuffle(len(slots), func(a, b int) { slots[a], slots[b] = slots[b], slots[a] })
+		}
+	}
+	return slots
+}
+
+// RunTrials runs opts.Trials trials for every binary in the order given by
+// opts.Schedule and stores each trial's JSON result in resultsDir. Failed
+// trials are logged and left out of the returned results.
+func RunTrials(ctx context.Context, bins []Binary, params Params, opts TrialOptions, resultsDir string) (map[string][]benchmark.BenchmarkResult, error) {
+	slots := plan(bins, opts)
+	slog.Info("Running benchmark trials", "trials", len(slots), "schedule", opts.Schedule, "seed", opts.Seed)
+
+	results := make(map[string][]benchmark.BenchmarkResult, len(bins))
+	for n, slot := range slots {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		if n > 0 && opts.Cooldown > 0 {
+			slog.Debug("Cooling down before next trial", "cooldown", opts.Cooldown)
+			select {
+			case <-ctx.Done():
+				return results, ctx.Err()
+			case <-time.After(opts.Cooldown):
+			}
+		}
+
+		result, err := runTrial(ctx, slot.bin, params, opts, slot.trial, resultsDir)
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			slog.Error("Benchmark trial failed", "version", slot.bin.Requested, "trial", slot.trial, "error", err)
+			continue
+		}
+		results[slot.bin.Requested] = append(results[slot.bin.Requested], *result)
+		slog.Info("Benchmark trial finished",
+			"progress", fmt.Sprintf("%d/%d", n+1, len(slots)),
+			"version", slot.bin.Requested,
+			"trial", slot.trial,
+			"wallClockTPS", result.WallClockTPS)
+	}
+	return results, nil
+}
+
+func runTrial(ctx context.Context, bin Binary, params Params, opts TrialOptions, trial int, resultsDir string) (*benchmark.BenchmarkResult, error) {
+	args := params.Args()
+	if opts.CPUAffinity != "" {
+		args = append(args, "--cpu-affinity", opts.CPUAffinity)
+	}
+	if opts.Profile {
+		args = append(args,
+			"--cpu-profile", ProfileFile(resultsDir, bin.Requested, trial, ProfileCPU),
+			"--mem-profile", ProfileFile(resultsDir, bin.Requested, trial, ProfileAlloc))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin.Path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var result benchmark.BenchmarkResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("decode trial output: %w", err)
+	}
+	result.Trial = trial
+
+	file := filepath.Join(resultsDir, fmt.Sprintf("%s_trial%d.json", sanitize(bin.Requested), trial))
+	if err := os.WriteFile(file, stdout.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,115 @@
+// Package bench runs Apollo transaction-building benchmarks from Go code.
+//
+// It is the library behind the apollo-bench CLI: Run returns the result
+// instead of printing it and reports failures as errors instead of exiting,
+// so benchmarks can be driven from test harnesses and services.
+//
+//	cfg := bench.DefaultConfig()
+//	cfg.UTxOLevel = 2
+//	cfg.Iterations = 5000
+//	result, err := bench.Run(ctx, cfg)
+package bench
+
+import (
+	"apollo-bench/internal/benchmark"
+	"context"
+	"io"
+)
+
+type (
+	// Config describes a single benchmark run.
+	Config = benchmark.Config
+	// WarmupConfig controls the builds executed and discarded before
+	// measuring.
+	WarmupConfig = benchmark.WarmupConfig
+	// PrecisionConfig makes a run keep adding batches of iterations until
+	// the mean latency is known precisely enough.
+	PrecisionConfig = benchmark.PrecisionConfig
+	// FeatureConfig sizes the builder feature of the metadata, validity and
+	// withdrawals scenarios.
+	FeatureConfig = benchmark.FeatureConfig
+	// MintConfig sizes the mint map of the mint scenario.
+	MintConfig = benchmark.MintConfig
+	// BenchmarkResult holds the metrics of a finished run.
+	BenchmarkResult = benchmark.BenchmarkResult
+	// SystemInfo describes the host and build a result was measured on.
+	SystemInfo = benchmark.SystemInfo
+	// TrialsResult holds the results of several trials and their summary.
+	TrialsResult = benchmark.TrialsResult
+	// CapacityConfig controls the search of the highest arrival rate
+	// meeting a p99 latency SLO.
+	CapacityConfig = benchmark.CapacityConfig
+	// CapacityResult holds the latency curves of a capacity search.
+	CapacityResult = benchmark.CapacityResult
+	// SoakConfig controls a long run at a steady rate.
+	SoakConfig = benchmark.SoakConfig
+	// SoakResult holds the time series and trends of a soak run.
+	SoakResult = benchmark.SoakResult
+)
+
+// ErrAllIterationsFailed is returned by Run when no iteration built a
+// transaction.
+var ErrAllIterationsFailed = benchmark.ErrAllIterationsFailed
+
+// DefaultConfig returns the configuration the CLI uses when no flags are
+// given.
+func DefaultConfig() Config {
+	return benchmark.DefaultConfig()
+}
+
+// Scenarios returns the names accepted by Config.Scenario.
+func Scenarios() []string {
+	return benchmark.Scenarios()
+}
+
+// Networks returns the names accepted by Config.Network.
+func Networks() []string {
+	return benchmark.Networks()
+}
+
+// Run executes the benchmark described by cfg. Cancelling ctx stops
+// scheduling new iterations and makes Run return ctx's error.
+func Run(ctx context.Context, cfg Config) (*BenchmarkResult, error) {
+	return benchmark.Execute(ctx, cfg)
+}
+
+// RunTrials executes the benchmark described by cfg n times in this process
+// and summarizes the metrics of the successful trials. Outlier trials are
+// flagged but kept.
+func RunTrials(ctx context.Context, cfg Config, n int) (*TrialsResult, error) {
+	outliers := benchmark.OutlierOptions{Threshold: benchmark.DefaultOutlierThreshold}
+	return benchmark.ExecuteTrials(ctx, n, outliers, func(ctx context.Context, _ int) (*BenchmarkResult, error) {
+		return benchmark.Execute(ctx, cfg)
+	})
+}
+
+// DefaultCapacityConfig returns the capacity search settings the CLI uses
+// when no flags are given.
+func DefaultCapacityConfig() CapacityConfig {
+	return benchmark.DefaultCapacityConfig()
+}
+
+// RunCapacity searches the highest open-loop arrival rate of the builds
+// described by cfg whose p99 latency meets capCfg.SLOP99.
+func RunCapacity(ctx context.Context, cfg Config, capCfg CapacityConfig) (*CapacityResult, error) {
+	return benchmark.ExecuteCapacity(ctx, cfg, capCfg)
+}
+
+// DefaultSoakConfig returns the soak settings the CLI uses when no flags
+// are given.
+func DefaultSoakConfig() SoakConfig {
+	return benchmark.DefaultSoakConfig()
+}
+
+// RunSoak builds the transactions described by cfg at a steady rate for
+// soakCfg.Duration and fits trends through the sampled latency and process
+// state. Cancelling ctx ends the run early with the samples taken so far.
+func RunSoak(ctx context.Context, cfg Config, soakCfg SoakConfig) (*SoakResult, error) {
+	return benchmark.ExecuteSoak(ctx, cfg, soakCfg)
+}
+
+// WriteJSON writes result to w as indented JSON, in the format of the CLI's
+// --output json.
+func WriteJSON(w io.Writer, result *BenchmarkResult) error {
+	return benchmark.WriteJSON(w, *result)
+}
@@ -5,23 +5,23 @@ go 1.24.0
 toolchain go1.24.7
 
 require (
+	connectrpc.com/connect v1.18.1
 	github.com/Salvionied/apollo v1.3.1-0.20250926193222-abeb1639074d
 	github.com/blinklabs-io/bursa v0.11.0
+	github.com/fxamacker/cbor/v2 v2.9.0
 	github.com/lmittmann/tint v1.1.2
+	github.com/utxorpc/go-codegen v0.16.0
 )
 
 require (
-	connectrpc.com/connect v1.18.1 // indirect
 	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/blinklabs-io/gouroboros v0.121.0 // indirect
 	github.com/btcsuite/btcd/btcutil v1.1.6 // indirect
 	github.com/fivebinaries/go-cardano-serialization v0.0.0-20220907134105-ec9b85086588 // indirect
-	github.com/fxamacker/cbor/v2 v2.9.0 // indirect
 	github.com/jinzhu/copier v0.4.0 // indirect
 	github.com/kelseyhightower/envconfig v1.4.0 // indirect
 	github.com/maestro-org/go-sdk v1.2.1 // indirect
 	github.com/tyler-smith/go-bip39 v1.1.0 // indirect
-	github.com/utxorpc/go-codegen v0.16.0 // indirect
 	github.com/utxorpc/go-sdk v0.0.0-20250603130048-8c2c6c6648ea // indirect
 	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/crypto v0.42.0 // indirect
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"utxo-rpc-based-tx-builder/mockutxorpc"
+)
+
+// LOCAL_FUNDING is the lovelace the local stand-in gives user 1 at startup.
+const LOCAL_FUNDING int64 = 100_000_000
+
+// startLocalUtxorpc starts an in-process UTxO RPC stand-in whose ledger holds
+// a single UTxO of LOCAL_FUNDING lovelace at user 1's address.
+func startLocalUtxorpc() (*mockutxorpc.Server, error) {
+	ledger := mockutxorpc.NewLedger()
+	if _, err := ledger.Fund(GetUser1Wallet().Address, LOCAL_FUNDING); err != nil {
+		return nil, fmt.Errorf("fund user 1: %w", err)
+	}
+	server := mockutxorpc.NewServer(ledger)
+	slog.Info("Local UTxO RPC stand-in started.", "url", server.URL, "funding", LOCAL_FUNDING)
+	return server, nil
+}
+
+// trustLocalUtxorpc makes the stand-in's self-signed certificate the only
+// trusted root of this process by writing it to a temporary file and pointing
+// SSL_CERT_FILE at it. It must run before the first TLS connection and
+// returns the file, which the caller removes when done.
+func trustLocalUtxorpc(server *mockutxorpc.Server) (string, error) {
+	f, err := os.CreateTemp("", "utxorpc-local-*.pem")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(server.CertificatePEM()); err != nil {
+		return f.Name(), err
+	}
+	return f.Name(), os.Setenv("SSL_CERT_FILE", f.Name())
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"time"
@@ -14,6 +16,9 @@ import (
 	"github.com/Salvionied/apollo/txBuilding/Utils"
 )
 
+var localUtxorpc = flag.Bool("local-utxorpc", false,
+	"build and submit against an in-process UTxO RPC stand-in funded for user 1 instead of "+UtxorpcBaseUrl)
+
 func init() {
 	slog.SetDefault(slog.New(
 		tint.NewHandler(os.Stderr, &tint.Options{
@@ -24,15 +29,51 @@ func init() {
 }
 
 func main() {
+	flag.Parse()
+
 	slog.Info("Starting UTXO RPC based tx building script.")
 	WalletSetup()
 
-	slog.Info("Initializing UtxorpcChainContext...")
-	be, err := UtxorpcChainContext.NewUtxorpcChainContext(UtxorpcBaseUrl, int(constants.PREVIEW))
+	baseUrl := UtxorpcBaseUrl
+	if *localUtxorpc {
+		server, err := startLocalUtxorpc()
+		if err != nil {
+			slog.Error("Error starting local UTxO RPC stand-in", "error", err)
+			os.Exit(1)
+		}
+		defer server.Close()
+		certFile, err := trustLocalUtxorpc(server)
+		if certFile != "" {
+			defer os.Remove(certFile)
+		}
+		if err != nil {
+			slog.Error("Error trusting local UTxO RPC stand-in certificate", "error", err)
+			os.Exit(1)
+		}
+		baseUrl = server.URL
+	}
+
+	txID, err := buildAndSubmit(baseUrl)
 	if err != nil {
-		slog.Error("Error creating UtxorpcChainContext", "error", err)
+		slog.Error("Error building and submitting transaction", "error", err)
 		os.Exit(1)
 	}
+
+	slog.Info("TxID:", "txid", txID)
+	if !*localUtxorpc {
+		slog.Info("You can check the transaction on the blockchain explorer:", "link", "https://preview.cexplorer.io/tx/"+txID)
+	}
+	slog.Info("Script finished.")
+}
+
+// buildAndSubmit sends AMOUNT_TO_SEND from user 1 to user 2 through the UTxO
+// RPC endpoint at baseUrl and returns the hex id of the submitted transaction.
+func buildAndSubmit(baseUrl string) (string, error) {
+	slog.Info("Initializing UtxorpcChainContext...", "url", baseUrl)
+	be, err := UtxorpcChainContext.NewUtxorpcChainContext(baseUrl, int(constants.PREVIEW))
+	if err != nil {
+		return "", fmt.Errorf("create UtxorpcChainContext: %w", err)
+	}
 	slog.Info("UtxorpcChainContext initialized successfully.")
 
 	apolloBE := apollo.New(&be)
@@ -41,8 +82,7 @@ func main() {
 	slog.Info("Fetching UTXOs for target address...")
 	userUtxos, err := be.Utxos(GetUser1Wallet().Address)
 	if err != nil {
-		slog.Error("Error getting UTXOs", "error", err, "address", GetUser1Wallet().Address.String())
-		os.Exit(1)
+		return "", fmt.Errorf("get UTXOs for %s: %w", GetUser1Wallet().Address.String(), err)
 	}
 	slog.Info("UTXOs fetched successfully.", "count", len(userUtxos))
 	slog.Debug("User UTXOs", "utxos", userUtxos)
@@ -55,10 +95,8 @@ func main() {
 		PayToAddress(GetUser2Wallet().Address, AMOUNT_TO_SEND).
 		AddRequiredSigner(GetUser1Wallet().PKH).
 		Complete()
-
 	if err != nil {
-		slog.Error("Error completing transaction", "error", err)
-		os.Exit(1)
+		return "", fmt.Errorf("complete transaction: %w", err)
 	}
 	slog.Info("Transaction built successfully.")
 	slog.Debug("Transaction details", "apolloBE", apolloBE)
@@ -66,8 +104,7 @@ func main() {
 	slog.Info("Signing transaction...")
 	apolloBE, err = apolloBE.SignWithSkey(GetUser1Wallet().Vkey, GetUser1Wallet().Skey)
 	if err != nil {
-		slog.Error("Error signing transaction", "error", err)
-		os.Exit(1)
+		return "", fmt.Errorf("sign transaction: %w", err)
 	}
 	slog.Info("Transaction signed successfully.")
 
@@ -77,8 +114,7 @@ func main() {
 	slog.Info("Converting transaction to CBOR...")
 	cbor, err := Utils.ToCbor(tx)
 	if err != nil {
-		slog.Error("Error converting transaction to CBOR", "error", err)
-		os.Exit(1)
+		return "", fmt.Errorf("convert transaction to CBOR: %w", err)
 	}
 	slog.Info("Transaction converted to CBOR.")
 	slog.Info("Tx CBOR:", "cbor", cbor)
@@ -86,13 +122,9 @@ func main() {
 	slog.Info("Submitting transaction...")
 	txHash, err := apolloBE.Submit()
 	if err != nil {
-		slog.Error("Error submitting transaction", "error", err)
-		os.Exit(1)
+		return "", fmt.Errorf("submit transaction: %w", err)
 	}
 	slog.Info("Transaction submitted successfully.")
 
-	txID := hex.EncodeToString(txHash.Payload)
-	slog.Info("TxID:", "txid", txID)
-	slog.Info("You can check the transaction on the blockchain explorer:", "link", "https://preview.cexplorer.io/tx/"+txID)
-	slog.Info("Script finished.")
+	return hex.EncodeToString(txHash.Payload), nil
 }
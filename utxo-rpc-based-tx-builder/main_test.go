@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/blinklabs-io/bursa"
+)
+
+// TestBuildAndSubmitLocal runs the example end to end against the local UTxO
+// RPC stand-in: UtxorpcChainContext fetches the funded UTxO, Apollo builds and
+// signs the payment and the stand-in validates and applies it.
+func TestBuildAndSubmitLocal(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the stand-in certificate is trusted through SSL_CERT_FILE, which Go ignores on " + runtime.GOOS)
+	}
+
+	for _, name := range []string{"USER1_MNEMONIC", "USER2_MNEMONIC"} {
+		mnemonic, err := bursa.NewMnemonic()
+		if err != nil {
+			t.Fatalf("generate mnemonic: %v", err)
+		}
+		t.Setenv(name, mnemonic)
+	}
+	WalletSetup()
+
+	server, err := startLocalUtxorpc()
+	if err != nil {
+		t.Fatalf("start local UTxO RPC stand-in: %v", err)
+	}
+	defer server.Close()
+	if funding := server.Ledger.Utxos(GetUser1Wallet().Address); len(funding) != 1 {
+		t.Fatalf("user 1 was funded with %d UTxOs, want 1", len(funding))
+	}
+
+	certFile := filepath.Join(t.TempDir(), "utxorpc.pem")
+	if err := os.WriteFile(certFile, server.CertificatePEM(), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	t.Setenv("SSL_CERT_FILE", certFile)
+
+	txID, err := buildAndSubmit(server.URL)
+	if err != nil {
+		t.Fatalf("build and submit: %v", err)
+	}
+
+	if submitted := server.Ledger.Submitted(); len(submitted) != 1 || submitted[0] != txID {
+		t.Fatalf("stand-in applied %v, want [%s]", submitted, txID)
+	}
+
+	received := server.Ledger.Utxos(GetUser2Wallet().Address)
+	if len(received) != 1 || received[0].Output.Lovelace() != int64(AMOUNT_TO_SEND) {
+		t.Fatalf("user 2 holds %v, want one UTxO of %d lovelace", received, AMOUNT_TO_SEND)
+	}
+	if got := hex.EncodeToString(received[0].Input.TransactionId); got != txID {
+		t.Errorf("user 2 UTxO created by %s, want %s", got, txID)
+	}
+
+	for _, u := range server.Ledger.Utxos(GetUser1Wallet().Address) {
+		if hex.EncodeToString(u.Input.TransactionId) != txID {
+			t.Errorf("user 1 still holds %s#%d, want only change from %s",
+				hex.EncodeToString(u.Input.TransactionId), u.Input.Index, txID)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package mockutxorpc provides a local UTxO RPC node stand-in, so the
+// UtxorpcChainContext flow can be exercised without a real node or network
+// access.
+package mockutxorpc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Salvionied/apollo/serialization/Address"
+	"github.com/Salvionied/apollo/serialization/Transaction"
+	"github.com/Salvionied/apollo/serialization/TransactionInput"
+	"github.com/Salvionied/apollo/serialization/TransactionOutput"
+	"github.com/Salvionied/apollo/serialization/UTxO"
+	"github.com/Salvionied/apollo/serialization/Value"
+	"github.com/utxorpc/go-codegen/utxorpc/v1alpha/cardano"
+)
+
+// previewSystemStart is the Unix time of slot 0 on the preview network.
+const previewSystemStart = 1666656000
+
+// ErrRejected is wrapped by every error returned for a transaction the ledger
+// does not accept.
+var ErrRejected = errors.New("transaction rejected")
+
+type utxoRef struct {
+	hash  string
+	index uint32
+}
+
+type utxoEntry struct {
+	ref     utxoRef
+	address []byte
+	output  TransactionOutput.TransactionOutput
+	native  []byte
+}
+
+// Ledger is the in-memory chain state served by a Server. Submitted
+// transactions are applied immediately: their inputs are spent and their
+// outputs become available. It is safe for concurrent use.
+type Ledger struct {
+	// Params are returned by ReadParams. They must not be modified once the
+	// ledger is being served.
+	Params *cardano.PParams
+
+	mu        sync.Mutex
+	utxos     map[utxoRef]*utxoEntry
+	order     []utxoRef
+	submitted []string
+	funded    int
+}
+
+// NewLedger returns an empty ledger with preview-like protocol parameters.
+func NewLedger() *Ledger {
+	return &Ledger{
+		Params: DefaultParams(),
+		utxos:  make(map[utxoRef]*utxoEntry),
+	}
+}
+
+// DefaultParams returns the protocol parameters of the preview network that
+// matter for building simple transactions.
+func DefaultParams() *cardano.PParams {
+	return &cardano.PParams{
+		CoinsPerUtxoByte:         4310,
+		MaxTxSize:                16384,
+		MinFeeCoefficient:        44,
+		MinFeeConstant:           155381,
+		MaxBlockBodySize:         90112,
+		MaxBlockHeaderSize:       1100,
+		StakeKeyDeposit:          2_000_000,
+		PoolDeposit:              500_000_000,
+		PoolRetirementEpochBound: 18,
+		DesiredNumberOfPools:     500,
+		PoolInfluence:            &cardano.RationalNumber{Numerator: 3, Denominator: 10},
+		MonetaryExpansion:        &cardano.RationalNumber{Numerator: 3, Denominator: 1000},
+		TreasuryExpansion:        &cardano.RationalNumber{Numerator: 1, Denominator: 5},
+		MinPoolCost:              170_000_000,
+		ProtocolVersion:          &cardano.ProtocolVersion{Major: 10, Minor: 0},
+		MaxValueSize:             5000,
+		CollateralPercentage:     150,
+		MaxCollateralInputs:      3,
+		CostModels:               &cardano.CostModels{},
+		Prices: &cardano.ExPrices{
+			Steps:  &cardano.RationalNumber{Numerator: 721, Denominator: 10_000_000},
+			Memory: &cardano.RationalNumber{Numerator: 577, Denominator: 10_000},
+		},
+		MaxExecutionUnitsPerTransaction: &cardano.ExUnits{Steps: 10_000_000_000, Memory: 14_000_000},
+		MaxExecutionUnitsPerBlock:       &cardano.ExUnits{Steps: 20_000_000_000, Memory: 62_000_000},
+	}
+}
+
+// Fund adds a UTxO holding lovelace at address, as if it had been paid by a
+// faucet, and returns it.
+func (l *Ledger) Fund(address Address.Address, lovelace int64) (UTxO.UTxO, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Faucet transactions get distinct, deterministic hashes.
+	l.funded++
+	hash := sha256.Sum256(fmt.Appendf(nil, "mockutxorpc faucet %d", l.funded))
+	u := UTxO.UTxO{
+		Input: TransactionInput.TransactionInput{TransactionId: hash[:], Index: 0},
+		Output: TransactionOutput.SimpleTransactionOutput(
+			address,
+			Value.PureLovelaceValue(lovelace),
+		),
+	}
+	if err := l.add(u.Input, u.Output); err != nil {
+		return UTxO.UTxO{}, err
+	}
+	return u, nil
+}
+
+// Utxos returns the unspent outputs at address in the order they were
+// created.
+func (l *Ledger) Utxos(address Address.Address) []UTxO.UTxO {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var utxos []UTxO.UTxO
+	for _, e := range l.match(address.Bytes()) {
+		utxos = append(utxos, e.utxo())
+	}
+	return utxos
+}
+
+// Submitted returns the hex ids of the transactions applied so far.
+func (l *Ledger) Submitted() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.submitted...)
+}
+
+// Tip returns the current slot, derived from the wall clock like on the
+// preview network.
+func (l *Ledger) Tip() uint64 {
+	return uint64(time.Now().Unix() - previewSystemStart)
+}
+
+// Submit validates tx against the ledger and applies it. The transaction is
+// rejected unless all its inputs are unspent, every key-locked input and
+// required signer has a valid witness, and it spends exactly its outputs plus
+// the fee.
+func (l *Ledger) Submit(tx Transaction.Transaction) ([]byte, error) {
+	body := tx.TransactionBody
+	txHash, err := body.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("%w: hash body: %w", ErrRejected, err)
+	}
+	if len(body.Inputs) == 0 {
+		return nil, fmt.Errorf("%w: no inputs", ErrRejected)
+	}
+
+	signers, err := verifyWitnesses(tx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var consumed int64
+	for _, in := range body.Inputs {
+		e, ok := l.utxos[refOf(in)]
+		if !ok {
+			return nil, fmt.Errorf("%w: input %s#%d is unknown or already spent",
+				ErrRejected, hex.EncodeToString(in.TransactionId), in.Index)
+		}
+		addr := e.output.GetAddress()
+		// Odd address types have a script payment credential.
+		if addr.AddressType%2 == 0 && !signers[hex.EncodeToString(addr.PaymentPart)] {
+			return nil, fmt.Errorf("%w: input %s#%d is not signed by its owner",
+				ErrRejected, e.ref.hash, e.ref.index)
+		}
+		consumed += e.output.Lovelace()
+	}
+	for _, pkh := range body.RequiredSigners {
+		if !signers[hex.EncodeToString(pkh[:])] {
+			return nil, fmt.Errorf("%w: required signer %s has no witness",
+				ErrRejected, hex.EncodeToString(pkh[:]))
+		}
+	}
+
+	produced := body.Fee
+	for _, out := range body.Outputs {
+		produced += out.Lovelace()
+	}
+	if consumed != produced {
+		return nil, fmt.Errorf("%w: inputs hold %d lovelace but outputs and fee need %d",
+			ErrRejected, consumed, produced)
+	}
+
+	for _, in := range body.Inputs {
+		l.remove(refOf(in))
+	}
+	for i, out := range body.Outputs {
+		in := TransactionInput.TransactionInput{TransactionId: txHash, Index: i}
+		if err := l.add(in, out); err != nil {
+			return nil, err
+		}
+	}
+	l.submitted = append(l.submitted, hex.EncodeToString(txHash))
+	return txHash, nil
+}
+
+// verifyWitnesses checks every vkey witness of tx against txHash and returns
+// the hex key hashes of the signers.
+func verifyWitnesses(tx Transaction.Transaction, txHash []byte) (map[string]bool, error) {
+	signers := make(map[string]bool)
+	for _, w := range tx.TransactionWitnessSet.VkeyWitnesses {
+		if len(w.Vkey.Payload) != ed25519.PublicKeySize ||
+			!ed25519.Verify(w.Vkey.Payload, txHash, w.Signature) {
+			return nil, fmt.Errorf("%w: invalid signature for key %s",
+				ErrRejected, hex.EncodeToString(w.Vkey.Payload))
+		}
+		pkh, err := w.Vkey.Hash()
+		if err != nil {
+			return nil, fmt.Errorf("%w: hash key: %w", ErrRejected, err)
+		}
+		signers[hex.EncodeToString(pkh[:])] = true
+	}
+	return signers, nil
+}
+
+// add must be called with l.mu held.
+func (l *Ledger) add(in TransactionInput.TransactionInput, out TransactionOutput.TransactionOutput) error {
+	native, err := out.MarshalCBOR()
+	if err != nil {
+		return fmt.Errorf("encode output: %w", err)
+	}
+	ref := refOf(in)
+	l.utxos[ref] = &utxoEntry{
+		ref:     ref,
+		address: out.GetAddress().Bytes(),
+		output:  out,
+		native:  native,
+	}
+	l.order = append(l.order, ref)
+	return nil
+}
+
+// remove must be called with l.mu held.
+func (l *Ledger) remove(ref utxoRef) {
+	delete(l.utxos, ref)
+	for i, r := range l.order {
+		if r == ref {
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// lookup must be called with l.mu held.
+func (l *Ledger) lookup(hash []byte, index uint32) (*utxoEntry, bool) {
+	e, ok := l.utxos[utxoRef{hash: hex.EncodeToString(hash), index: index}]
+	return e, ok
+}
+
+// match returns the entries locked by the raw address bytes. It must be
+// called with l.mu held.
+func (l *Ledger) match(address []byte) []*utxoEntry {
+	var entries []*utxoEntry
+	for _, ref := range l.order {
+		if e := l.utxos[ref]; bytes.Equal(e.address, address) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (e *utxoEntry) utxo() UTxO.UTxO {
+	hash, _ := hex.DecodeString(e.ref.hash)
+	return UTxO.UTxO{
+		Input:  TransactionInput.TransactionInput{TransactionId: hash, Index: int(e.ref.index)},
+		Output: e.output,
+	}
+}
+
+func refOf(in TransactionInput.TransactionInput) utxoRef {
+	return utxoRef{hash: hex.EncodeToString(in.TransactionId), index: uint32(in.Index)}
+}